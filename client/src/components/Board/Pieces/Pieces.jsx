@@ -16,11 +16,11 @@ const Pieces = ({ updateHighlight, nothigh }) => {
   };
   console.log(state);
 
-  const placePiece = async (piece, oldRank, oldFile, newRank, newFile) => {
+  const placePiece = async (piece, oldRank, oldFile, newRank, newFile, promotion) => {
     try {
       const requestOptions = {
         method: "POST",
-        body: JSON.stringify({ Piece: piece, Rank: parseInt(oldRank), File: parseInt(oldFile), NewRank: parseInt(newRank), NewFile: parseInt(newFile) }),
+        body: JSON.stringify({ Piece: piece, Rank: parseInt(oldRank), File: parseInt(oldFile), NewRank: parseInt(newRank), NewFile: parseInt(newFile), Promotion: promotion }),
         headers: { "Content-Type": "application/json" },
       };
       const response = await fetch(
@@ -41,13 +41,21 @@ const Pieces = ({ updateHighlight, nothigh }) => {
 
     // this will be the new table state 
 
-    const response = await placePiece(p, rank, file, x, y);
+    // a pawn reaching the last rank can become a queen, rook, bishop or knight
+    let promotion = "";
+    if ((p === "wp" && x === 7) || (p === "bp" && x === 0)) {
+      promotion = window.prompt("Promote to (q, r, b, n)", "q") || "q";
+    }
+
+    const response = await placePiece(p, rank, file, x, y, promotion);
 
     nothigh();
     newPosition[x][y] = p;
     newPosition[rank][file] = "";
     //console.log("dropping", p, x, y);
-    setState(response);
+    if (response && response.board) {
+      setState(response.board);
+    }
 
     console.log(response);
     console.log(newPosition);
@@ -0,0 +1,118 @@
+// Command book builds a Polyglot opening book from PGN files. Every finished game adds its
+// first -depth plies, and a move's weight is the points it scored: 2 for a win and 1 for a
+// draw for the side that played it. Only the main line of each game is used.
+//
+//	book -out book.bin -depth 20 -min 3 games/*.pgn
+//
+// The book is played from with the server's -book flag or the OwnBook and BookFile UCI options.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"server/pgn"
+	. "server/utils"
+)
+
+// what the side to move scores in a game with this result, white's points first
+var RESULT_POINTS = map[string][2]uint32{
+	RESULT_WHITE_WINS: {2, 0},
+	RESULT_BLACK_WINS: {0, 2},
+	RESULT_DRAW:       {1, 1},
+}
+
+func main() {
+	out := flag.String("out", "book.bin", "where to write the book")
+	depth := flag.Int("depth", DEFAULT_BOOK_DEPTH, "how many plies of every game go into the book")
+	minGames := flag.Int("min", 1, "leave out moves played in fewer games than this")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "book needs at least one PGN file")
+		os.Exit(2)
+	}
+
+	builder := NewBookBuilder()
+	games, skipped := 0, 0
+	for _, path := range flag.Args() {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		parsed, err := pgn.Parse(string(text))
+		if err != nil {
+			// the games before the broken one are still good
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		}
+
+		for i := range parsed {
+			if err := addGame(builder, &parsed[i], *depth); err != nil {
+				fmt.Fprintf(os.Stderr, "%s, game %d: %v\n", path, i+1, err)
+				skipped++
+				continue
+			}
+			games++
+		}
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	entries, err := builder.Write(file, *minGames)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d games, %d skipped, %d entries written to %s\n", games, skipped, entries, *out)
+}
+
+// plays the main line of the game and adds every move up to depth plies into the game.
+// Games without a result don't say which moves were good, so they're left out
+func addGame(builder *BookBuilder, game *pgn.Game, depth int) error {
+	points, ok := RESULT_POINTS[game.Result]
+	if !ok {
+		return fmt.Errorf("no result")
+	}
+
+	fen := STARTING_FEN
+	if tagFen, ok := game.GetTag("FEN"); ok {
+		fen = tagFen
+	}
+	var board Bitboard
+	if err := InitBoardFromFEN(&board, fen); err != nil {
+		return fmt.Errorf("FEN tag: %v", err)
+	}
+
+	// the whole line is checked before anything is added, so a broken game adds nothing
+	start := CopyBitboard(&board)
+	var moves []Move
+	for i, node := range game.Moves {
+		if GamePly(&board) >= depth {
+			break
+		}
+		move, err := ParseSAN(node.San, &board)
+		if err != nil {
+			return fmt.Errorf("ply %d: %v", i+1, err)
+		}
+		moves = append(moves, move)
+		MakeMove(move, &board)
+	}
+
+	for _, move := range moves {
+		side := 0
+		if !IsWhiteTurn(&start) {
+			side = 1
+		}
+		builder.Add(&start, move, points[side])
+		MakeMove(move, &start)
+	}
+	return nil
+}
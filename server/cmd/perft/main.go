@@ -0,0 +1,44 @@
+// Command perft counts the leaf nodes of the legal move tree from a position, to check
+// move generation against the published numbers or against another engine.
+//
+//	perft -depth 5
+//	perft -fen "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1" -depth 4 -divide
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	. "server/utils"
+)
+
+func main() {
+	fen := flag.String("fen", STARTING_FEN, "position to count from")
+	depth := flag.Int("depth", 4, "how many plies deep to count")
+	divide := flag.Bool("divide", false, "print the count under every first move")
+	flag.Parse()
+
+	var bitboard Bitboard
+	if err := InitBoardFromFEN(&bitboard, *fen); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid FEN:", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	var nodes uint64
+	if *divide {
+		for _, result := range Divide(&bitboard, *depth) {
+			fmt.Printf("%s: %d\n", MoveToUCI(result.Move), result.Nodes)
+			nodes += result.Nodes
+		}
+		fmt.Println()
+	} else {
+		nodes = Perft(&bitboard, *depth)
+	}
+	elapsed := time.Since(start)
+
+	fmt.Printf("Nodes searched: %d\n", nodes)
+	fmt.Printf("Time: %v (%.0f nodes/s)\n", elapsed.Round(time.Millisecond), float64(nodes)/elapsed.Seconds())
+}
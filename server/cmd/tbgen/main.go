@@ -0,0 +1,573 @@
+// Command tbgen generates Syzygy tablebases for small endgames, which is how the tables in
+// syzygy/testdata were made. Every position is worked out by retrograde analysis, then written
+// as a .rtbw and a .rtbz file and read back to check that every value comes out the same.
+//
+//	tbgen -out syzygy/testdata KQvK KRvK KPvK KBvK KNvK KBNvK KPvKP
+//
+// The tables an endgame turns into after a capture or promotion are generated and written too.
+// It's meant for tables of three or four pieces. Like the real tables they never have en passant
+// rights, a double pawn push just counts for as much as taking it en passant does for the other
+// side. A table with a win that takes longer than the fifty move rule allows is refused since
+// cursed results aren't supported.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"server/syzygy"
+)
+
+const (
+	ILLEGAL = -128
+	MAX_DTZ = 100 // plies
+	WHITE   = 0
+	BLACK   = 1
+)
+
+// what decides which side of a name comes first, the stronger one
+var PIECE_VALUES = map[syzygy.Piece]int{
+	syzygy.PAWN: 1, syzygy.KNIGHT: 3, syzygy.BISHOP: 3, syzygy.ROOK: 5, syzygy.QUEEN: 9, syzygy.KING: 0,
+}
+
+var PROMOTIONS = []syzygy.Piece{syzygy.QUEEN, syzygy.ROOK, syzygy.BISHOP, syzygy.KNIGHT}
+
+func main() {
+	out := flag.String("out", ".", "the directory to write the tables to")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "tbgen needs at least one table, like KRvK")
+		os.Exit(2)
+	}
+
+	g := &generator{tables: map[string]*table{}}
+	for _, name := range flag.Args() {
+		white, black, ok := strings.Cut(name, "v")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%q isn't a table name\n", name)
+			os.Exit(2)
+		}
+		name, _ = canonical(white, black)
+		if _, err := g.solve(name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	names := make([]string, 0, len(g.tables))
+	for name, t := range g.tables {
+		if len(t.pieces) > 2 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range names {
+		for _, kind := range []syzygy.Kind{syzygy.WDL, syzygy.DTZ} {
+			path, size, err := g.tables[name].write(kind, *out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s: %d bytes\n", path, size)
+		}
+	}
+}
+
+// the name of the table with the material of both sides, the stronger side first, and whether
+// that's the other way round from white and black
+func canonical(white string, black string) (string, bool) {
+	strength := func(side string) int {
+		total := 0
+		for i := 0; i < len(side); i++ {
+			total += PIECE_VALUES[syzygy.LETTER_TO_PIECE[side[i]]]
+		}
+		return total
+	}
+	if strength(black) != strength(white) {
+		return swapped(white, black, strength(black) > strength(white))
+	}
+	if len(black) != len(white) {
+		return swapped(white, black, len(black) > len(white))
+	}
+	// the same strength and as many pieces, so the first piece that's different decides, in the
+	// order the letters go: KBvKN and not KNvKB
+	for i := 0; i < len(white); i++ {
+		if white[i] != black[i] {
+			return swapped(white, black, strings.IndexByte(syzygy.PIECE_LETTERS, black[i]) < strings.IndexByte(syzygy.PIECE_LETTERS, white[i]))
+		}
+	}
+	return white + "v" + black, false
+}
+
+func swapped(white string, black string, swap bool) (string, bool) {
+	if swap {
+		return black + "v" + white, true
+	}
+	return white + "v" + black, false
+}
+
+// =================================== TABLES ===================================
+// a position is indexed by the side to move and then the square of every piece, 6 bits each.
+// Pieces of the same kind on each other's squares come up more than once, which costs space but
+// keeps the index simple
+type table struct {
+	name   string
+	pieces []syzygy.Piece // white is the left side of the name
+	kings  [2]int
+	values []int8 // for the side to move, plies to the next zeroing move, 0 for a draw
+	exits  map[exitKey]*exit
+	g      *generator
+}
+
+type exitKey struct {
+	removed, promoted int
+	promotion         syzygy.Piece
+}
+
+// where a capture or promotion goes: the child table, whether its colors are the other way round,
+// and which of our pieces goes in each of its slots
+type exit struct {
+	child *table // nil when only the kings are left
+	flip  bool
+	slots []int
+}
+
+type generator struct {
+	tables map[string]*table
+}
+
+func (g *generator) solve(name string) (*table, error) {
+	if t, ok := g.tables[name]; ok {
+		return t, nil
+	}
+	white, black, _ := strings.Cut(name, "v")
+	t := &table{name: name, exits: map[exitKey]*exit{}, g: g}
+	for color, side := range []string{white, black} {
+		for i := 0; i < len(side); i++ {
+			piece, ok := syzygy.LETTER_TO_PIECE[side[i]]
+			if !ok {
+				return nil, fmt.Errorf("%s: %q isn't a piece", name, side[i])
+			}
+			if piece == syzygy.KING {
+				t.kings[color] = len(t.pieces)
+			}
+			t.pieces = append(t.pieces, piece|syzygy.Piece(color)*syzygy.BLACK)
+		}
+	}
+	if _, err := syzygy.NewTable(name, syzygy.WDL); err != nil {
+		return nil, err
+	}
+	g.tables[name] = t
+	if len(t.pieces) == 2 {
+		return t, nil
+	}
+
+	// positions no slice has, with a pawn on the first or last rank, stay illegal
+	t.values = make([]int8, 2<<(6*len(t.pieces)))
+	for i := range t.values {
+		t.values[i] = ILLEGAL
+	}
+	remaining := make([]uint8, len(t.values))
+	for _, slice := range t.slices() {
+		if err := g.solveSlice(t, slice, remaining); err != nil {
+			return nil, err
+		}
+	}
+
+	var counts [3]int
+	longest := 0
+	for _, value := range t.values {
+		switch {
+		case value == ILLEGAL:
+		case value > 0:
+			counts[0]++
+			longest = max(longest, int(value))
+		case value == 0:
+			counts[1]++
+		default:
+			counts[2]++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d wins, %d draws and %d losses, the longest win is %d plies\n", name, counts[0], counts[1], counts[2], longest)
+	return t, nil
+}
+
+// the positions split up by where the pawns are, the most advanced first so a pawn move always
+// goes to a part that's done
+func (t *table) slices() [][]int {
+	var pawns, others []int
+	for i, piece := range t.pieces {
+		if piece&syzygy.PIECE_TYPE_MASK == syzygy.PAWN {
+			pawns = append(pawns, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+
+	var placements [][]int
+	var place func(squares []int)
+	place = func(squares []int) {
+		if len(squares) == len(pawns) {
+			placements = append(placements, append([]int{}, squares...))
+			return
+		}
+	next:
+		for square := 8; square < 56; square++ {
+			for _, taken := range squares {
+				if taken == square {
+					continue next
+				}
+			}
+			place(append(squares, square))
+		}
+	}
+	place(nil)
+	progress := func(squares []int) int {
+		total := 0
+		for i, square := range squares {
+			if t.pieces[pawns[i]]&syzygy.BLACK == 0 {
+				total += square >> 3
+			} else {
+				total += 7 - square>>3
+			}
+		}
+		return total
+	}
+	sort.SliceStable(placements, func(i, j int) bool { return progress(placements[i]) > progress(placements[j]) })
+
+	var slices [][]int
+	var squares [syzygy.MAX_PIECES]int
+	for _, placement := range placements {
+		for i, pawn := range pawns {
+			squares[pawn] = placement[i]
+		}
+		var slice []int
+		for stm := 0; stm < 2; stm++ {
+			for n := 0; n < 1<<(6*len(others)); n++ {
+				for i, piece := range others {
+					squares[piece] = n >> (6 * (len(others) - 1 - i)) & 63
+				}
+				slice = append(slice, t.index(stm, squares[:len(t.pieces)]))
+			}
+		}
+		slices = append(slices, slice)
+	}
+	return slices
+}
+
+func (t *table) index(stm int, squares []int) int {
+	idx := stm
+	for _, square := range squares {
+		idx = idx<<6 | square
+	}
+	return idx
+}
+
+func (t *table) decode(idx int) *position {
+	p := &position{t: t, stm: idx >> (6 * len(t.pieces))}
+	for i := range t.pieces {
+		p.squares[i] = idx >> (6 * (len(t.pieces) - 1 - i)) & 63
+		p.pieces[i] = t.pieces[i]
+	}
+	p.update()
+	return p
+}
+
+// =================================== SOLVING ===================================
+// every position starts out from the moves that leave the slice: captures, promotions and pawn
+// moves. Then it's a search outwards from the positions that are settled, one ply at a time. A
+// position is won the first time it can move to a lost one, and lost once every move is to a
+// won one
+func (g *generator) solveSlice(t *table, slice []int, remaining []uint8) error {
+	var level, mates []int
+	for _, idx := range slice {
+		p := t.decode(idx)
+		if !p.legal() {
+			continue
+		}
+		t.values[idx] = 0
+		total, bad, win := 0, 0, false
+		var err error
+		p.forEachMove(func(child *position, m move) {
+			total++
+			if !m.zeroing || err != nil {
+				return
+			}
+			var value int
+			value, err = g.childValue(child, m)
+			if value < 0 {
+				win = true
+			} else if value > 0 {
+				bad++
+			}
+		})
+		if err != nil {
+			return err
+		}
+		switch {
+		case total == 0 && p.inCheck():
+			t.values[idx] = -1
+			mates = append(mates, idx)
+			level = append(level, idx)
+		case total == 0:
+		case win:
+			t.values[idx] = 1
+			level = append(level, idx)
+		case bad == total:
+			t.values[idx] = -1
+			level = append(level, idx)
+		}
+		remaining[idx] = uint8(total - bad)
+	}
+
+	// mate ends the game, so like a zeroing move it's one ply away
+	for _, idx := range mates {
+		t.decode(idx).forEachUnmove(func(q int) {
+			if t.values[q] == 0 {
+				t.values[q] = 1
+				level = append(level, q)
+			}
+		})
+	}
+
+	for d := 1; len(level) > 0; d++ {
+		if d > MAX_DTZ {
+			return fmt.Errorf("%s: a zeroing move is more than %d plies away, that needs cursed results", t.name, MAX_DTZ)
+		}
+		var next []int
+		for _, idx := range level {
+			value := t.values[idx]
+			t.decode(idx).forEachUnmove(func(q int) {
+				if t.values[q] != 0 {
+					return
+				}
+				if value < 0 {
+					t.values[q] = int8(d + 1)
+					next = append(next, q)
+					return
+				}
+				if remaining[q] == 0 {
+					panic(fmt.Sprintf("%s: more moves into %d than out of it", t.name, q))
+				}
+				remaining[q]--
+				if remaining[q] == 0 {
+					t.values[q] = int8(-d - 1)
+					next = append(next, q)
+				}
+			})
+		}
+		level = next
+	}
+	return nil
+}
+
+// the value of the position after a zeroing move, for its side to move
+func (g *generator) childValue(child *position, m move) (int, error) {
+	t := child.t
+	if m.captured < 0 && m.promotion == 0 {
+		value := int(t.values[t.index(child.stm, child.squares[:len(t.pieces)])])
+		if m.passed < 0 || value > 0 {
+			return value, nil
+		}
+
+		// taking en passant might do better than the table, which doesn't know it's possible. Only
+		// whether it wins or draws matters, a pawn move is one ply from zeroing whatever comes after
+		var err error
+		child.forEachEnPassant(m.piece, m.passed, func(after *position, ep move) {
+			if err != nil {
+				return
+			}
+			var result int
+			if result, err = g.childValue(after, ep); result < 0 {
+				value = 1
+			} else if result == 0 && value < 0 {
+				value = 0
+			}
+		})
+		return value, err
+	}
+
+	promoted := -1
+	if m.promotion != 0 {
+		promoted = m.piece
+	}
+	key := exitKey{m.captured, promoted, m.promotion}
+	e, ok := t.exits[key]
+	if !ok {
+		var err error
+		if e, err = g.newExit(t, key); err != nil {
+			return 0, err
+		}
+		t.exits[key] = e
+	}
+	if e.child == nil {
+		return 0, nil
+	}
+
+	flipSquares := 0
+	if e.flip {
+		flipSquares = 56
+	}
+	stm := child.stm
+	if e.flip {
+		stm ^= 1
+	}
+	idx := stm
+	for _, slot := range e.slots {
+		idx = idx<<6 | child.squares[slot] ^ flipSquares
+	}
+	return int(e.child.values[idx]), nil
+}
+
+func (g *generator) newExit(t *table, key exitKey) (*exit, error) {
+	var sides [2]strings.Builder
+	var left []syzygy.Piece
+	var from []int
+	for _, piece := range syzygy.PIECE_LETTERS {
+		for i, have := range t.pieces {
+			if i == key.removed {
+				continue
+			}
+			if i == key.promoted {
+				have = key.promotion | have&syzygy.BLACK
+			}
+			if have&syzygy.PIECE_TYPE_MASK == syzygy.LETTER_TO_PIECE[byte(piece)] {
+				sides[have>>3].WriteRune(piece)
+				left = append(left, have)
+				from = append(from, i)
+			}
+		}
+	}
+
+	name, flip := canonical(sides[WHITE].String(), sides[BLACK].String())
+	child, err := g.solve(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(child.pieces) == 2 {
+		return &exit{}, nil
+	}
+	e := &exit{child: child, flip: flip}
+	used := make([]bool, len(left))
+	for _, want := range child.pieces {
+		if flip {
+			want ^= syzygy.BLACK
+		}
+		for i, have := range left {
+			if !used[i] && have == want {
+				used[i] = true
+				e.slots = append(e.slots, from[i])
+				break
+			}
+		}
+	}
+	return e, nil
+}
+
+// =================================== WRITING ===================================
+// writes the table in the Syzygy format and reads it back to check it. Positions the probing
+// code never reads the table for are don't cares: in a WDL table wins with a winning capture, in
+// a DTZ table draws and wins with a winning zeroing move. DTZ tables only have white to move
+func (t *table) write(kind syzygy.Kind, dir string) (string, int, error) {
+	layout, err := syzygy.NewTable(t.name, kind)
+	if err != nil {
+		return "", 0, err
+	}
+	var values [2][4][]uint16
+	for side := 0; side < layout.Sides(); side++ {
+		for file := 0; file < layout.Files(); file++ {
+			values[side][file] = make([]uint16, layout.Size(side, file))
+			for i := range values[side][file] {
+				values[side][file][i] = syzygy.DONT_CARE
+			}
+		}
+	}
+
+	// what every position should read back as, for the check afterwards
+	expected := make([]int, len(t.values))
+	for idx, value := range t.values {
+		expected[idx] = syzygy.DONT_CARE
+		if value == ILLEGAL {
+			continue
+		}
+		p := t.decode(idx)
+		var stored int
+		if kind == syzygy.WDL {
+			stored = syzygy.DRAW
+			if value > 0 {
+				stored = syzygy.WIN
+			} else if value < 0 {
+				stored = syzygy.LOSS
+			}
+			if stored == syzygy.WIN && p.winsByZeroing(false) {
+				continue
+			}
+		} else {
+			if value == 0 || (value > 0 && p.winsByZeroing(true)) {
+				continue
+			}
+			stored = abs(int(value))
+		}
+
+		pos := p.syzygyPosition()
+		side, file, i, err := layout.Locate(&pos)
+		if err == syzygy.ErrChangeSTM {
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %v", t.name, err)
+		}
+		raw := uint16(stored + 2)
+		if kind == syzygy.DTZ {
+			raw = uint16(stored - 1)
+		}
+		if have := values[side][file][i]; have != syzygy.DONT_CARE && have != raw {
+			return "", 0, fmt.Errorf("%s: two positions with different values at index %d", t.name, i)
+		}
+		values[side][file][i] = raw
+		expected[idx] = stored
+	}
+
+	var file bytes.Buffer
+	if err := layout.Write(&file, values); err != nil {
+		return "", 0, err
+	}
+	read, err := syzygy.ReadTable(t.name, kind, file.Bytes())
+	if err != nil {
+		return "", 0, err
+	}
+	for idx, want := range expected {
+		if want == syzygy.DONT_CARE {
+			continue
+		}
+		pos := t.decode(idx).syzygyPosition()
+		wdl := syzygy.WIN
+		if t.values[idx] < 0 {
+			wdl = syzygy.LOSS
+		}
+		if got, err := read.Probe(&pos, wdl); err != nil || got != want {
+			return "", 0, fmt.Errorf("%s: position %d read back as %d (%v), want %d", t.name, idx, got, err, want)
+		}
+	}
+
+	extension := map[syzygy.Kind]string{syzygy.WDL: syzygy.WDL_EXTENSION, syzygy.DTZ: syzygy.DTZ_EXTENSION}[kind]
+	path := filepath.Join(dir, t.name+extension)
+	return path, file.Len(), os.WriteFile(path, file.Bytes(), 0o644)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"math/bits"
+
+	"server/syzygy"
+)
+
+// =================================== POSITIONS ===================================
+// just enough of a move generator for the handful of pieces in a table, on squares numbered
+// from a1 the way the tables number them
+type position struct {
+	t        *table
+	stm      int
+	squares  [syzygy.MAX_PIECES]int // -1 once it's been captured
+	pieces   [syzygy.MAX_PIECES]syzygy.Piece
+	colors   [2]uint64
+	occupied uint64
+}
+
+type move struct {
+	piece, to, captured int // captured is -1 for none
+	promotion           syzygy.Piece
+	zeroing             bool
+	passed              int // the square a pawn pushed two squares went over, -1 for any other move
+}
+
+const (
+	STRAIGHT = 1
+	DIAGONAL = 2
+)
+
+var (
+	KNIGHT_ATTACKS [64]uint64
+	KING_ATTACKS   [64]uint64
+	PAWN_ATTACKS   [2][64]uint64
+	LINE           [64][64]int // STRAIGHT or DIAGONAL if a slider could go from one to the other
+	BETWEEN        [64][64]uint64
+
+	STRAIGHT_DIRECTIONS = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	DIAGONAL_DIRECTIONS = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+func onBoard(file int, rank int) bool {
+	return file >= 0 && file < 8 && rank >= 0 && rank < 8
+}
+
+func init() {
+	for square := 0; square < 64; square++ {
+		file, rank := square&7, square>>3
+		for _, step := range [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}} {
+			if onBoard(file+step[0], rank+step[1]) {
+				KNIGHT_ATTACKS[square] |= 1 << ((rank+step[1])*8 + file + step[0])
+			}
+		}
+		for _, step := range append(append([][2]int{}, STRAIGHT_DIRECTIONS...), DIAGONAL_DIRECTIONS...) {
+			if onBoard(file+step[0], rank+step[1]) {
+				KING_ATTACKS[square] |= 1 << ((rank+step[1])*8 + file + step[0])
+			}
+		}
+		for _, df := range []int{-1, 1} {
+			if onBoard(file+df, rank+1) {
+				PAWN_ATTACKS[WHITE][square] |= 1 << ((rank+1)*8 + file + df)
+			}
+			if onBoard(file+df, rank-1) {
+				PAWN_ATTACKS[BLACK][square] |= 1 << ((rank-1)*8 + file + df)
+			}
+		}
+		for line, directions := range [][][2]int{STRAIGHT_DIRECTIONS, DIAGONAL_DIRECTIONS} {
+			for _, step := range directions {
+				between := uint64(0)
+				for f, r := file+step[0], rank+step[1]; onBoard(f, r); f, r = f+step[0], r+step[1] {
+					LINE[square][r*8+f] = line + 1
+					BETWEEN[square][r*8+f] = between
+					between |= 1 << (r*8 + f)
+				}
+			}
+		}
+	}
+}
+
+func (p *position) update() {
+	p.colors = [2]uint64{}
+	for i := range p.t.pieces {
+		if p.squares[i] >= 0 {
+			p.colors[p.pieces[i]>>3] |= 1 << p.squares[i]
+		}
+	}
+	p.occupied = p.colors[WHITE] | p.colors[BLACK]
+}
+
+func attacks(piece syzygy.Piece, from int, to int, occupied uint64) bool {
+	switch piece & syzygy.PIECE_TYPE_MASK {
+	case syzygy.PAWN:
+		return PAWN_ATTACKS[piece>>3][from]&(1<<to) != 0
+	case syzygy.KNIGHT:
+		return KNIGHT_ATTACKS[from]&(1<<to) != 0
+	case syzygy.KING:
+		return KING_ATTACKS[from]&(1<<to) != 0
+	case syzygy.BISHOP:
+		return LINE[from][to] == DIAGONAL && BETWEEN[from][to]&occupied == 0
+	case syzygy.ROOK:
+		return LINE[from][to] == STRAIGHT && BETWEEN[from][to]&occupied == 0
+	case syzygy.QUEEN:
+		return LINE[from][to] != 0 && BETWEEN[from][to]&occupied == 0
+	}
+	return false
+}
+
+func (p *position) attacked(square int, by int) bool {
+	for i := range p.t.pieces {
+		if p.squares[i] >= 0 && int(p.pieces[i]>>3) == by && attacks(p.pieces[i], p.squares[i], square, p.occupied) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *position) inCheck() bool {
+	return p.attacked(p.squares[p.t.kings[p.stm]], p.stm^1)
+}
+
+// every piece on its own square, no pawns on the first or last rank, and the side that just
+// moved isn't in check
+func (p *position) legal() bool {
+	if bits.OnesCount64(p.occupied) != len(p.t.pieces) {
+		return false
+	}
+	for i, piece := range p.pieces[:len(p.t.pieces)] {
+		if piece&syzygy.PIECE_TYPE_MASK == syzygy.PAWN && (p.squares[i] < 8 || p.squares[i] >= 56) {
+			return false
+		}
+	}
+	return !p.attacked(p.squares[p.t.kings[p.stm^1]], p.stm)
+}
+
+// the squares a piece other than a pawn can go to, whatever's on them
+func (p *position) targets(piece syzygy.Piece, from int) uint64 {
+	switch piece & syzygy.PIECE_TYPE_MASK {
+	case syzygy.KNIGHT:
+		return KNIGHT_ATTACKS[from]
+	case syzygy.KING:
+		return KING_ATTACKS[from]
+	}
+	var directions [][2]int
+	if piece&syzygy.PIECE_TYPE_MASK != syzygy.BISHOP {
+		directions = append(directions, STRAIGHT_DIRECTIONS...)
+	}
+	if piece&syzygy.PIECE_TYPE_MASK != syzygy.ROOK {
+		directions = append(directions, DIAGONAL_DIRECTIONS...)
+	}
+	targets := uint64(0)
+	for _, step := range directions {
+		for f, r := from&7+step[0], from>>3+step[1]; onBoard(f, r); f, r = f+step[0], r+step[1] {
+			targets |= 1 << (r*8 + f)
+			if p.occupied&(1<<(r*8+f)) != 0 {
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// calls fn with every legal move and the position after it
+func (p *position) forEachMove(fn func(child *position, m move)) {
+	color := p.stm
+	for i := range p.t.pieces {
+		piece, from := p.pieces[i], p.squares[i]
+		if from < 0 || int(piece>>3) != color {
+			continue
+		}
+		pawn := piece&syzygy.PIECE_TYPE_MASK == syzygy.PAWN
+		var targets uint64
+		if pawn {
+			forward, start := 8, 1
+			if color == BLACK {
+				forward, start = -8, 6
+			}
+			if p.occupied&(1<<(from+forward)) == 0 {
+				targets |= 1 << (from + forward)
+				if from>>3 == start && p.occupied&(1<<(from+2*forward)) == 0 {
+					targets |= 1 << (from + 2*forward)
+				}
+			}
+			targets |= PAWN_ATTACKS[color][from] & p.colors[color^1]
+		} else {
+			targets = p.targets(piece, from) &^ p.colors[color]
+		}
+
+		for ; targets != 0; targets &= targets - 1 {
+			to := bits.TrailingZeros64(targets)
+			captured := -1
+			for j := range p.t.pieces {
+				if p.squares[j] == to {
+					captured = j
+				}
+			}
+			if captured >= 0 && p.pieces[captured]&syzygy.PIECE_TYPE_MASK == syzygy.KING {
+				continue
+			}
+			promotions := []syzygy.Piece{0}
+			if pawn && (to < 8 || to >= 56) {
+				promotions = PROMOTIONS
+			}
+			for _, promotion := range promotions {
+				child := *p
+				child.squares[i] = to
+				if captured >= 0 {
+					child.squares[captured] = -1
+				}
+				if promotion != 0 {
+					child.pieces[i] = promotion | piece&syzygy.BLACK
+				}
+				child.stm ^= 1
+				child.update()
+				if child.attacked(child.squares[p.t.kings[color]], child.stm) {
+					continue
+				}
+				passed := -1
+				if pawn && abs(to-from) == 16 {
+					passed = (from + to) / 2
+				}
+				fn(&child, move{i, to, captured, promotion, pawn || captured >= 0, passed})
+			}
+		}
+	}
+}
+
+// calls fn with every legal en passant capture of the pawn that just went over passed, and the
+// position after it. The tables never have en passant rights, so this is the only place it's seen
+func (p *position) forEachEnPassant(pushed int, passed int, fn func(child *position, m move)) {
+	color := p.stm
+	for i := range p.t.pieces {
+		piece, from := p.pieces[i], p.squares[i]
+		if from < 0 || int(piece>>3) != color || piece&syzygy.PIECE_TYPE_MASK != syzygy.PAWN || PAWN_ATTACKS[color][from]&(1<<passed) == 0 {
+			continue
+		}
+		child := *p
+		child.squares[i] = passed
+		child.squares[pushed] = -1
+		child.stm ^= 1
+		child.update()
+		if child.attacked(child.squares[p.t.kings[color]], child.stm) {
+			continue
+		}
+		fn(&child, move{i, passed, pushed, 0, true, -1})
+	}
+}
+
+// calls fn with the index of every legal position that gets here with a move that isn't a
+// capture or a pawn move
+func (p *position) forEachUnmove(fn func(q int)) {
+	mover := p.stm ^ 1
+	for i := range p.t.pieces {
+		piece, from := p.pieces[i], p.squares[i]
+		if int(piece>>3) != mover || piece&syzygy.PIECE_TYPE_MASK == syzygy.PAWN {
+			continue
+		}
+		for targets := p.targets(piece, from) &^ p.occupied; targets != 0; targets &= targets - 1 {
+			q := *p
+			q.squares[i] = bits.TrailingZeros64(targets)
+			q.stm = mover
+			q.update()
+			if q.attacked(q.squares[p.t.kings[p.stm]], mover) {
+				continue
+			}
+			fn(p.t.index(mover, q.squares[:len(p.t.pieces)]))
+		}
+	}
+}
+
+// whether a capture, or a pawn move too if pawnMoves is set, wins straight away
+func (p *position) winsByZeroing(pawnMoves bool) bool {
+	wins := false
+	p.forEachMove(func(child *position, m move) {
+		if wins || !(m.captured >= 0 || (pawnMoves && m.zeroing)) {
+			return
+		}
+		if value, err := p.t.g.childValue(child, m); err == nil && value < 0 {
+			wins = true
+		}
+	})
+	return wins
+}
+
+func (p *position) syzygyPosition() syzygy.Position {
+	pos := syzygy.Position{WhiteToMove: p.stm == WHITE}
+	for i := range p.t.pieces {
+		pos.Board[p.squares[i]] = p.pieces[i]
+	}
+	return pos
+}
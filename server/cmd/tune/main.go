@@ -0,0 +1,77 @@
+// Command tune fits the evaluation to a file of positions from finished games (Texel's
+// method) and writes out the tuned parameters. Each line of the file is a FEN followed by
+// the result of the game it came from, for example
+//
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1 1/2-1/2
+//
+// Everything happens locally.
+//
+//	tune -positions quiet.epd -out weights.json
+//	tune -positions quiet.epd -out ../../utils/tuned.go
+//
+// A .json file is loaded with the server's -eval flag or the EvalFile UCI option, a .go file
+// is compiled into the engine.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	. "server/utils"
+)
+
+func main() {
+	positionsPath := flag.String("positions", "", "file of \"<fen> <result>\" lines to tune against")
+	out := flag.String("out", "weights.json", "where to write the tuned parameters, as JSON or as Go if it ends in .go")
+	start := flag.String("eval", "", "parameters to start from (a JSON file written by an earlier run)")
+	iterations := flag.Int("iterations", 100, "most passes over the parameters")
+	k := flag.Float64("k", 0, "sigmoid scaling constant, fitted to the positions if left at 0")
+	flag.Parse()
+
+	if *positionsPath == "" {
+		fmt.Fprintln(os.Stderr, "tune needs -positions")
+		os.Exit(2)
+	}
+
+	if *start != "" {
+		if err := LoadParamsFile(*start); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	file, err := os.Open(*positionsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	positions, err := LoadTuningPositions(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d positions\n", len(positions))
+
+	if *k == 0 {
+		*k = FitK(positions)
+	}
+	fmt.Printf("K %.4f, error %.8f\n", *k, TuningError(positions, *k))
+
+	began := time.Now()
+	params := Tune(positions, *k, *iterations, func(iteration int, err float64) {
+		fmt.Printf("iteration %d, error %.8f, %v\n", iteration, err, time.Since(began).Round(time.Second))
+		// written after every pass so a long run can be stopped without losing it
+		if err := WriteParams(*out, CurrentParams()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	})
+
+	if err := WriteParams(*out, params); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("wrote", *out)
+}
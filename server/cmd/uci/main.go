@@ -0,0 +1,435 @@
+// Command uci runs the engine behind the Universal Chess Interface so it can be
+// used from chess GUIs and tournament managers. It reads commands on stdin and
+// answers on stdout.
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "server/utils"
+)
+
+const (
+	ENGINE_NAME   = "SteveStef Chess"
+	ENGINE_AUTHOR = "SteveStef"
+)
+
+type option struct {
+	kind     string // spin, check, button, string
+	value    string
+	min, max int
+}
+
+type engine struct {
+	board   Bitboard
+	options map[string]*option
+	tt      *TranspositionTable
+	book    *Book      // loaded from BookFile, only played from while OwnBook is on
+	tb      *Tablebase // the Syzygy tables in SyzygyPath
+
+	out sync.Mutex // the search goroutine and the command loop both write to stdout
+
+	cancel    context.CancelFunc
+	searching sync.WaitGroup
+}
+
+// the limits that came with a go command
+type searchLimits struct {
+	depth     int
+	movetime  time.Duration
+	wtime     time.Duration
+	btime     time.Duration
+	winc      time.Duration
+	binc      time.Duration
+	movesToGo int
+	infinite  bool
+}
+
+func newEngine() *engine {
+	e := &engine{
+		options: map[string]*option{
+			"Depth":       {kind: "spin", value: "4", min: 1, max: MAX_DEPTH},
+			"Hash":        {kind: "spin", value: strconv.Itoa(DEFAULT_TT_MB), min: 1, max: MAX_TT_MB},
+			"EvalFile":    {kind: "string"}, // tuned parameters written by the tune command
+			"Threads":     {kind: "spin", value: "1", min: 1, max: MAX_THREADS},
+			"Skill Level": {kind: "spin", value: strconv.Itoa(MAX_SKILL_LEVEL), min: 0, max: MAX_SKILL_LEVEL},
+
+			// a polyglot opening book
+			"OwnBook":      {kind: "check", value: "false"},
+			"BookFile":     {kind: "string"},
+			"BookDepth":    {kind: "spin", value: strconv.Itoa(DEFAULT_BOOK_DEPTH), min: 0, max: MAX_BOOK_DEPTH},
+			"BestBookMove": {kind: "check", value: "false"},
+
+			// Syzygy tablebases, one or more directories separated the way PATH is
+			"SyzygyPath": {kind: "string"},
+
+			// the selective search features, so they can be switched off one at a time for testing
+			"PVS":               {kind: "check", value: "true"},
+			"AspirationWindows": {kind: "check", value: "true"},
+			"NullMove":          {kind: "check", value: "true"},
+			"LMR":               {kind: "check", value: "true"},
+			"Futility":          {kind: "check", value: "true"},
+			"ReverseFutility":   {kind: "check", value: "true"},
+			"CheckExtensions":   {kind: "check", value: "true"},
+		},
+		tt: NewTranspositionTable(DEFAULT_TT_MB),
+	}
+	InitBoard(&e.board)
+	return e
+}
+
+func (e *engine) send(format string, args ...interface{}) {
+	e.out.Lock()
+	defer e.out.Unlock()
+	fmt.Printf(format+"\n", args...)
+}
+
+func main() {
+	e := newEngine()
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // position commands from long games get big
+
+	for scanner.Scan() {
+		if !e.handle(strings.Fields(scanner.Text())) {
+			break
+		}
+	}
+	e.stopSearch()
+}
+
+// runs one command, returns false once the engine should exit
+func (e *engine) handle(fields []string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "uci":
+		e.send("id name %s", ENGINE_NAME)
+		e.send("id author %s", ENGINE_AUTHOR)
+		names := make([]string, 0, len(e.options))
+		for name := range e.options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			opt := e.options[name]
+			if opt.kind == "spin" {
+				e.send("option name %s type spin default %s min %d max %d", name, opt.value, opt.min, opt.max)
+			} else if opt.kind == "string" && opt.value == "" {
+				e.send("option name %s type string default <empty>", name)
+			} else {
+				e.send("option name %s type %s default %s", name, opt.kind, opt.value)
+			}
+		}
+		e.send("uciok")
+
+	case "isready":
+		e.send("readyok")
+
+	case "ucinewgame":
+		e.stopSearch()
+		InitBoard(&e.board)
+		e.tt.Clear()
+
+	case "position":
+		e.stopSearch()
+		if err := e.setPosition(fields[1:]); err != nil {
+			e.send("info string %v", err)
+		}
+
+	case "go":
+		e.stopSearch()
+		e.startSearch(parseLimits(fields[1:]))
+
+	case "stop":
+		e.stopSearch()
+
+	case "setoption":
+		e.stopSearch()
+		if err := e.setOption(fields[1:]); err != nil {
+			e.send("info string %v", err)
+		}
+
+	case "d":
+		e.send("info string %s", GetFEN(&e.board))
+
+	case "eval":
+		e.stopSearch()
+		e.printTrace(TraceEvaluate(&e.board))
+
+	case "quit":
+		return false
+
+	default:
+		e.send("info string unknown command %s", fields[0])
+	}
+
+	return true
+}
+
+// =================================== POSITION ===================================
+// position [startpos | fen <fen>] [moves <move>...]
+func (e *engine) setPosition(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("position needs startpos or fen")
+	}
+
+	movesAt := len(args)
+	for i, arg := range args {
+		if arg == "moves" {
+			movesAt = i
+			break
+		}
+	}
+
+	var board Bitboard
+	switch args[0] {
+	case "startpos":
+		InitBoard(&board)
+	case "fen":
+		if err := InitBoardFromFEN(&board, strings.Join(args[1:movesAt], " ")); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("position needs startpos or fen, not %s", args[0])
+	}
+
+	if movesAt < len(args) {
+		for _, text := range args[movesAt+1:] {
+			move, err := ParseUCIMove(text, &board)
+			if err != nil {
+				return err
+			}
+			MakeMove(move, &board)
+		}
+	}
+
+	e.board = board
+	return nil
+}
+
+// =================================== OPTIONS ===================================
+// setoption name <name> [value <value>]
+func (e *engine) setOption(args []string) error {
+	valueAt := len(args)
+	for i, arg := range args {
+		if arg == "value" {
+			valueAt = i
+			break
+		}
+	}
+	if len(args) < 2 || args[0] != "name" {
+		return fmt.Errorf("setoption needs a name")
+	}
+
+	name := strings.Join(args[1:valueAt], " ")
+	value := ""
+	if valueAt < len(args) {
+		value = strings.Join(args[valueAt+1:], " ")
+	}
+
+	for known, opt := range e.options {
+		if !strings.EqualFold(known, name) {
+			continue
+		}
+		if opt.kind == "spin" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < opt.min || n > opt.max {
+				return fmt.Errorf("%s has to be between %d and %d", known, opt.min, opt.max)
+			}
+		}
+		if opt.kind == "check" {
+			if value != "true" && value != "false" {
+				return fmt.Errorf("%s has to be true or false", known)
+			}
+		}
+		if value == "<empty>" {
+			value = ""
+		}
+		if known == "EvalFile" && value != "" {
+			if err := LoadParamsFile(value); err != nil {
+				return err
+			}
+		}
+		if known == "BookFile" {
+			e.book = nil
+			if value != "" {
+				book, err := LoadBook(value)
+				if err != nil {
+					return err
+				}
+				e.book = book
+			}
+		}
+		if known == "SyzygyPath" {
+			e.tb = nil
+			if value != "" {
+				tb, err := OpenTablebase(value)
+				if err != nil {
+					return err
+				}
+				e.tb = tb
+			}
+		}
+		opt.value = value
+		if known == "Hash" {
+			e.tt.Resize(e.intOption("Hash"))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown option %s", name)
+}
+
+func (e *engine) boolOption(name string) bool {
+	return e.options[name].value == "true"
+}
+
+func (e *engine) searchFeatures() *SearchFeatures {
+	return &SearchFeatures{
+		PVS:             e.boolOption("PVS"),
+		Aspiration:      e.boolOption("AspirationWindows"),
+		NullMove:        e.boolOption("NullMove"),
+		LMR:             e.boolOption("LMR"),
+		Futility:        e.boolOption("Futility"),
+		ReverseFutility: e.boolOption("ReverseFutility"),
+		CheckExtensions: e.boolOption("CheckExtensions"),
+	}
+}
+
+// the book with the current settings, nil if there's none or OwnBook is off
+func (e *engine) openingBook() *Book {
+	if e.book == nil || !e.boolOption("OwnBook") {
+		return nil
+	}
+	e.book.Depth, e.book.Best = e.intOption("BookDepth"), e.boolOption("BestBookMove")
+	return e.book
+}
+
+func (e *engine) intOption(name string) int {
+	n, _ := strconv.Atoi(e.options[name].value)
+	return n
+}
+
+// =================================== SEARCH ===================================
+func parseLimits(args []string) searchLimits {
+	var limits searchLimits
+
+	for i := 0; i < len(args); i++ {
+		next := func() int {
+			if i+1 >= len(args) {
+				return 0
+			}
+			i++
+			n, _ := strconv.Atoi(args[i])
+			return n
+		}
+
+		switch args[i] {
+		case "depth":
+			limits.depth = next()
+		case "movetime":
+			limits.movetime = time.Duration(next()) * time.Millisecond
+		case "wtime":
+			limits.wtime = time.Duration(next()) * time.Millisecond
+		case "btime":
+			limits.btime = time.Duration(next()) * time.Millisecond
+		case "winc":
+			limits.winc = time.Duration(next()) * time.Millisecond
+		case "binc":
+			limits.binc = time.Duration(next()) * time.Millisecond
+		case "movestogo":
+			limits.movesToGo = next()
+		case "infinite":
+			limits.infinite = true
+		}
+	}
+
+	return limits
+}
+
+// the clock that matters is the one of the side to move
+func (e *engine) searchLimits(limits searchLimits) SearchLimits {
+	search := SearchLimits{Depth: limits.depth, MoveTime: limits.movetime, MovesToGo: limits.movesToGo}
+	if IsWhiteTurn(&e.board) {
+		search.Remaining, search.Increment = limits.wtime, limits.winc
+	} else {
+		search.Remaining, search.Increment = limits.btime, limits.binc
+	}
+
+	// with nothing to go on, search to the configured depth
+	if search.Depth <= 0 && search.MoveTime <= 0 && search.Remaining <= 0 && !limits.infinite {
+		search.Depth = e.intOption("Depth")
+	}
+	return search
+}
+
+func (e *engine) startSearch(limits searchLimits) {
+	board := CopyBitboard(&e.board)
+	options := SearchOptions{TT: e.tt, Features: e.searchFeatures(), Threads: e.intOption("Threads"), Book: e.openingBook(), Tablebase: e.tb}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.searching.Add(1)
+
+	go func() {
+		defer e.searching.Done()
+		start := time.Now()
+
+		result := SkillAI_move(ctx, &board, IsWhiteTurn(&board), e.intOption("Skill Level"), e.searchLimits(limits), options, func(result SearchResult) {
+			info := fmt.Sprintf("info depth %d score %s nodes %d time %d hashfull %d", result.Depth, uciScore(result.Score), result.Nodes, time.Since(start).Milliseconds(), e.tt.Hashfull())
+			if len(result.PV) > 0 {
+				pv := make([]string, len(result.PV))
+				for i, move := range result.PV {
+					pv[i] = MoveToUCI(move)
+				}
+				info += " pv " + strings.Join(pv, " ")
+			}
+			e.send("%s", info)
+		})
+
+		if result.Book {
+			e.send("info string book move")
+		}
+
+		// an infinite search has to wait for stop before it answers
+		if limits.infinite {
+			<-ctx.Done()
+		}
+		e.send("bestmove %s", MoveToUCI(result.Move))
+	}()
+}
+
+// eval isn't part of UCI, it's for people at the command line. Every term is in centipawns
+// from white's point of view
+func (e *engine) printTrace(trace EvalTrace) {
+	e.send("%-16s %13s %13s %13s", "term", "white mg eg", "black mg eg", "total")
+	for _, term := range trace.Terms {
+		e.send("%-16s %6d %6d %6d %6d %13d", term.Name, term.White.MG, term.White.EG, term.Black.MG, term.Black.EG, term.Score)
+	}
+	e.send("phase %d/%d, mg %d, eg %d, score %d", trace.Phase, TOTAL_PHASE, trace.MG, trace.EG, trace.Score)
+}
+
+// scores go out in centipawns, or as the number of moves to mate
+func uciScore(score int32) string {
+	if IsMateScore(score) {
+		return fmt.Sprintf("mate %d", MateIn(score))
+	}
+	return fmt.Sprintf("cp %d", score)
+}
+
+func (e *engine) stopSearch() {
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	e.searching.Wait()
+}
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"server/pgn"
 	. "server/utils"
 
 	"github.com/gin-gonic/gin"
@@ -10,8 +19,15 @@ import (
 )
 
 type MoveRes struct {
-	File uint8 `json:"File"`
-	Rank uint8 `json:"Rank"`
+	File       uint8    `json:"File"`
+	Rank       uint8    `json:"Rank"`
+	Promotions []string `json:"Promotions,omitempty"` // what the pawn can promote to on this square, best first
+}
+
+type PlaceRes struct {
+	Board  [8][8]string `json:"board"`
+	Status GameState    `json:"status"`
+	San    string       `json:"san,omitempty"` // the move that was just played
 }
 
 var PieceMap = map[string]uint8{
@@ -31,6 +47,24 @@ var PieceMap = map[string]uint8{
 
 var bitboard Bitboard
 
+// gin serves requests concurrently, so every handler that reads or changes the shared board holds this
+var boardLock sync.Mutex
+
+// the tags of the last uploaded PGN, so downloading the game again keeps them
+var pgnTags []pgn.Tag
+
+// shared by every /ai search, it's only touched while boardLock is held
+var transpositionTable *TranspositionTable
+
+// how many goroutines an /ai search runs on
+var searchThreads int
+
+// the polyglot book /ai plays from before it searches, nil without -book
+var openingBook *Book
+
+// the Syzygy tables /ai probes in endgames, nil without -syzygy
+var tablebase *Tablebase
+
 func positionFromRowCol(row uint8, col uint8) uint64 {
 	p := uint64(1) << 63
 	p = p >> (8 * row)
@@ -64,55 +98,334 @@ func Moves(context *gin.Context) {
 	}
 
 	intPos := positionFromRowCol(move.Rank, move.File)
+
+	boardLock.Lock()
 	validMoves := GetValidMoves(PieceMap[move.Piece], intPos, &bitboard)
+	boardLock.Unlock()
 
 	moveList := make([]MoveRes, len(validMoves))
 	for i, pos := range validMoves {
 		row, col := rowColFromPosition(pos)
 		moveList[i] = MoveRes{Rank: row, File: col}
+		if PieceMap[move.Piece]&0x1 != 0 && pos&(RANK_1|RANK_8) != 0 {
+			for _, promotion := range PROMOTION_PIECES {
+				moveList[i].Promotions = append(moveList[i].Promotions, PromotionLetter(promotion))
+			}
+		}
 	}
 
 	context.IndentedJSON(http.StatusOK, moveList)
 }
 
+// sets the shared board up from a FEN, or the starting position if no FEN is given
 func GenerateBoard(context *gin.Context) {
-	var fen string
-	if err := context.BindJSON(&fen); err != nil {
+	var request struct {
+		Fen string `json:"fen"`
+	}
+	if err := context.ShouldBindJSON(&request); err != nil {
 		fmt.Println("Invalid request body")
 		fmt.Println(err)
+		context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_body", Message: "Invalid request body"})
 		return
 	}
-	context.IndentedJSON(http.StatusOK, "Board generated")
+
+	if request.Fen == "" {
+		request.Fen = STARTING_FEN
+	}
+
+	boardLock.Lock()
+	defer boardLock.Unlock()
+
+	if err := InitBoardFromFEN(&bitboard, request.Fen); err != nil {
+		context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_fen", Message: err.Error()})
+		return
+	}
+	pgnTags = nil
+
+	context.IndentedJSON(http.StatusOK, PlaceRes{
+		Board:  GetBoardState(&bitboard),
+		Status: GetGameState(&bitboard),
+	})
 }
 
+func Fen(context *gin.Context) {
+	boardLock.Lock()
+	defer boardLock.Unlock()
+
+	context.IndentedJSON(http.StatusOK, gin.H{"fen": GetFEN(&bitboard)})
+}
+
+// malformed requests are a 400, moves that are well formed but break the rules are a 422
+func moveErrorStatus(err *MoveError) int {
+	switch err.Code {
+	case MOVE_ERR_UNKNOWN_PIECE, MOVE_ERR_OFF_BOARD, MOVE_ERR_INVALID_SAN, MOVE_ERR_INVALID_PROMOTION:
+		return http.StatusBadRequest
+	case MOVE_ERR_GAME_OVER:
+		return http.StatusConflict
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// plays a move on the shared board. The move is either given as SAN ({"san": "Nf3"}) or
+// as the piece with the square it starts on and the square it goes to, plus what a pawn promotes to
 func MovePiece(context *gin.Context) {
-	var move struct {
+	var request struct {
+		San     string `json:"san"`
 		Piece   string `json:"Piece"`
 		File    uint8  `json:"File"`
 		Rank    uint8  `json:"Rank"`
 		NewFile uint8  `json:"NewFile"`
 		NewRank uint8  `json:"NewRank"`
+
+		Promotion string `json:"Promotion"` // q, r, b or n, a queen if it's left out
 	}
 
-	if err := context.BindJSON(&move); err != nil {
+	if err := context.ShouldBindJSON(&request); err != nil {
 		fmt.Println("Invalid request body")
 		fmt.Println(err)
-		context.IndentedJSON(http.StatusBadRequest, "Invalid request body")
+		context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_body", Message: "Invalid request body"})
 		return
 	}
 
-	intPos := positionFromRowCol(move.Rank, move.File)
-	newPos := positionFromRowCol(move.NewRank, move.NewFile)
+	boardLock.Lock()
+	defer boardLock.Unlock()
+
+	if state := GetGameState(&bitboard); state.IsOver() {
+		context.IndentedJSON(http.StatusConflict, MoveError{Code: MOVE_ERR_GAME_OVER, Message: "the game is over: " + state.Message})
+		return
+	}
+
+	// nothing below touches the board until the move has been fully validated
+	move, err := requestedMove(request.San, request.Piece, request.Rank, request.File, request.NewRank, request.NewFile, request.Promotion)
+	if err != nil {
+		moveErr := err.(*MoveError)
+		context.IndentedJSON(moveErrorStatus(moveErr), moveErr)
+		return
+	}
+
+	san := FormatSAN(move, &bitboard, true)
+	MakeMove(move, &bitboard)
+	PrintGame(&bitboard)
+
+	context.IndentedJSON(http.StatusOK, PlaceRes{
+		Board:  GetBoardState(&bitboard),
+		Status: GetGameState(&bitboard),
+		San:    san,
+	})
+}
 
-	pieceType := PieceMap[move.Piece]
+// works out which move a /place request is asking for, the board lock has to be held
+func requestedMove(san string, piece string, rank uint8, file uint8, newRank uint8, newFile uint8, promotionLetter string) (Move, error) {
+	if san != "" {
+		return ParseSAN(san, &bitboard)
+	}
+
+	pieceType, ok := PieceMap[piece]
+	if !ok {
+		return NO_MOVE, &MoveError{Code: MOVE_ERR_UNKNOWN_PIECE, Message: "unknown piece " + piece}
+	}
+
+	from, to := positionFromRowCol(rank, file), positionFromRowCol(newRank, newFile)
+	if err := ValidateMove(pieceType, from, to, &bitboard); err != nil {
+		return NO_MOVE, err
+	}
+	promotion, err := ParsePromotion(promotionLetter, pieceType, to)
+	if err != nil {
+		return NO_MOVE, err
+	}
+	return BuildMove(pieceType, from, to, promotion, &bitboard), nil
+}
 
-	MakeMove(pieceType, intPos, newPos, &bitboard)
-	board := GetBoardState(&bitboard)
+func Status(context *gin.Context) {
+	boardLock.Lock()
+	defer boardLock.Unlock()
 
-	context.IndentedJSON(http.StatusOK, board)
+	context.IndentedJSON(http.StatusOK, GetGameState(&bitboard))
+}
+
+// how the engine sees the current position, term by term
+func Eval(context *gin.Context) {
+	boardLock.Lock()
+	defer boardLock.Unlock()
+
+	context.IndentedJSON(http.StatusOK, TraceEvaluate(&bitboard))
+}
+
+// downloads everything played on the board as a PGN file
+func DownloadPGN(context *gin.Context) {
+	boardLock.Lock()
+	game, err := pgn.FromBoard(&bitboard, pgnTags)
+	boardLock.Unlock()
+
+	if err != nil {
+		context.IndentedJSON(http.StatusInternalServerError, MoveError{Code: "pgn_export_failed", Message: err.Error()})
+		return
+	}
+
+	context.Header("Content-Disposition", `attachment; filename="game.pgn"`)
+	context.Data(http.StatusOK, "application/x-chess-pgn", []byte(game.String()))
+}
+
+// replaces the board with the main line of the first game in the uploaded PGN.
+// The PGN can be sent as the raw request body or as a "pgn" file in a multipart form
+func UploadPGN(context *gin.Context) {
+	var text []byte
+	var err error
+	if context.ContentType() == "multipart/form-data" {
+		var file *multipart.FileHeader
+		var opened multipart.File
+		if file, err = context.FormFile("pgn"); err == nil {
+			if opened, err = file.Open(); err == nil {
+				text, err = io.ReadAll(opened)
+				opened.Close()
+			}
+		}
+	} else {
+		text, err = io.ReadAll(context.Request.Body)
+	}
+	if err != nil {
+		context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_body", Message: err.Error()})
+		return
+	}
+
+	games, err := pgn.Parse(string(text))
+	if err != nil {
+		context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_pgn", Message: err.Error()})
+		return
+	}
+	if len(games) == 0 {
+		context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_pgn", Message: "the PGN has no games in it"})
+		return
+	}
+
+	boardLock.Lock()
+	defer boardLock.Unlock()
+
+	if err := pgn.Replay(&games[0], &bitboard); err != nil {
+		context.IndentedJSON(http.StatusUnprocessableEntity, MoveError{Code: "invalid_pgn", Message: err.Error()})
+		return
+	}
+	pgnTags = games[0].Tags
+
+	context.IndentedJSON(http.StatusOK, PlaceRes{
+		Board:  GetBoardState(&bitboard),
+		Status: GetGameState(&bitboard),
+	})
+}
+
+type AIRes struct {
+	PlaceRes
+	Score int32    `json:"score"` // centipawns for the side that moved, positive is good for it
+	Mate  int      `json:"mate,omitempty"`
+	PV    []string `json:"pv"`
+	Depth int      `json:"depth"`
+	Nodes uint64   `json:"nodes"`
+	Book  bool     `json:"book,omitempty"` // the move came out of the opening book
+}
+
+const (
+	DEFAULT_AI_DEPTH = 4
+	MAX_AI_DEPTH     = 8
+	MAX_AI_MOVETIME  = 30 * time.Second
+)
+
+// the engine plays a move for whoever is to move
+func AIMove(context *gin.Context) {
+	var request struct {
+		Depth    int  `json:"depth"`
+		MoveTime int  `json:"movetime"` // milliseconds, the search deepens until it runs out
+		Skill    *int `json:"skill"`    // 0 (random moves) to 20 (full strength), full strength if it's left out
+	}
+	if context.Request.ContentLength > 0 {
+		if err := context.ShouldBindJSON(&request); err != nil {
+			context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_body", Message: "Invalid request body"})
+			return
+		}
+	}
+	skill := MAX_SKILL_LEVEL
+	if request.Skill != nil {
+		if *request.Skill < 0 || *request.Skill > MAX_SKILL_LEVEL {
+			context.IndentedJSON(http.StatusBadRequest, MoveError{Code: "invalid_skill", Message: fmt.Sprintf("skill has to be between 0 and %d", MAX_SKILL_LEVEL)})
+			return
+		}
+		skill = *request.Skill
+	}
+	limits := SearchLimits{Depth: request.Depth, MoveTime: time.Duration(request.MoveTime) * time.Millisecond}
+	if limits.MoveTime > MAX_AI_MOVETIME {
+		limits.MoveTime = MAX_AI_MOVETIME
+	}
+	if limits.Depth <= 0 && limits.MoveTime <= 0 {
+		limits.Depth = DEFAULT_AI_DEPTH
+	}
+	if limits.MoveTime <= 0 && limits.Depth > MAX_AI_DEPTH {
+		limits.Depth = MAX_AI_DEPTH // without a time limit a deep search could hold the board for minutes
+	}
+
+	boardLock.Lock()
+	defer boardLock.Unlock()
+
+	if state := GetGameState(&bitboard); state.IsOver() {
+		context.IndentedJSON(http.StatusConflict, MoveError{Code: MOVE_ERR_GAME_OVER, Message: "the game is over: " + state.Message})
+		return
+	}
+
+	// a client that goes away takes the search with it
+	result := SkillAI_move(context.Request.Context(), &bitboard, IsWhiteTurn(&bitboard), skill, limits, SearchOptions{TT: transpositionTable, Threads: searchThreads, Book: openingBook, Tablebase: tablebase}, nil)
+	if context.Request.Context().Err() != nil {
+		return // nobody is waiting for the move, so it isn't played either
+	}
+	res := AIRes{Score: result.Score, Depth: result.Depth, Nodes: result.Nodes, Book: result.Book}
+	if IsMateScore(result.Score) {
+		res.Score, res.Mate = 0, MateIn(result.Score)
+	}
+
+	// the pv is written out before the move is played since SAN depends on the position
+	replay := CopyBitboard(&bitboard)
+	for _, move := range result.PV {
+		res.PV = append(res.PV, MoveToSAN(move, &replay))
+		MakeMove(move, &replay)
+	}
+
+	res.San = FormatSAN(result.Move, &bitboard, true)
+	MakeMove(result.Move, &bitboard)
+	PrintGame(&bitboard)
+
+	res.Board = GetBoardState(&bitboard)
+	res.Status = GetGameState(&bitboard)
+	context.IndentedJSON(http.StatusOK, res)
 }
 
 func main() {
+	hashMB := flag.Int("hash", DEFAULT_TT_MB, "transposition table size in MB")
+	evalFile := flag.String("eval", "", "tuned evaluation parameters written by the tune command")
+	flag.IntVar(&searchThreads, "threads", runtime.NumCPU(), "how many threads the engine searches with")
+	bookFile := flag.String("book", "", "polyglot opening book to play from")
+	bookDepth := flag.Int("book-depth", DEFAULT_BOOK_DEPTH, "how many plies into the game the book is used, 0 for as long as it has moves")
+	bookBest := flag.Bool("book-best", false, "always play the book move with the most weight instead of picking by weight")
+	syzygyPath := flag.String("syzygy", "", "directories with Syzygy tablebases, separated the way PATH is")
+	flag.Parse()
+	transpositionTable = NewTranspositionTable(*hashMB)
+	if *evalFile != "" {
+		if err := LoadParamsFile(*evalFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *bookFile != "" {
+		book, err := LoadBook(*bookFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		book.Depth, book.Best = *bookDepth, *bookBest
+		openingBook = book
+	}
+	if *syzygyPath != "" {
+		tb, err := OpenTablebase(*syzygyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tablebase = tb
+	}
 
 	InitBoard(&bitboard)
 	PrintGame(&bitboard)
@@ -128,7 +441,13 @@ func main() {
 
 	router.POST("/moves", Moves)
 	router.POST("/place", MovePiece)
-	//router.POST("initboard", GenerateBoard)
+	router.POST("/ai", AIMove)
+	router.GET("/status", Status)
+	router.GET("/eval", Eval)
+	router.POST("/initboard", GenerateBoard)
+	router.GET("/fen", Fen)
+	router.GET("/pgn", DownloadPGN)
+	router.POST("/pgn", UploadPGN)
 
 	handler := cors.Default().Handler(router)
 
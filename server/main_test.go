@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// posts body to /place on the shared board and returns the status and the error code, if any
+func place(t *testing.T, body map[string]any) (int, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	context, _ := gin.CreateTestContext(recorder)
+	context.Request = httptest.NewRequest(http.MethodPost, "/place", bytes.NewReader(data))
+	context.Request.Header.Set("Content-Type", "application/json")
+	MovePiece(context)
+
+	var moveErr MoveError
+	json.Unmarshal(recorder.Body.Bytes(), &moveErr)
+	return recorder.Code, moveErr.Code
+}
+
+// a square for a /place request, rank and file counted from 0 on white's side
+func square(name string) (uint8, uint8) {
+	return name[1] - '1', name[0] - 'a'
+}
+
+func pieceMove(piece string, from string, to string, promotion string) map[string]any {
+	rank, file := square(from)
+	newRank, newFile := square(to)
+	return map[string]any{"Piece": piece, "Rank": rank, "File": file, "NewRank": newRank, "NewFile": newFile, "Promotion": promotion}
+}
+
+// a move /place turns down has to leave the board, its hash and its history exactly as they were
+func TestPlaceRejectsMoves(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		body   map[string]any
+		status int
+		code   string
+	}{
+		{"unknown piece", STARTING_FEN, pieceMove("wx", "e2", "e4", ""), http.StatusBadRequest, MOVE_ERR_UNKNOWN_PIECE},
+		{"empty square", STARTING_FEN, pieceMove("wp", "e4", "e5", ""), http.StatusUnprocessableEntity, MOVE_ERR_EMPTY_SQUARE},
+		{"wrong piece", STARTING_FEN, pieceMove("wq", "e2", "e4", ""), http.StatusUnprocessableEntity, MOVE_ERR_PIECE_MISMATCH},
+		{"wrong turn", STARTING_FEN, pieceMove("bp", "e7", "e5", ""), http.StatusUnprocessableEntity, MOVE_ERR_WRONG_TURN},
+		{"illegal", STARTING_FEN, pieceMove("wn", "b1", "b3", ""), http.StatusUnprocessableEntity, MOVE_ERR_ILLEGAL},
+		{"pinned", "4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", pieceMove("wn", "e2", "c3", ""), http.StatusUnprocessableEntity, MOVE_ERR_ILLEGAL},
+		{"promotion that isn't one", STARTING_FEN, pieceMove("wp", "e2", "e4", "q"), http.StatusBadRequest, MOVE_ERR_INVALID_PROMOTION},
+		{"promotion to a king", "4k3/P7/8/8/8/8/8/4K3 w - - 0 1", pieceMove("wp", "a7", "a8", "k"), http.StatusBadRequest, MOVE_ERR_INVALID_PROMOTION},
+		{"bad SAN", STARTING_FEN, map[string]any{"san": "Qh9"}, http.StatusBadRequest, MOVE_ERR_INVALID_SAN},
+		{"illegal SAN", STARTING_FEN, map[string]any{"san": "Qh5"}, http.StatusUnprocessableEntity, MOVE_ERR_ILLEGAL},
+		{"game over", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", pieceMove("wp", "e2", "e4", ""), http.StatusConflict, MOVE_ERR_GAME_OVER},
+	}
+
+	for _, test := range tests {
+		if err := InitBoardFromFEN(&bitboard, test.fen); err != nil {
+			t.Fatal(err)
+		}
+		if test.fen == STARTING_FEN {
+			playUCI(t, "g1f3", "g8f6", "f3g1", "f6g8") // some history, which has to survive too
+		}
+		fen, hash, history := GetFEN(&bitboard), GetHash(&bitboard), len(GetMoveHistory(&bitboard))
+
+		status, code := place(t, test.body)
+		if status != test.status || code != test.code {
+			t.Errorf("%s: %d %q, want %d %q", test.name, status, code, test.status, test.code)
+		}
+		if GetFEN(&bitboard) != fen || GetHash(&bitboard) != hash || len(GetMoveHistory(&bitboard)) != history {
+			t.Errorf("%s: the board changed to %s", test.name, GetFEN(&bitboard))
+		}
+	}
+}
+
+func TestPlacePlaysMoves(t *testing.T) {
+	if err := InitBoardFromFEN(&bitboard, STARTING_FEN); err != nil {
+		t.Fatal(err)
+	}
+	if status, code := place(t, pieceMove("wp", "e2", "e4", "")); status != http.StatusOK {
+		t.Fatalf("e2e4: %d %q", status, code)
+	}
+	if status, code := place(t, map[string]any{"san": "e5"}); status != http.StatusOK {
+		t.Fatalf("e5: %d %q", status, code)
+	}
+	if fen := GetFEN(&bitboard); fen != "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2" {
+		t.Errorf("played to %s", fen)
+	}
+}
+
+func playUCI(t *testing.T, moves ...string) {
+	t.Helper()
+	for _, text := range moves {
+		move, err := ParseUCIMove(text, &bitboard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		MakeMove(move, &bitboard)
+	}
+}
@@ -0,0 +1,315 @@
+package pgn
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+
+  . "server/utils"
+)
+
+// =================================== TOKENIZER ===================================
+const (
+  tokenSymbol = iota // SAN, move numbers and results
+  tokenString
+  tokenComment
+  tokenNag
+  tokenOpenTag
+  tokenCloseTag
+  tokenOpenVariation
+  tokenCloseVariation
+  tokenResult
+)
+
+type token struct {
+  kind int
+  text string
+  line int
+}
+
+// the traditional suffix annotations and the NAGs they stand for
+var SUFFIX_TO_NAG = map[string]int{
+  "!": 1,
+  "?": 2,
+  "!!": 3,
+  "??": 4,
+  "!?": 5,
+  "?!": 6,
+}
+
+// what some writers put after an en passant capture, with or without a space: exd6 e.p.
+const EN_PASSANT_MARK = "e.p."
+
+func isSymbolChar(c byte) bool {
+  return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("_+#=:-/", c) >= 0
+}
+
+func tokenize(text string) ([]token, error) {
+  var tokens []token
+  line := 1
+
+  for i := 0; i < len(text); {
+    c := text[i]
+    switch {
+    case c == '\n':
+      line++
+      i++
+      // a % in the first column escapes the rest of the line
+      if i < len(text) && text[i] == '%' {
+        for i < len(text) && text[i] != '\n' {
+          i++
+        }
+      }
+
+    case c == ' ' || c == '\t' || c == '\r' || c == '.':
+      i++
+
+    case c == '%' && i == 0:
+      for i < len(text) && text[i] != '\n' {
+        i++
+      }
+
+    case c == '[':
+      tokens = append(tokens, token{ tokenOpenTag, "[", line })
+      i++
+
+    case c == ']':
+      tokens = append(tokens, token{ tokenCloseTag, "]", line })
+      i++
+
+    case c == '(':
+      tokens = append(tokens, token{ tokenOpenVariation, "(", line })
+      i++
+
+    case c == ')':
+      tokens = append(tokens, token{ tokenCloseVariation, ")", line })
+      i++
+
+    case c == '*':
+      tokens = append(tokens, token{ tokenResult, "*", line })
+      i++
+
+    case c == '"':
+      var value strings.Builder
+      i++
+      for i < len(text) && text[i] != '"' {
+        if text[i] == '\\' && i + 1 < len(text) {
+          i++
+        }
+        value.WriteByte(text[i])
+        i++
+      }
+      if i >= len(text) {
+        return nil, fmt.Errorf("line %d: unterminated string", line)
+      }
+      i++
+      tokens = append(tokens, token{ tokenString, value.String(), line })
+
+    case c == '{':
+      end := strings.IndexByte(text[i:], '}')
+      if end < 0 {
+        return nil, fmt.Errorf("line %d: unterminated comment", line)
+      }
+      comment := text[i + 1 : i + end]
+      tokens = append(tokens, token{ tokenComment, strings.TrimSpace(comment), line })
+      line += strings.Count(comment, "\n")
+      i += end + 1
+
+    case c == ';':
+      end := strings.IndexByte(text[i:], '\n')
+      if end < 0 {
+        end = len(text) - i
+      }
+      tokens = append(tokens, token{ tokenComment, strings.TrimSpace(text[i + 1 : i + end]), line })
+      i += end
+
+    case c == '$':
+      start := i + 1
+      i++
+      for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+        i++
+      }
+      if start == i {
+        return nil, fmt.Errorf("line %d: $ without a number", line)
+      }
+      tokens = append(tokens, token{ tokenNag, text[start:i], line })
+
+    case c == '!' || c == '?':
+      start := i
+      for i < len(text) && (text[i] == '!' || text[i] == '?') {
+        i++
+      }
+      nag, ok := SUFFIX_TO_NAG[text[start:i]]
+      if !ok {
+        return nil, fmt.Errorf("line %d: unknown annotation %q", line, text[start:i])
+      }
+      tokens = append(tokens, token{ tokenNag, strconv.Itoa(nag), line })
+
+    case strings.HasPrefix(text[i:], EN_PASSANT_MARK):
+      // the dots would otherwise be skipped and leave an e and a p behind, and the move says it all anyway
+      i += len(EN_PASSANT_MARK)
+
+    case isSymbolChar(c):
+      start := i
+      for i < len(text) && isSymbolChar(text[i]) && !strings.HasPrefix(text[i:], EN_PASSANT_MARK) {
+        i++
+      }
+      symbol := text[start:i]
+      switch symbol {
+      case RESULT_WHITE_WINS, RESULT_BLACK_WINS, RESULT_DRAW:
+        tokens = append(tokens, token{ tokenResult, symbol, line })
+      default:
+        // move numbers carry no information, the dots after them are skipped above
+        if _, err := strconv.Atoi(symbol); err != nil {
+          tokens = append(tokens, token{ tokenSymbol, symbol, line })
+        }
+      }
+
+    default:
+      return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+    }
+  }
+
+  return tokens, nil
+}
+
+// =================================== PARSER ===================================
+type parser struct {
+  tokens []token
+  position int
+}
+
+func (p *parser) peek() *token {
+  if p.position >= len(p.tokens) {
+    return nil
+  }
+  return &p.tokens[p.position]
+}
+
+func (p *parser) next() *token {
+  t := p.peek()
+  if t != nil {
+    p.position++
+  }
+  return t
+}
+
+// reads every game in the text. Comments, NAGs and variations are kept on the move they follow
+func Parse(text string) ([]Game, error) {
+  tokens, err := tokenize(text)
+  if err != nil {
+    return nil, err
+  }
+
+  p := parser{ tokens: tokens }
+  var games []Game
+  for p.peek() != nil {
+    game, err := p.parseGame()
+    if err != nil {
+      return games, err
+    }
+    games = append(games, game)
+  }
+
+  return games, nil
+}
+
+func (p *parser) parseGame() (Game, error) {
+  var game Game
+
+  // ================= tag pairs =================
+  for t := p.peek(); t != nil && t.kind == tokenOpenTag; t = p.peek() {
+    p.next()
+    name, value, end := p.next(), p.next(), p.next()
+    if name == nil || value == nil || end == nil || name.kind != tokenSymbol || value.kind != tokenString || end.kind != tokenCloseTag {
+      return game, fmt.Errorf("line %d: malformed tag pair", t.line)
+    }
+    game.Tags = append(game.Tags, Tag{ name.text, value.text })
+  }
+
+  for t := p.peek(); t != nil && t.kind == tokenComment; t = p.peek() {
+    game.Comments = append(game.Comments, p.next().text)
+  }
+
+  // ================= movetext =================
+  moves, err := p.parseMoves(0)
+  if err != nil {
+    return game, err
+  }
+  game.Moves = moves
+
+  if t := p.peek(); t != nil && t.kind == tokenResult {
+    game.Result = p.next().text
+  } else if value, ok := game.GetTag("Result"); ok {
+    game.Result = value
+  } else {
+    game.Result = RESULT_ONGOING
+  }
+
+  return game, nil
+}
+
+// reads moves until the end of the game, or the end of the variation when depth > 0
+func (p *parser) parseMoves(depth int) ([]MoveNode, error) {
+  var moves []MoveNode
+
+  for {
+    t := p.peek()
+    if depth > 0 && (t == nil || t.kind == tokenOpenTag) {
+      return nil, fmt.Errorf("variation is never closed")
+    }
+    if t == nil || t.kind == tokenOpenTag {
+      return moves, nil
+    }
+    if t.kind == tokenResult {
+      if depth == 0 {
+        return moves, nil
+      }
+      // some programs put a result at the end of a variation, it doesn't mean anything there
+      p.next()
+      continue
+    }
+
+    switch t.kind {
+    case tokenSymbol:
+      p.next()
+      moves = append(moves, MoveNode{ San: t.text })
+
+    case tokenNag, tokenComment:
+      p.next()
+      if len(moves) == 0 {
+        // only happens at the start of a variation, there's nothing to hang it on
+        continue
+      }
+      last := &moves[len(moves) - 1]
+      if t.kind == tokenNag {
+        nag, _ := strconv.Atoi(t.text)
+        last.Nags = append(last.Nags, nag)
+      } else {
+        last.Comments = append(last.Comments, t.text)
+      }
+
+    case tokenOpenVariation:
+      p.next()
+      if len(moves) == 0 {
+        return nil, fmt.Errorf("line %d: variation before any move", t.line)
+      }
+      variation, err := p.parseMoves(depth + 1)
+      if err != nil {
+        return nil, err
+      }
+      last := &moves[len(moves) - 1]
+      last.Variations = append(last.Variations, variation)
+
+    case tokenCloseVariation:
+      if depth == 0 {
+        return nil, fmt.Errorf("line %d: ) without a matching (", t.line)
+      }
+      p.next()
+      return moves, nil
+
+    default:
+      return nil, fmt.Errorf("line %d: unexpected %q in movetext", t.line, t.text)
+    }
+  }
+}
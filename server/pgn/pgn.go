@@ -0,0 +1,225 @@
+package pgn
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+
+  . "server/utils"
+)
+
+// the seven tags every PGN game has to have, in the order they have to be written
+var SEVEN_TAG_ROSTER = []string{ "Event", "Site", "Date", "Round", "White", "Black", "Result" }
+
+var SEVEN_TAG_DEFAULTS = map[string]string{
+  "Event": "?",
+  "Site": "?",
+  "Date": "????.??.??",
+  "Round": "?",
+  "White": "?",
+  "Black": "?",
+  "Result": RESULT_ONGOING,
+}
+
+type Tag struct {
+  Name string `json:"name"`
+  Value string `json:"value"`
+}
+
+// one move of the movetext along with everything that was attached to it
+type MoveNode struct {
+  San string `json:"san"`
+  Nags []int `json:"nags,omitempty"`
+  Comments []string `json:"comments,omitempty"`
+  Variations [][]MoveNode `json:"variations,omitempty"` // alternatives to this move
+}
+
+type Game struct {
+  Tags []Tag `json:"tags"`
+  Comments []string `json:"comments,omitempty"` // comments before the first move
+  Moves []MoveNode `json:"moves"`
+  Result string `json:"result"`
+}
+
+func (game *Game) GetTag(name string) (string, bool) {
+  for _, tag := range game.Tags {
+    if tag.Name == name {
+      return tag.Value, true
+    }
+  }
+  return "", false
+}
+
+func (game *Game) SetTag(name string, value string) {
+  for i, tag := range game.Tags {
+    if tag.Name == name {
+      game.Tags[i].Value = value
+      return
+    }
+  }
+  game.Tags = append(game.Tags, Tag{ name, value })
+}
+
+// =================================== BOARD -> GAME ===================================
+// builds a game out of every move played on the board. Any tags passed in are kept,
+// the Seven Tag Roster is filled in with defaults and the result comes from the board
+func FromBoard(bitboard *Bitboard, tags []Tag) (Game, error) {
+  game := Game{ Tags: append([]Tag(nil), tags...) }
+  for _, name := range SEVEN_TAG_ROSTER {
+    if _, ok := game.GetTag(name); !ok {
+      game.SetTag(name, SEVEN_TAG_DEFAULTS[name])
+    }
+  }
+
+  startingFen := GetStartingFEN(bitboard)
+  if startingFen != STARTING_FEN {
+    game.SetTag("SetUp", "1")
+    game.SetTag("FEN", startingFen)
+  }
+
+  var replay Bitboard
+  if err := InitBoardFromFEN(&replay, startingFen); err != nil {
+    return game, err
+  }
+  for _, move := range GetMoveHistory(bitboard) {
+    game.Moves = append(game.Moves, MoveNode{ San: MoveToSAN(move, &replay) })
+    MakeMove(move, &replay)
+  }
+
+  game.Result = GetGameState(bitboard).Result
+  game.SetTag("Result", game.Result)
+  return game, nil
+}
+
+// =================================== GAME -> BOARD ===================================
+// plays the main line of the game onto the board. The board is only changed if every move is legal
+func Replay(game *Game, bitboard *Bitboard) error {
+  fen := STARTING_FEN
+  if tagFen, ok := game.GetTag("FEN"); ok {
+    fen = tagFen
+  }
+
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, fen); err != nil {
+    return fmt.Errorf("FEN tag: %v", err)
+  }
+
+  for i, node := range game.Moves {
+    move, err := ParseSAN(node.San, &board)
+    if err != nil {
+      return fmt.Errorf("ply %d: %v", i + 1, err)
+    }
+    MakeMove(move, &board)
+  }
+
+  *bitboard = board
+  return nil
+}
+
+// =================================== WRITING ===================================
+const MAX_LINE_LENGTH = 79
+
+func escapeTagValue(value string) string {
+  value = strings.ReplaceAll(value, "\\", "\\\\")
+  return strings.ReplaceAll(value, "\"", "\\\"")
+}
+
+// writes the game out in PGN export format
+func (game *Game) String() string {
+  var out strings.Builder
+
+  // the Seven Tag Roster always goes first and in order, anything else follows as it was given
+  for _, name := range SEVEN_TAG_ROSTER {
+    value, ok := game.GetTag(name)
+    if !ok {
+      value = SEVEN_TAG_DEFAULTS[name]
+    }
+    fmt.Fprintf(&out, "[%s \"%s\"]\n", name, escapeTagValue(value))
+  }
+  for _, tag := range game.Tags {
+    if _, ok := SEVEN_TAG_DEFAULTS[tag.Name]; !ok {
+      fmt.Fprintf(&out, "[%s \"%s\"]\n", tag.Name, escapeTagValue(tag.Value))
+    }
+  }
+  out.WriteString("\n")
+
+  moveNumber, whiteTurn := 1, true
+  if fen, ok := game.GetTag("FEN"); ok {
+    moveNumber, whiteTurn = startingMoveNumber(fen)
+  }
+
+  var tokens []string
+  for _, comment := range game.Comments {
+    tokens = append(tokens, "{" + comment + "}")
+  }
+  tokens = appendMoveTokens(tokens, game.Moves, moveNumber, whiteTurn)
+
+  result := game.Result
+  if result == "" {
+    result = RESULT_ONGOING
+  }
+  tokens = append(tokens, result)
+
+  lineLength := 0
+  for i, token := range tokens {
+    // variations are written as "(12. e4 e5)" so there's no space just inside the brackets
+    joined := i > 0 && (tokens[i - 1] == "(" || token == ")")
+    if lineLength > 0 && !joined && lineLength + 1 + len(token) > MAX_LINE_LENGTH {
+      out.WriteString("\n")
+      lineLength = 0
+    } else if lineLength > 0 && !joined {
+      out.WriteString(" ")
+      lineLength++
+    }
+    out.WriteString(token)
+    lineLength += len(token)
+  }
+  out.WriteString("\n\n")
+
+  return out.String()
+}
+
+func startingMoveNumber(fen string) (int, bool) {
+  fields := strings.Fields(fen)
+  whiteTurn := len(fields) < 2 || fields[1] != "b"
+  moveNumber := 1
+  if len(fields) > 5 {
+    if n, err := strconv.Atoi(fields[5]); err == nil && n > 0 {
+      moveNumber = n
+    }
+  }
+  return moveNumber, whiteTurn
+}
+
+func appendMoveTokens(tokens []string, moves []MoveNode, moveNumber int, whiteTurn bool) []string {
+  needNumber := true // black's move only needs "12..." in front of it at the start of a line or after an interruption
+  for _, node := range moves {
+    if whiteTurn {
+      tokens = append(tokens, strconv.Itoa(moveNumber) + ".")
+    } else if needNumber {
+      tokens = append(tokens, strconv.Itoa(moveNumber) + "...")
+    }
+    tokens = append(tokens, node.San)
+    needNumber = false
+
+    for _, nag := range node.Nags {
+      tokens = append(tokens, "$" + strconv.Itoa(nag))
+    }
+    for _, comment := range node.Comments {
+      tokens = append(tokens, "{" + comment + "}")
+      needNumber = true
+    }
+    for _, variation := range node.Variations {
+      tokens = append(tokens, "(")
+      tokens = appendMoveTokens(tokens, variation, moveNumber, whiteTurn)
+      tokens = append(tokens, ")")
+      needNumber = true
+    }
+
+    if !whiteTurn {
+      moveNumber++
+    }
+    whiteTurn = !whiteTurn
+  }
+  return tokens
+}
@@ -0,0 +1,201 @@
+package pgn
+
+import (
+  "reflect"
+  "strings"
+  "testing"
+
+  . "server/utils"
+)
+
+const ANNOTATED = `[Event "Casual game"]
+[Site "London"]
+[Date "1851.06.21"]
+[Round "?"]
+[White "Anderssen"]
+[Black "Kieseritzky"]
+[Result "1-0"]
+[ECO "C33"]
+
+{The Immortal Game} 1. e4 e5 2. f4 exf4 3. Bc4 Qh4+ $6 4. Kf1 b5 $2 {Bryan's countergambit}
+5. Bxb5 Nf6 6. Nf3 Qh6 (6... Qh5 7. d3 (7. Nc3 {also good}) 7... Nh5) 7. d3 Nh5
+8. Nh4 Qg5 9. Nf5 c6 10. g4 Nf6 11. Rg1 cxb5 12. h4 Qg6 13. h5 Qg5 14. Qf3 Ng8
+15. Bxf4 Qf6 16. Nc3 Bc5 17. Nd5 Qxb2 18. Bd6 Bxg1 $4 19. e5 Qxa1+ 20. Ke2 Na6
+21. Nxg7+ Kd8 22. Qf6+ Nxf6 23. Be7# 1-0
+`
+
+func parseOne(t *testing.T, text string) Game {
+  games, err := Parse(text)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(games) != 1 {
+    t.Fatalf("parsed %d games, want 1", len(games))
+  }
+  return games[0]
+}
+
+func TestRoundTrip(t *testing.T) {
+  game := parseOne(t, ANNOTATED)
+
+  if len(game.Moves) != 45 || game.Result != RESULT_WHITE_WINS {
+    t.Fatalf("%d plies and result %s", len(game.Moves), game.Result)
+  }
+  if len(game.Comments) != 1 || game.Comments[0] != "The Immortal Game" {
+    t.Errorf("game comments %q", game.Comments)
+  }
+  if qh4 := game.Moves[5]; qh4.San != "Qh4+" || !reflect.DeepEqual(qh4.Nags, []int{ 6 }) {
+    t.Errorf("move 3... is %s with NAGs %v", qh4.San, qh4.Nags)
+  }
+  if b5 := game.Moves[7]; !reflect.DeepEqual(b5.Nags, []int{ 2 }) || !reflect.DeepEqual(b5.Comments, []string{ "Bryan's countergambit" }) {
+    t.Errorf("move 4... has NAGs %v and comments %q", b5.Nags, b5.Comments)
+  }
+  variation := game.Moves[11].Variations
+  if len(variation) != 1 || len(variation[0]) != 3 || variation[0][1].San != "d3" || len(variation[0][1].Variations) != 1 {
+    t.Fatalf("variation on 6... is %+v", variation)
+  }
+  if nested := variation[0][1].Variations[0]; nested[0].San != "Nc3" || nested[0].Comments[0] != "also good" {
+    t.Errorf("nested variation is %+v", nested)
+  }
+
+  written := game.String()
+  again := parseOne(t, written)
+  if !reflect.DeepEqual(again, game) {
+    t.Errorf("the game changed on the way through\n%s", written)
+  }
+  if again.String() != written {
+    t.Errorf("writing it a second time gave something else")
+  }
+  for _, line := range strings.Split(written, "\n") {
+    if len(line) > MAX_LINE_LENGTH {
+      t.Errorf("line is %d long: %s", len(line), line)
+    }
+  }
+
+  var board Bitboard
+  if err := Replay(&game, &board); err != nil {
+    t.Fatal(err)
+  }
+  if state := GetGameState(&board); state.Status != STATUS_CHECKMATE || state.Result != game.Result {
+    t.Errorf("the game ends with %s %s", state.Status, state.Result)
+  }
+}
+
+func TestEnPassantMark(t *testing.T) {
+  for _, movetext := range []string{ "3. exd6 e.p. Kd7 *", "3. exd6e.p. Kd7 *", "3.exd6 e.p.(3. Ke2) Kd7 *" } {
+    game := parseOne(t, "1. e4 Nf6 2. e5 d5 " + movetext)
+    if len(game.Moves) != 6 || game.Moves[4].San != "exd6" || game.Moves[5].San != "Kd7" {
+      t.Errorf("%q: parsed as %+v", movetext, game.Moves)
+      continue
+    }
+    var board Bitboard
+    if err := Replay(&game, &board); err != nil {
+      t.Fatalf("%q: %v", movetext, err)
+    }
+    if fen := GetFEN(&board); fen != "rnbq1b1r/pppkpppp/3P1n2/8/8/8/PPPP1PPP/RNBQKBNR w KQ - 1 4" {
+      t.Errorf("%q: replayed to %s", movetext, fen)
+    }
+  }
+}
+
+func TestSetUpPosition(t *testing.T) {
+  const fen = "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 3 12"
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, fen); err != nil {
+    t.Fatal(err)
+  }
+  for _, san := range []string{ "Nf6", "Nc3", "Bb4" } {
+    move, err := ParseSAN(san, &board)
+    if err != nil {
+      t.Fatal(err)
+    }
+    MakeMove(move, &board)
+  }
+
+  game, err := FromBoard(&board, []Tag{ { "White", "Someone" } })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if setUp, _ := game.GetTag("SetUp"); setUp != "1" {
+    t.Errorf("SetUp tag is %q", setUp)
+  }
+  if tagFen, _ := game.GetTag("FEN"); tagFen != fen {
+    t.Errorf("FEN tag is %q", tagFen)
+  }
+
+  written := game.String()
+  if !strings.Contains(written, "12... Nf6 13. Nc3 Bb4 *") {
+    t.Errorf("moves aren't numbered from the FEN:\n%s", written)
+  }
+
+  var replayed Bitboard
+  if err := Replay(&game, &replayed); err != nil {
+    t.Fatal(err)
+  }
+  if GetFEN(&replayed) != GetFEN(&board) {
+    t.Errorf("replayed to %s, want %s", GetFEN(&replayed), GetFEN(&board))
+  }
+}
+
+func TestReplayRejectsIllegalMoves(t *testing.T) {
+  game := parseOne(t, "1. e4 e5 2. Ke3 Nc6 *")
+
+  var board Bitboard
+  InitBoard(&board)
+  MakeMove(GenerateAllMoves(&board)[0], &board)
+  before := GetFEN(&board)
+
+  err := Replay(&game, &board)
+  if err == nil || !strings.Contains(err.Error(), "ply 3") || !strings.Contains(err.Error(), MOVE_ERR_ILLEGAL) {
+    t.Errorf("replaying an illegal move gave %v", err)
+  }
+  if GetFEN(&board) != before {
+    t.Errorf("a failed replay changed the board to %s", GetFEN(&board))
+  }
+
+  broken := Game{ Tags: []Tag{ { "FEN", "not a fen" } } }
+  if err := Replay(&broken, &board); err == nil {
+    t.Error("replayed from a broken FEN tag")
+  }
+}
+
+func TestMalformedGameInAFile(t *testing.T) {
+  text := `[Event "first"]
+[Result "1/2-1/2"]
+
+1. e4 e5 1/2-1/2
+
+[Event "second"]
+[Result "*"]
+
+1. d4 (1. c4 d5 *
+
+[Event "third"]
+
+1. c4 *
+`
+  games, err := Parse(text)
+  if err == nil {
+    t.Fatal("parsed a game with a variation that never closes")
+  }
+  if len(games) != 1 {
+    t.Fatalf("got %d games before the broken one, want 1", len(games))
+  }
+  if event, _ := games[0].GetTag("Event"); event != "first" || games[0].Result != RESULT_DRAW || len(games[0].Moves) != 2 {
+    t.Errorf("first game came back as %+v", games[0])
+  }
+
+  // without the broken one all three come back
+  fixed := strings.Replace(text, "(1. c4 d5 *", "(1. c4 d5) *", 1)
+  games, err = Parse(fixed)
+  if err != nil || len(games) != 3 {
+    t.Fatalf("%d games and %v", len(games), err)
+  }
+  if games[2].Result != RESULT_ONGOING || games[2].Moves[0].San != "c4" {
+    t.Errorf("third game came back as %+v", games[2])
+  }
+
+  if _, err := Parse(`[Event "x" 1. e4 *`); err == nil {
+    t.Error("parsed a tag pair that's never closed")
+  }
+}
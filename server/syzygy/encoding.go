@@ -0,0 +1,135 @@
+package syzygy
+
+// =================================== INDEX TABLES ===================================
+// the tables every index is built from. They're the ones the Syzygy generator used, so the
+// numbering has to come out exactly the same
+var (
+  // BINOMIAL[k][n] is n choose k
+  BINOMIAL [MAX_PIECES][64]uint64
+  // the squares below the a1-h8 diagonal in order
+  MAP_B1H1H7 [64]int
+  // the a1-d1-d4 triangle, the six squares below the diagonal and then the four on it
+  MAP_A1D1D4 [64]int
+  // two pieces that aren't next to each other with the first in the triangle. 462 ways
+  MAP_KK [10][64]int
+  // pawn squares in the order the leading pawn group is encoded, 47 for a2 down to 0
+  MAP_PAWNS [64]int
+  LEAD_PAWN_IDX [MAX_PIECES][64]uint64
+  LEAD_PAWNS_SIZE [MAX_PIECES][4]uint64
+)
+
+func offA1H8(square int) int {
+  return square >> 3 - square & 7
+}
+
+func edgeDistance(file int) int {
+  return min(file, 7 - file)
+}
+
+func kingsTouch(a, b int) bool {
+  return abs(a >> 3 - b >> 3) <= 1 && abs(a & 7 - b & 7) <= 1
+}
+
+func abs(x int) int {
+  if x < 0 {
+    return -x
+  }
+  return x
+}
+
+func init() {
+  BINOMIAL[0][0] = 1
+  for n := 1; n < 64; n++ {
+    for k := 0; k < MAX_PIECES && k <= n; k++ {
+      if k > 0 {
+        BINOMIAL[k][n] += BINOMIAL[k - 1][n - 1]
+      }
+      if k < n {
+        BINOMIAL[k][n] += BINOMIAL[k][n - 1]
+      }
+    }
+  }
+
+  code := 0
+  for square := 0; square < 64; square++ {
+    if offA1H8(square) < 0 {
+      MAP_B1H1H7[square] = code
+      code++
+    }
+  }
+
+  // a1 b1 c1 d1 a2 ... d4
+  var triangle []int
+  for rank := 0; rank < 4; rank++ {
+    for file := 0; file < 4; file++ {
+      triangle = append(triangle, rank * 8 + file)
+    }
+  }
+  inTriangle := map[int]bool{}
+  code = 0
+  var diagonal []int
+  for _, square := range triangle {
+    if offA1H8(square) < 0 {
+      MAP_A1D1D4[square] = code
+      inTriangle[square] = true
+      code++
+    } else if offA1H8(square) == 0 {
+      diagonal = append(diagonal, square)
+    }
+  }
+  for _, square := range diagonal {
+    MAP_A1D1D4[square] = code
+    inTriangle[square] = true
+    code++
+  }
+
+  // with both on the diagonal they come last
+  type pair struct{ idx, square int }
+  var bothOnDiagonal []pair
+  code = 0
+  for idx := 0; idx < 10; idx++ {
+    for first := 0; first <= 27; first++ {
+      if !inTriangle[first] || MAP_A1D1D4[first] != idx {
+        continue
+      }
+      for second := 0; second < 64; second++ {
+        switch {
+        case kingsTouch(first, second):
+        case offA1H8(first) == 0 && offA1H8(second) > 0:
+        case offA1H8(first) == 0 && offA1H8(second) == 0:
+          bothOnDiagonal = append(bothOnDiagonal, pair{ idx, second })
+        default:
+          MAP_KK[idx][second] = code
+          code++
+        }
+      }
+    }
+  }
+  for _, p := range bothOnDiagonal {
+    MAP_KK[p.idx][p.square] = code
+    code++
+  }
+  if code != 462 {
+    panic("syzygy: the king pairs don't add up")
+  }
+
+  // the leading pawn furthest back and nearest the edge goes first, so the others can only be on
+  // its rank or further up. Files a and h count as the same, so do b and g and so on
+  available := 47
+  for count := 1; count < MAX_PIECES - 1; count++ {
+    for file := 0; file < 4; file++ {
+      idx := uint64(0)
+      for rank := 1; rank < 7; rank++ {
+        square := rank * 8 + file
+        if count == 1 {
+          MAP_PAWNS[square] = available
+          MAP_PAWNS[square ^ 7] = available - 1
+          available -= 2
+        }
+        LEAD_PAWN_IDX[count][square] = idx
+        idx += BINOMIAL[count - 1][MAP_PAWNS[square]]
+      }
+      LEAD_PAWNS_SIZE[count][file] = idx
+    }
+  }
+}
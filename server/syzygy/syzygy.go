@@ -0,0 +1,247 @@
+// Package syzygy reads Syzygy endgame tablebases: .rtbw files with the win/draw/loss result of
+// every position and .rtbz files with the distance to the next capture or pawn move (DTZ).
+// It only knows about the files, the raw value stored for a position. What the value means once
+// captures and en passant are taken into account is up to the engine, see utils/tablebase.go
+package syzygy
+
+import (
+  "errors"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// =================================== PIECES AND POSITIONS ===================================
+// the piece codes the files use. A black piece is the white one with BLACK added
+type Piece uint8
+
+const (
+  EMPTY Piece = 0
+  PAWN Piece = 1
+  KNIGHT Piece = 2
+  BISHOP Piece = 3
+  ROOK Piece = 4
+  QUEEN Piece = 5
+  KING Piece = 6
+  BLACK Piece = 8
+
+  PIECE_TYPE_MASK Piece = 7
+  MAX_PIECES = 7 // the biggest tables there are
+)
+
+// the letters in file names, strongest first the way every table name has them
+const PIECE_LETTERS = "KQRBNP"
+
+var LETTER_TO_PIECE = map[byte]Piece{ 'K': KING, 'Q': QUEEN, 'R': ROOK, 'B': BISHOP, 'N': KNIGHT, 'P': PAWN }
+
+// a position the way the tables see it. There's no castling in any table, and en passant is left
+// to whoever does the probing
+type Position struct {
+  Board [64]Piece // a1 is 0, b1 is 1 and h8 is 63
+  WhiteToMove bool
+}
+
+func (pos *Position) pieceCount() int {
+  count := 0
+  for _, piece := range pos.Board {
+    if piece != EMPTY {
+      count++
+    }
+  }
+  return count
+}
+
+// the pieces of one side written the way file names have them, e.g. KRP
+func (pos *Position) material(color Piece) string {
+  var counts [KING + 1]int
+  for _, piece := range pos.Board {
+    if piece != EMPTY && piece & BLACK == color {
+      counts[piece & PIECE_TYPE_MASK]++
+    }
+  }
+  var name strings.Builder
+  for i := 0; i < len(PIECE_LETTERS); i++ {
+    name.WriteString(strings.Repeat(PIECE_LETTERS[i:i + 1], counts[LETTER_TO_PIECE[PIECE_LETTERS[i]]]))
+  }
+  return name.String()
+}
+
+// =================================== RESULTS ===================================
+// a win or loss the fifty move rule turns into a draw is cursed or blessed
+const (
+  LOSS = -2
+  BLESSED_LOSS = -1
+  DRAW = 0
+  CURSED_WIN = 1
+  WIN = 2
+)
+
+var (
+  ErrMissing = errors.New("syzygy: no table for this material")
+  // DTZ tables only hold one side to move. For the other side the probe has to look one move ahead
+  ErrChangeSTM = errors.New("syzygy: the DTZ table is for the other side to move")
+  ErrCorrupt = errors.New("syzygy: corrupt table")
+)
+
+// =================================== TABLEBASE ===================================
+// every table found in a set of directories. Tables are only read the first time they're probed,
+// and probing is safe from any number of goroutines
+type Tablebase struct {
+  wdl map[string]*Table // under both ways round of the material, KQvK and KvKQ
+  dtz map[string]*Table
+  maxPieces int
+}
+
+// finds the tables in dirs, which is a list of directories separated the way PATH is (: or ;)
+func Open(dirs string) (*Tablebase, error) {
+  tb := &Tablebase{ wdl: map[string]*Table{}, dtz: map[string]*Table{} }
+  for _, dir := range filepath.SplitList(dirs) {
+    if dir == "" {
+      continue
+    }
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+      return nil, err
+    }
+    for _, entry := range entries {
+      name := entry.Name()
+      kind := WDL
+      switch filepath.Ext(name) {
+      case WDL_EXTENSION:
+      case DTZ_EXTENSION:
+        kind = DTZ
+      default:
+        continue
+      }
+      table, err := newTable(strings.TrimSuffix(name, filepath.Ext(name)), kind)
+      if err != nil {
+        continue // some other file that happens to have the extension
+      }
+      table.path = filepath.Join(dir, name)
+      tb.add(table)
+    }
+  }
+  return tb, nil
+}
+
+func (tb *Tablebase) add(table *Table) {
+  tables := tb.wdl
+  if table.kind == DTZ {
+    tables = tb.dtz
+  }
+  if _, ok := tables[table.white + "v" + table.black]; ok {
+    return // the first directory a table turns up in wins
+  }
+  tables[table.white + "v" + table.black] = table
+  tables[table.black + "v" + table.white] = table
+  tb.maxPieces = max(tb.maxPieces, table.pieceCount)
+}
+
+// the most pieces any table has, 0 if there are no tables
+func (tb *Tablebase) MaxPieces() int {
+  if tb == nil {
+    return 0
+  }
+  return tb.maxPieces
+}
+
+// how many tables of each kind there are
+func (tb *Tablebase) Count() (wdl int, dtz int) {
+  if tb == nil {
+    return 0, 0
+  }
+  for key, table := range tb.wdl {
+    if key == table.white + "v" + table.black {
+      wdl++
+    }
+  }
+  for key, table := range tb.dtz {
+    if key == table.white + "v" + table.black {
+      dtz++
+    }
+  }
+  return wdl, dtz
+}
+
+func (tb *Tablebase) lookup(pos *Position, kind Kind) (*Table, error) {
+  if tb == nil {
+    return nil, ErrMissing
+  }
+  tables := tb.wdl
+  if kind == DTZ {
+    tables = tb.dtz
+  }
+  table, ok := tables[pos.material(0) + "v" + pos.material(BLACK)]
+  if !ok {
+    return nil, ErrMissing
+  }
+  return table, table.load()
+}
+
+// the result stored for the position, LOSS to WIN for the side to move. Tables are free to store
+// anything for positions where the side to move has a capture that's at least as good, so this
+// is only the real result once the captures have been looked at too
+func (tb *Tablebase) ProbeWDL(pos *Position) (int, error) {
+  if pos.pieceCount() == 2 {
+    return DRAW, nil // only the kings are left
+  }
+  table, err := tb.lookup(pos, WDL)
+  if err != nil {
+    return 0, err
+  }
+  return table.Probe(pos, DRAW)
+}
+
+// the distance in plies to the next capture or pawn move when the side to move plays for the
+// result wdl, which has to be its real result and not a draw. Like ProbeWDL it's only right when
+// the best move isn't a capture or pawn move, and ErrChangeSTM means the table has the position
+// with the other side to move
+func (tb *Tablebase) ProbeDTZ(pos *Position, wdl int) (int, error) {
+  table, err := tb.lookup(pos, DTZ)
+  if err != nil {
+    return 0, err
+  }
+  return table.Probe(pos, wdl)
+}
+
+// =================================== FILES ===================================
+type Kind int
+
+const (
+  WDL Kind = iota
+  DTZ
+)
+
+const (
+  WDL_EXTENSION = ".rtbw"
+  DTZ_EXTENSION = ".rtbz"
+)
+
+var MAGIC = [2][4]byte{ { 0x71, 0xE8, 0x23, 0x5D }, { 0xD7, 0x66, 0x0C, 0xA5 } }
+
+// reads the whole file the first time, every goroutine after the first waits for it and gets
+// the same answer
+func (table *Table) load() error {
+  table.once.Do(func() {
+    data, err := os.ReadFile(table.path)
+    if err != nil {
+      table.err = err
+      return
+    }
+    table.err = table.parse(data)
+  })
+  return table.err
+}
+
+// the table in data, which is the whole of a file named name plus the extension for kind
+func ReadTable(name string, kind Kind, data []byte) (*Table, error) {
+  table, err := newTable(name, kind)
+  if err != nil {
+    return nil, err
+  }
+  table.once.Do(func() {})
+  if err := table.parse(data); err != nil {
+    return nil, err
+  }
+  return table, nil
+}
@@ -0,0 +1,185 @@
+package syzygy
+
+import (
+  "bytes"
+  "math/rand"
+  "os"
+  "testing"
+)
+
+// whatever's written has to read back the same, don't cares aside
+func TestWriteReadBack(t *testing.T) {
+  tests := []struct {
+    name string
+    kind Kind
+    values func(rng *rand.Rand, i int) uint16
+  }{
+    { "KRvK", WDL, func(rng *rand.Rand, i int) uint16 { return uint16(i / 97 % 5) } },
+    { "KRvK", DTZ, func(rng *rand.Rand, i int) uint16 { return uint16(rng.Intn(3) + i / 5000 % 40) } },
+    { "KBvK", WDL, func(rng *rand.Rand, i int) uint16 { return 2 } },
+    { "KPvK", WDL, func(rng *rand.Rand, i int) uint16 {
+      if rng.Intn(10) == 0 {
+        return DONT_CARE
+      }
+      return uint16(i / 13 % 3 * 2)
+    } },
+    { "KPvKP", DTZ, func(rng *rand.Rand, i int) uint16 { return uint16(rng.Intn(8) + i / 3000 % 100) } },
+  }
+
+  for _, test := range tests {
+    rng := rand.New(rand.NewSource(1))
+    table, err := NewTable(test.name, test.kind)
+    if err != nil {
+      t.Fatal(err)
+    }
+    var values [2][4][]uint16
+    for side := 0; side < table.Sides(); side++ {
+      for file := 0; file < table.Files(); file++ {
+        values[side][file] = make([]uint16, table.Size(side, file))
+        for i := range values[side][file] {
+          values[side][file][i] = test.values(rng, i)
+        }
+      }
+    }
+    var file bytes.Buffer
+    if err := table.Write(&file, values); err != nil {
+      t.Fatal(err)
+    }
+    read, err := ReadTable(test.name, test.kind, file.Bytes())
+    if err != nil {
+      t.Fatalf("%s: %v", test.name, err)
+    }
+    for side := 0; side < table.Sides(); side++ {
+      for f := 0; f < table.Files(); f++ {
+        for i, want := range values[side][f] {
+          got, err := read.pairs[side][f].decompress(uint64(i))
+          if err != nil || (want != DONT_CARE && got != int(want)) {
+            t.Fatalf("%s %d side %d file %d index %d: read %d (%v), wrote %d", test.name, test.kind, side, f, i, got, err, want)
+          }
+        }
+      }
+    }
+  }
+}
+
+func TestTableNames(t *testing.T) {
+  for _, name := range []string{ "KQvK", "KRPvKR", "KvK", "KBNvK", "KPPvKP" } {
+    if _, err := newTable(name, WDL); err != nil {
+      t.Errorf("%s: %v", name, err)
+    }
+  }
+  for _, name := range []string{ "KQK", "QKvK", "KRQvK", "KvKK", "KQvKX", "KQQQQvKQQ", "vK" } {
+    if _, err := newTable(name, WDL); err == nil {
+      t.Errorf("took %s for a table", name)
+    }
+  }
+}
+
+func TestCorruptTable(t *testing.T) {
+  data, err := os.ReadFile("testdata/KRvK" + WDL_EXTENSION)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := ReadTable("KRvK", WDL, data); err != nil {
+    t.Fatal(err)
+  }
+
+  if _, err := ReadTable("KRvK", DTZ, data); err == nil {
+    t.Error("read a WDL table as DTZ")
+  }
+  if _, err := ReadTable("KQvK", WDL, data); err == nil {
+    t.Error("read a table under the wrong material")
+  }
+  if _, err := ReadTable("KRvK", WDL, data[:len(data) - 100]); err == nil {
+    t.Error("read a table that was cut short")
+  }
+  bad := append([]byte{}, data...)
+  bad[0] ^= 0xFF
+  if _, err := ReadTable("KRvK", WDL, bad); err == nil {
+    t.Error("read a table with the wrong magic number")
+  }
+}
+
+// a position out of pieces on named squares, like "Ka8" and "bKh1" for black
+func testPosition(whiteToMove bool, pieces ...string) *Position {
+  pos := &Position{ WhiteToMove: whiteToMove }
+  for _, piece := range pieces {
+    color := Piece(0)
+    if piece[0] == 'b' {
+      color, piece = BLACK, piece[1:]
+    }
+    pos.Board[int(piece[2] - '1') * 8 + int(piece[1] - 'a')] = LETTER_TO_PIECE[piece[0]] | color
+  }
+  return pos
+}
+
+func TestOpen(t *testing.T) {
+  tb, err := Open("testdata")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if wdl, dtz := tb.Count(); wdl != 21 || dtz != 21 || tb.MaxPieces() != 4 {
+    t.Errorf("found %d WDL and %d DTZ tables of up to %d pieces, want 21 and 21 of 4", wdl, dtz, tb.MaxPieces())
+  }
+  if _, err := tb.ProbeWDL(testPosition(true, "Ke1", "Qd1", "bKe8", "bRa8", "bRh8")); err != ErrMissing {
+    t.Errorf("probed KQvKRR without the table: %v", err)
+  }
+  if _, err := Open("testdata/nothing"); err == nil {
+    t.Error("opened a directory that isn't there")
+  }
+  var none *Tablebase
+  if _, err := none.ProbeWDL(testPosition(true, "Ke1", "Qd1", "bKe8")); err != ErrMissing || none.MaxPieces() != 0 {
+    t.Errorf("probed without any tables: %v", err)
+  }
+}
+
+// the values stored for positions where no capture gets in the way, so what's stored is the result
+func TestProbe(t *testing.T) {
+  tb, err := Open("testdata")
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    pos *Position
+    wdl int
+    dtz int // 0 to skip the DTZ probe, the table only has white to move
+  }{
+    { testPosition(true, "Kb6", "Qc7", "bKa8"), WIN, 1 },
+    { testPosition(false, "Kb6", "Qc7", "bKa8"), DRAW, 0 },
+    { testPosition(false, "Kh6", "Ra8", "bKh8"), LOSS, 0 },
+    { testPosition(true, "Kb6", "Rh1", "bKa8"), WIN, 1 },
+    { testPosition(false, "bKb6", "bRh1", "Ka8"), WIN, 0 }, // the same with the colors the other way round
+    { testPosition(true, "Ke6", "Pe5", "bKe8"), WIN, 0 },
+    { testPosition(true, "Ke5", "Pe4", "bKe7"), DRAW, 0 },
+    { testPosition(false, "Ke5", "Pe4", "bKe7"), LOSS, 0 },
+    { testPosition(true, "Ke1", "Bc3", "bKd6"), DRAW, 0 },
+    { testPosition(false, "Ke1", "Nc3", "bKd6"), DRAW, 0 },
+
+    // four pieces: both sides to move, pawns on both sides, and symmetric tables
+    { testPosition(true, "Kg6", "Bh7", "Ng5", "bKh8"), WIN, 1 }, // Nf7 mates
+    { testPosition(true, "Ke1", "Bc1", "Nb1", "bKe8"), WIN, 0 },
+    { testPosition(false, "Ke1", "Bc1", "Nb1", "bKe8"), LOSS, 0 },
+    { testPosition(true, "Kf7", "Pg6", "bKh8", "bPh7"), WIN, 0 }, // g7 mates
+    { testPosition(false, "bKf2", "bPg3", "Kh1", "Ph2"), WIN, 0 }, // the same for black
+    { testPosition(true, "Ke1", "Pa4", "bKe8", "bPa5"), DRAW, 0 },
+    { testPosition(false, "Ke1", "Pa4", "bKe8", "bPa5"), DRAW, 0 },
+    { testPosition(true, "Ke1", "Rd1", "bKh8", "bPh7"), WIN, 0 },
+    { testPosition(false, "bKe8", "bRd8", "Kh1", "Ph2"), WIN, 0 }, // the rook on black's side
+    { testPosition(true, "Ke1", "Qd1", "bKe8", "bQd8"), DRAW, 0 },
+  }
+
+  for i, test := range tests {
+    if wdl, err := tb.ProbeWDL(test.pos); err != nil || wdl != test.wdl {
+      t.Errorf("%d: WDL %d (%v), want %d", i, wdl, err, test.wdl)
+    }
+    if test.dtz != 0 {
+      if dtz, err := tb.ProbeDTZ(test.pos, test.wdl); err != nil || dtz != test.dtz {
+        t.Errorf("%d: DTZ %d (%v), want %d", i, dtz, err, test.dtz)
+      }
+    }
+  }
+
+  if _, err := tb.ProbeDTZ(testPosition(false, "Kb6", "Rh1", "bKa8"), LOSS); err != ErrChangeSTM {
+    t.Errorf("probed DTZ with black to move: %v", err)
+  }
+}
@@ -0,0 +1,763 @@
+package syzygy
+
+import (
+  "encoding/binary"
+  "fmt"
+  "sort"
+  "strings"
+  "sync"
+)
+
+// =================================== TABLES ===================================
+// one .rtbw or .rtbz file. The material in its name is white's and black's the way the table
+// stores them, a position where black has white's pieces gets its colors and ranks swapped first
+type Table struct {
+  kind Kind
+  white, black string
+  path string
+  pieceCount int
+  hasPawns bool
+  hasUniquePieces bool // some piece other than a king is the only one of its kind
+  pawnCount [2]int // the leading color's first, the side with fewer pawns unless it has none
+  symmetric bool
+
+  once sync.Once
+  err error
+  data []byte
+  // pawnless tables have one file, pawn tables one per file a to d of the leading pawn. There's a
+  // side for each side to move, just the one when that can't matter or for a DTZ table
+  pairs [2][4]*pairsData
+  dtzMap int
+}
+
+// how the positions with one side to move and leading pawn file are indexed and compressed
+type pairsData struct {
+  flags uint8
+  pieces [MAX_PIECES]Piece // in the order the index encodes them
+  groupLen [MAX_PIECES + 1]int // pieces that are encoded together, ending with a 0
+  groupIdx [MAX_PIECES + 1]uint64 // what each group's index is multiplied by
+  order [2]int // where the leading group and the other color's pawns are in that
+  size uint64
+
+  sizeofBlock int
+  span uint64
+  sparseIndexSize uint64
+  numBlocks int
+  blockLengthSize int
+  maxSymLen, minSymLen int
+  lowestSym []int
+  base64 []uint64
+  symlen []uint8
+  btree int // offsets into the file from here on
+  sparseIndex int
+  blockLength int
+  blocks int
+  mapIdx [4]int
+  data []byte
+}
+
+// the value flags, in the flags byte of every pairsData
+const (
+  FLAG_STM = 1 // the side to move a DTZ table has, 1 for black
+  FLAG_MAPPED = 2 // DTZ values go through a map
+  FLAG_WIN_PLIES = 4 // winning DTZ values are in plies, not moves
+  FLAG_LOSS_PLIES = 8
+  FLAG_WIDE = 16 // the map has 16 bit values
+  FLAG_SINGLE_VALUE = 128 // every position has the same value, there are no blocks
+)
+
+// the two bits in the byte after the magic number
+const (
+  HEADER_SPLIT = 1 // the table has both sides to move
+  HEADER_HAS_PAWNS = 2
+)
+
+func parseSide(side string) ([KING + 1]int, error) {
+  var counts [KING + 1]int
+  last := -1
+  for i := 0; i < len(side); i++ {
+    order := strings.IndexByte(PIECE_LETTERS, side[i])
+    if order < last || (i == 0) != (side[i] == 'K') {
+      return counts, fmt.Errorf("syzygy: %q isn't one side of a table", side)
+    }
+    last = order
+    counts[LETTER_TO_PIECE[side[i]]]++
+  }
+  if counts[KING] != 1 {
+    return counts, fmt.Errorf("syzygy: %q isn't one side of a table", side)
+  }
+  return counts, nil
+}
+
+func newTable(name string, kind Kind) (*Table, error) {
+  white, black, ok := strings.Cut(name, "v")
+  if !ok {
+    return nil, fmt.Errorf("syzygy: %q isn't a table name", name)
+  }
+  whiteCounts, err := parseSide(white)
+  if err != nil {
+    return nil, err
+  }
+  blackCounts, err := parseSide(black)
+  if err != nil {
+    return nil, err
+  }
+  table := &Table{ kind: kind, white: white, black: black, pieceCount: len(white) + len(black), symmetric: white == black }
+  if table.pieceCount > MAX_PIECES {
+    return nil, fmt.Errorf("syzygy: %s has more than %d pieces", name, MAX_PIECES)
+  }
+  table.hasPawns = whiteCounts[PAWN] + blackCounts[PAWN] > 0
+  for piece := PAWN; piece < KING; piece++ {
+    if whiteCounts[piece] == 1 || blackCounts[piece] == 1 {
+      table.hasUniquePieces = true
+    }
+  }
+  // the leading color has the fewest pawns, which compresses better
+  if blackCounts[PAWN] == 0 || (whiteCounts[PAWN] > 0 && blackCounts[PAWN] >= whiteCounts[PAWN]) {
+    table.pawnCount = [2]int{ whiteCounts[PAWN], blackCounts[PAWN] }
+  } else {
+    table.pawnCount = [2]int{ blackCounts[PAWN], whiteCounts[PAWN] }
+  }
+  return table, nil
+}
+
+func (table *Table) Name() string {
+  return table.white + "v" + table.black
+}
+
+// how many sides to move the table has
+func (table *Table) Sides() int {
+  if table.kind == DTZ || table.symmetric {
+    return 1
+  }
+  return 2
+}
+
+// how many leading pawn files the table has
+func (table *Table) Files() int {
+  if table.hasPawns {
+    return 4
+  }
+  return 1
+}
+
+func (table *Table) Size(side int, file int) uint64 {
+  return table.pairs[side][file].size
+}
+
+// =================================== READING A FILE ===================================
+// reads little endian numbers, and remembers if it ever ran off the end
+type reader struct {
+  data []byte
+  at int
+  short bool
+}
+
+func (r *reader) need(n int) bool {
+  if r.at < 0 || r.at + n > len(r.data) {
+    r.short = true
+    return false
+  }
+  return true
+}
+
+func (r *reader) u8() int {
+  if !r.need(1) {
+    return 0
+  }
+  r.at++
+  return int(r.data[r.at - 1])
+}
+
+func (r *reader) u16() int {
+  if !r.need(2) {
+    return 0
+  }
+  r.at += 2
+  return int(binary.LittleEndian.Uint16(r.data[r.at - 2:]))
+}
+
+func (r *reader) u32() int {
+  if !r.need(4) {
+    return 0
+  }
+  r.at += 4
+  return int(binary.LittleEndian.Uint32(r.data[r.at - 4:]))
+}
+
+func (table *Table) parse(data []byte) error {
+  if len(data) < 5 || [4]byte(data[:4]) != MAGIC[table.kind] {
+    return fmt.Errorf("syzygy: %s isn't a %s table", table.Name(), []string{ "WDL", "DTZ" }[table.kind])
+  }
+  corrupt := fmt.Errorf("%w %s", ErrCorrupt, table.Name())
+  r := &reader{ data: data, at: 4 }
+  header := r.u8()
+  if (header & HEADER_HAS_PAWNS != 0) != table.hasPawns || (header & HEADER_SPLIT != 0) != (table.Sides() == 2) {
+    return corrupt
+  }
+
+  sides, files := table.Sides(), table.Files()
+  pawnsBothSides := table.hasPawns && table.pawnCount[1] > 0
+  for file := 0; file < files; file++ {
+    order := [2][2]int{ { 0, 0xF }, { 0, 0xF } }
+    b := r.u8()
+    order[0][0], order[1][0] = b & 0xF, b >> 4
+    if pawnsBothSides {
+      b = r.u8()
+      order[0][1], order[1][1] = b & 0xF, b >> 4
+    }
+    for side := 0; side < sides; side++ {
+      table.pairs[side][file] = &pairsData{ data: data }
+    }
+    for i := 0; i < table.pieceCount; i++ {
+      b = r.u8()
+      for side := 0; side < sides; side++ {
+        table.pairs[side][file].pieces[i] = Piece(b >> (4 * side) & 0xF)
+      }
+    }
+    for side := 0; side < sides; side++ {
+      if !table.setGroups(table.pairs[side][file], order[side], file) {
+        return corrupt
+      }
+    }
+  }
+  r.at += r.at & 1
+
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      if !table.pairs[side][file].setSizes(r) {
+        return corrupt
+      }
+    }
+  }
+  if table.kind == DTZ {
+    table.setDTZMap(r)
+  }
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      d := table.pairs[side][file]
+      d.sparseIndex = r.at
+      r.at += int(d.sparseIndexSize) * 6
+    }
+  }
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      d := table.pairs[side][file]
+      d.blockLength = r.at
+      r.at += d.blockLengthSize * 2
+    }
+  }
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      d := table.pairs[side][file]
+      r.at = (r.at + 63) &^ 63
+      d.blocks = r.at
+      r.at += d.numBlocks * d.sizeofBlock
+    }
+  }
+  if r.short || r.at > len(data) {
+    return corrupt
+  }
+  table.data = data
+  return nil
+}
+
+// works out the groups the pieces are encoded in and what each group's index gets multiplied by.
+// order says where in that product the leading group goes, and the other color's pawns if both
+// sides have some. False if the order makes no sense
+func (table *Table) setGroups(d *pairsData, order [2]int, file int) bool {
+  var counts [2][KING + 1]int
+  for _, piece := range d.pieces[:table.pieceCount] {
+    if piece & PIECE_TYPE_MASK == EMPTY || piece & PIECE_TYPE_MASK > KING {
+      return false
+    }
+    counts[piece >> 3][piece & PIECE_TYPE_MASK]++
+  }
+  whiteCounts, _ := parseSide(table.white)
+  blackCounts, _ := parseSide(table.black)
+  if counts != [2][KING + 1]int{ whiteCounts, blackCounts } {
+    return false
+  }
+
+  n := 0
+  firstLen := 0
+  if !table.hasPawns {
+    firstLen = 2
+    if table.hasUniquePieces {
+      firstLen = 3
+    }
+  }
+  d.groupLen = [MAX_PIECES + 1]int{ 1 }
+  for i := 1; i < table.pieceCount; i++ {
+    firstLen--
+    if firstLen > 0 || d.pieces[i] == d.pieces[i - 1] {
+      d.groupLen[n]++
+    } else {
+      n++
+      d.groupLen[n] = 1
+    }
+  }
+  n++
+
+  pawnsBothSides := table.hasPawns && table.pawnCount[1] > 0
+  next := 1
+  freeSquares := 64 - d.groupLen[0]
+  if pawnsBothSides {
+    next = 2
+    freeSquares -= d.groupLen[1]
+  }
+  if table.hasPawns && (d.pieces[0] & PIECE_TYPE_MASK != PAWN || d.groupLen[0] != table.pawnCount[0]) {
+    return false
+  }
+  if pawnsBothSides && (d.pieces[d.groupLen[0]] & PIECE_TYPE_MASK != PAWN || d.groupLen[1] != table.pawnCount[1]) {
+    return false
+  }
+
+  idx := uint64(1)
+  placed := 0
+  for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+    if k > MAX_PIECES {
+      return false
+    }
+    switch {
+    case k == order[0]:
+      d.groupIdx[0] = idx
+      placed++
+      switch {
+      case table.hasPawns:
+        idx *= LEAD_PAWNS_SIZE[d.groupLen[0]][file]
+      case table.hasUniquePieces:
+        idx *= 31332
+      default:
+        idx *= 462
+      }
+    case k == order[1]:
+      d.groupIdx[1] = idx
+      placed++
+      idx *= BINOMIAL[d.groupLen[1]][48 - d.groupLen[0]]
+    default:
+      d.groupIdx[next] = idx
+      idx *= BINOMIAL[d.groupLen[next]][freeSquares]
+      freeSquares -= d.groupLen[next]
+      next++
+    }
+  }
+  want := 1
+  if pawnsBothSides {
+    want = 2
+  }
+  if placed != want {
+    return false
+  }
+  d.groupIdx[n] = idx
+  d.order = order
+  d.size = idx
+  return true
+}
+
+// the part of the header that says how the values were compressed
+func (d *pairsData) setSizes(r *reader) bool {
+  d.flags = uint8(r.u8())
+  if d.flags & FLAG_SINGLE_VALUE != 0 {
+    d.minSymLen = r.u8() // the value
+    return !r.short
+  }
+
+  d.sizeofBlock = 1 << r.u8()
+  d.span = 1 << r.u8()
+  d.sparseIndexSize = (d.size + d.span - 1) / d.span
+  padding := r.u8()
+  d.numBlocks = r.u32()
+  d.blockLengthSize = d.numBlocks + padding
+  d.maxSymLen = r.u8()
+  d.minSymLen = r.u8()
+  if r.short || d.span == 0 || d.span > 1 << 16 || d.sizeofBlock < 8 || d.minSymLen < 1 || d.maxSymLen < d.minSymLen || d.maxSymLen > 32 {
+    return false
+  }
+
+  d.lowestSym = make([]int, d.maxSymLen - d.minSymLen + 1)
+  for i := range d.lowestSym {
+    d.lowestSym[i] = r.u16()
+  }
+  // canonical huffman codes, the longest ones have the lowest symbols. base64[i] is the lowest
+  // code of length i + minSymLen, left aligned in 64 bits
+  d.base64 = make([]uint64, len(d.lowestSym))
+  for i := len(d.base64) - 2; i >= 0; i-- {
+    d.base64[i] = (d.base64[i + 1] + uint64(d.lowestSym[i]) - uint64(d.lowestSym[i + 1])) / 2
+  }
+  for i := range d.base64 {
+    d.base64[i] <<= 64 - i - d.minSymLen
+  }
+
+  symbols := r.u16()
+  d.btree = r.at
+  r.at += symbols * 3 + symbols & 1
+  if r.short || r.at > len(r.data) {
+    return false
+  }
+  // every symbol stands for a pair of symbols, or for a value if it's a leaf. symlen is how many
+  // values it stands for, less one
+  d.symlen = make([]uint8, symbols)
+  visited := make([]bool, symbols)
+  for s := 0; s < symbols; s++ {
+    if !visited[s] && !d.setSymlen(s, visited) {
+      return false
+    }
+  }
+  return true
+}
+
+func (d *pairsData) left(s int) int {
+  at := d.btree + 3 * s
+  return int(d.data[at + 1] & 0xF) << 8 | int(d.data[at])
+}
+
+func (d *pairsData) right(s int) int {
+  at := d.btree + 3 * s
+  return int(d.data[at + 2]) << 4 | int(d.data[at + 1] >> 4)
+}
+
+func (d *pairsData) isLeaf(s int) bool {
+  return d.right(s) == 0xFFF
+}
+
+func (d *pairsData) setSymlen(s int, visited []bool) bool {
+  visited[s] = true
+  if d.isLeaf(s) {
+    return true
+  }
+  left, right := d.left(s), d.right(s)
+  if left >= len(d.symlen) || right >= len(d.symlen) {
+    return false
+  }
+  for _, child := range []int{ left, right } {
+    if !visited[child] && !d.setSymlen(child, visited) {
+      return false
+    }
+  }
+  d.symlen[s] = d.symlen[left] + d.symlen[right] + 1
+  return true
+}
+
+// DTZ tables can map their values through a list for each result, the four lists for every file
+// come after the compression headers
+func (table *Table) setDTZMap(r *reader) {
+  table.dtzMap = r.at
+  for file := 0; file < table.Files(); file++ {
+    d := table.pairs[0][file]
+    if d.flags & FLAG_MAPPED == 0 {
+      continue
+    }
+    if d.flags & FLAG_WIDE != 0 {
+      r.at += r.at & 1
+      for i := 0; i < 4; i++ {
+        d.mapIdx[i] = (r.at - table.dtzMap) / 2 + 1
+        r.at += 2 * r.u16()
+      }
+    } else {
+      for i := 0; i < 4; i++ {
+        d.mapIdx[i] = r.at - table.dtzMap + 1
+        r.at += r.u8()
+      }
+    }
+  }
+  r.at += r.at & 1
+}
+
+// =================================== PROBING ===================================
+// the value stored for pos. For a WDL table that's LOSS to WIN, for a DTZ table the distance for
+// a position whose result is wdl
+func (table *Table) Probe(pos *Position, wdl int) (int, error) {
+  side, file, idx, err := table.Locate(pos)
+  if err != nil {
+    return 0, err
+  }
+  d := table.pairs[side][file]
+  value, err := d.decompress(idx)
+  if err != nil {
+    return 0, fmt.Errorf("%w %s", err, table.Name())
+  }
+  if table.kind == WDL {
+    return value - 2, nil
+  }
+  return table.mapDTZ(d, value, wdl)
+}
+
+var WDL_TO_MAP = [5]int{ 1, 3, 0, 2, 0 }
+
+func (table *Table) mapDTZ(d *pairsData, value int, wdl int) (int, error) {
+  if d.flags & FLAG_MAPPED != 0 {
+    idx := d.mapIdx[WDL_TO_MAP[wdl + 2]] + value
+    if d.flags & FLAG_WIDE != 0 {
+      at := table.dtzMap + 2 * idx
+      if at + 2 > len(table.data) {
+        return 0, ErrCorrupt
+      }
+      value = int(binary.LittleEndian.Uint16(table.data[at:]))
+    } else {
+      if table.dtzMap + idx >= len(table.data) {
+        return 0, ErrCorrupt
+      }
+      value = int(table.data[table.dtzMap + idx])
+    }
+  }
+  // values are in moves unless the flags say plies, and cursed results are always in moves
+  if (wdl == WIN && d.flags & FLAG_WIN_PLIES == 0) || (wdl == LOSS && d.flags & FLAG_LOSS_PLIES == 0) || wdl == CURSED_WIN || wdl == BLESSED_LOSS {
+    value *= 2
+  }
+  return value + 1, nil
+}
+
+// where a position is stored: the side to move and leading pawn file it's under, and its index
+// there. Positions that are the same after flipping the colors or mirroring the board all end up
+// in the same place
+func (table *Table) Locate(pos *Position) (int, int, uint64, error) {
+  // the table has the stronger side as white, and only white to move if it's symmetric
+  flip := (table.symmetric && !pos.WhiteToMove) || (!table.symmetric && pos.material(0) != table.white)
+  var flipColor Piece
+  flipSquares := 0
+  if flip {
+    flipColor, flipSquares = BLACK, 56
+  }
+  stm := 0
+  if pos.WhiteToMove == flip {
+    stm = 1
+  }
+
+  var squares [MAX_PIECES]int
+  var pieces [MAX_PIECES]Piece
+  size, leadPawnsCount, file := 0, 0, 0
+  var leadPawns uint64
+  if table.hasPawns {
+    // the leading pawn furthest back decides the file, it goes first
+    leadPawn := table.pairs[0][0].pieces[0] ^ flipColor
+    for square, piece := range pos.Board {
+      if piece == leadPawn && size < MAX_PIECES {
+        leadPawns |= 1 << square
+        squares[size] = square ^ flipSquares
+        size++
+      }
+    }
+    leadPawnsCount = size
+    first := 0
+    for i := 1; i < size; i++ {
+      if MAP_PAWNS[squares[i]] > MAP_PAWNS[squares[first]] {
+        first = i
+      }
+    }
+    squares[0], squares[first] = squares[first], squares[0]
+    file = edgeDistance(squares[0] & 7)
+  }
+
+  if table.kind == DTZ && int(table.pairs[0][file].flags & FLAG_STM) != stm && !(table.symmetric && !table.hasPawns) {
+    return 0, 0, 0, ErrChangeSTM
+  }
+
+  for square, piece := range pos.Board {
+    if piece != EMPTY && leadPawns & (1 << square) == 0 {
+      if size == MAX_PIECES {
+        return 0, 0, 0, ErrMissing
+      }
+      squares[size] = square ^ flipSquares
+      pieces[size] = piece ^ flipColor
+      size++
+    }
+  }
+  if size != table.pieceCount || (table.symmetric && pos.material(0) != pos.material(BLACK)) {
+    return 0, 0, 0, ErrMissing
+  }
+
+  side := stm % table.Sides()
+  d := table.pairs[side][file]
+  // put the pieces in the order the table encodes them
+  for i := leadPawnsCount; i < size - 1; i++ {
+    for j := i + 1; j < size; j++ {
+      if d.pieces[i] == pieces[j] {
+        pieces[i], pieces[j] = pieces[j], pieces[i]
+        squares[i], squares[j] = squares[j], squares[i]
+        break
+      }
+    }
+  }
+  for i := leadPawnsCount; i < size; i++ {
+    if pieces[i] != d.pieces[i] {
+      return 0, 0, 0, ErrMissing
+    }
+  }
+
+  // mirror so the first piece is on files a to d
+  if squares[0] & 7 > 3 {
+    for i := 0; i < size; i++ {
+      squares[i] ^= 7
+    }
+  }
+
+  var idx uint64
+  if table.hasPawns {
+    idx = LEAD_PAWN_IDX[leadPawnsCount][squares[0]]
+    rest := squares[1:leadPawnsCount]
+    sort.SliceStable(rest, func(i, j int) bool { return MAP_PAWNS[rest[i]] < MAP_PAWNS[rest[j]] })
+    for i := 1; i < leadPawnsCount; i++ {
+      idx += BINOMIAL[i][MAP_PAWNS[squares[i]]]
+    }
+  } else {
+    // then onto ranks 1 to 4, and below the a1-h8 diagonal if the first piece off it isn't
+    if squares[0] >> 3 > 3 {
+      for i := 0; i < size; i++ {
+        squares[i] ^= 56
+      }
+    }
+    for i := 0; i < d.groupLen[0]; i++ {
+      off := offA1H8(squares[i])
+      if off == 0 {
+        continue
+      }
+      if off > 0 {
+        for j := i; j < size; j++ {
+          squares[j] = (squares[j] >> 3 | squares[j] << 3) & 63
+        }
+      }
+      break
+    }
+
+    if table.hasUniquePieces {
+      adjust1 := boolToInt(squares[1] > squares[0])
+      adjust2 := boolToInt(squares[2] > squares[0]) + boolToInt(squares[2] > squares[1])
+      switch {
+      case offA1H8(squares[0]) != 0:
+        idx = uint64((MAP_A1D1D4[squares[0]] * 63 + squares[1] - adjust1) * 62 + squares[2] - adjust2)
+      case offA1H8(squares[1]) != 0:
+        idx = uint64((6 * 63 + (squares[0] >> 3) * 28 + MAP_B1H1H7[squares[1]]) * 62 + squares[2] - adjust2)
+      case offA1H8(squares[2]) != 0:
+        idx = uint64(6 * 63 * 62 + 4 * 28 * 62 + (squares[0] >> 3) * 7 * 28 + ((squares[1] >> 3) - adjust1) * 28 + MAP_B1H1H7[squares[2]])
+      default:
+        idx = uint64(6 * 63 * 62 + 4 * 28 * 62 + 4 * 7 * 28 + (squares[0] >> 3) * 7 * 6 + ((squares[1] >> 3) - adjust1) * 6 + (squares[2] >> 3) - adjust2)
+      }
+    } else {
+      idx = uint64(MAP_KK[MAP_A1D1D4[squares[0]]][squares[1]])
+    }
+  }
+  idx *= d.groupIdx[0]
+
+  // every other group is a combination of the squares the groups before it left free
+  groupStart := d.groupLen[0]
+  remainingPawns := table.hasPawns && table.pawnCount[1] > 0
+  for next := 1; d.groupLen[next] != 0; next++ {
+    group := squares[groupStart:groupStart + d.groupLen[next]]
+    sort.Ints(group)
+    n := uint64(0)
+    for i, square := range group {
+      adjust := 0
+      for _, before := range squares[:groupStart] {
+        adjust += boolToInt(square > before)
+      }
+      if remainingPawns {
+        adjust += 8
+      }
+      n += BINOMIAL[i + 1][square - adjust]
+    }
+    remainingPawns = false
+    idx += n * d.groupIdx[next]
+    groupStart += d.groupLen[next]
+  }
+  return side, file, idx, nil
+}
+
+func boolToInt(b bool) int {
+  if b {
+    return 1
+  }
+  return 0
+}
+
+// =================================== DECOMPRESSION ===================================
+func (d *pairsData) be32(at int) uint64 {
+  var b [4]byte
+  if at >= 0 && at < len(d.data) {
+    copy(b[:], d.data[at:])
+  }
+  return uint64(binary.BigEndian.Uint32(b[:]))
+}
+
+func (d *pairsData) blockLen(block int) (int, error) {
+  if block < 0 || block >= d.blockLengthSize {
+    return 0, ErrCorrupt
+  }
+  return int(binary.LittleEndian.Uint16(d.data[d.blockLength + 2 * block:])), nil
+}
+
+// the value stored at idx. The sparse index says which block a point near idx is in, from there
+// it's a walk over block lengths, then over the symbols of the block, then down the symbol's pairs
+func (d *pairsData) decompress(idx uint64) (int, error) {
+  if d.flags & FLAG_SINGLE_VALUE != 0 {
+    return d.minSymLen, nil
+  }
+  if idx >= d.size {
+    return 0, ErrCorrupt
+  }
+
+  entry := d.sparseIndex + 6 * int(idx / d.span)
+  block := int(binary.LittleEndian.Uint32(d.data[entry:]))
+  offset := int(binary.LittleEndian.Uint16(d.data[entry + 4:])) + int(idx % d.span) - int(d.span / 2)
+  for offset < 0 {
+    block--
+    length, err := d.blockLen(block)
+    if err != nil {
+      return 0, err
+    }
+    offset += length + 1
+  }
+  for {
+    length, err := d.blockLen(block)
+    if err != nil {
+      return 0, err
+    }
+    if offset <= length {
+      break
+    }
+    offset -= length + 1
+    block++
+  }
+  if block >= d.numBlocks {
+    return 0, ErrCorrupt
+  }
+
+  at := d.blocks + block * d.sizeofBlock
+  buf := d.be32(at) << 32 | d.be32(at + 4)
+  at += 8
+  bits := 64
+  var sym int
+  for {
+    length := 0
+    for buf < d.base64[length] {
+      length++
+    }
+    sym = int((buf - d.base64[length]) >> (64 - length - d.minSymLen)) + d.lowestSym[length]
+    if sym >= len(d.symlen) {
+      return 0, ErrCorrupt
+    }
+    if offset < int(d.symlen[sym]) + 1 {
+      break
+    }
+    offset -= int(d.symlen[sym]) + 1
+    length += d.minSymLen
+    buf <<= length
+    bits -= length
+    if bits <= 32 {
+      bits += 32
+      buf |= d.be32(at) << (64 - bits)
+      at += 4
+    }
+  }
+
+  for d.symlen[sym] != 0 {
+    left := d.left(sym)
+    if offset < int(d.symlen[left]) + 1 {
+      sym = left
+    } else {
+      offset -= int(d.symlen[left]) + 1
+      sym = d.right(sym)
+    }
+  }
+  return d.left(sym), nil
+}
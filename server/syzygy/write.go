@@ -0,0 +1,555 @@
+package syzygy
+
+import (
+  "container/heap"
+  "encoding/binary"
+  "fmt"
+  "io"
+  "math/bits"
+  "sort"
+)
+
+// =================================== WRITING TABLES ===================================
+// Syzygy files come out of a generator that's far too big to have here, but the format itself is
+// simple enough to write. This is what cmd/tbgen uses for the small tables in testdata, and what
+// the tests use to check that what's written reads back the same
+
+// a value a position can have when it doesn't matter what's stored, like an illegal position
+const DONT_CARE = 0xFFFF
+
+const (
+  BLOCK_SIZE_LOG = 7 // 128 byte blocks
+  MAX_SYMBOLS = 0xFFF // 0xFFF marks a leaf
+  MAX_SYMBOL_VALUES = 256 // symlen is a byte
+  MIN_PAIR_COUNT = 20 // a new symbol costs 3 bytes, it's not worth it for fewer pairs than this
+  MAX_CODE_LENGTH = 32
+)
+
+// an empty table for the material in name, with the pieces in the order this package writes
+// them. Locate and Size say where each position's value goes for Write. A DTZ table is written
+// for white to move, with distances in plies
+func NewTable(name string, kind Kind) (*Table, error) {
+  table, err := newTable(name, kind)
+  if err != nil {
+    return nil, err
+  }
+  table.once.Do(func() {})
+
+  whiteCounts, _ := parseSide(table.white)
+  blackCounts, _ := parseSide(table.black)
+  counts := [2][KING + 1]int{ whiteCounts, blackCounts }
+  var pieces []Piece
+  take := func(color int, piece Piece) {
+    for ; counts[color][piece] > 0; counts[color][piece]-- {
+      pieces = append(pieces, piece | Piece(color) * BLACK)
+    }
+  }
+  // pawns of the leading color, then the other color's, then the kings and a unique piece if
+  // there is one, which is what the first group of a pawnless table has to be
+  if table.hasPawns {
+    lead := 1
+    if blackCounts[PAWN] == 0 || (whiteCounts[PAWN] > 0 && blackCounts[PAWN] >= whiteCounts[PAWN]) {
+      lead = 0
+    }
+    take(lead, PAWN)
+    take(1 - lead, PAWN)
+  }
+  take(0, KING)
+  take(1, KING)
+  if table.hasUniquePieces && !table.hasPawns {
+    unique:
+    for color := 0; color < 2; color++ {
+      for piece := QUEEN; piece > EMPTY; piece-- {
+        if counts[color][piece] == 1 {
+          take(color, piece)
+          break unique
+        }
+      }
+    }
+  }
+  for color := 0; color < 2; color++ {
+    for piece := QUEEN; piece > EMPTY; piece-- {
+      take(color, piece)
+    }
+  }
+
+  for file := 0; file < table.Files(); file++ {
+    for side := 0; side < table.Sides(); side++ {
+      d := &pairsData{}
+      copy(d.pieces[:], pieces)
+      if kind == DTZ {
+        d.flags = FLAG_WIN_PLIES | FLAG_LOSS_PLIES
+      }
+      // the leading group changes slowest and the last group fastest, that gives the longest runs
+      table.setGroups(d, [2]int{ 0, 0xF }, file)
+      groups := 0
+      for d.groupLen[groups] != 0 {
+        groups++
+      }
+      order := [2]int{ groups - 1, 0xF }
+      if table.hasPawns && table.pawnCount[1] > 0 {
+        order[1] = groups - 2
+      }
+      if !table.setGroups(d, order, file) {
+        return nil, fmt.Errorf("syzygy: can't lay out %s", name)
+      }
+      table.pairs[side][file] = d
+    }
+  }
+  return table, nil
+}
+
+// writes the table with values[side][file][index] for every position, DONT_CARE where anything
+// will do. WDL values are the result plus 2, DTZ values are the distance less 1
+func (table *Table) Write(w io.Writer, values [2][4][]uint16) error {
+  sides, files := table.Sides(), table.Files()
+  var packed [2][4]*compressed
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      d := table.pairs[side][file]
+      if uint64(len(values[side][file])) != d.size {
+        return fmt.Errorf("syzygy: %s has %d values for side %d file %d, want %d", table.Name(), len(values[side][file]), side, file, d.size)
+      }
+      c, err := compress(values[side][file])
+      if err != nil {
+        return fmt.Errorf("syzygy: %s: %w", table.Name(), err)
+      }
+      packed[side][file] = c
+    }
+  }
+
+  out := append([]byte{}, MAGIC[table.kind][:]...)
+  header := byte(0)
+  if sides == 2 {
+    header |= HEADER_SPLIT
+  }
+  if table.hasPawns {
+    header |= HEADER_HAS_PAWNS
+  }
+  out = append(out, header)
+  for file := 0; file < files; file++ {
+    var orders [2][2]int
+    for side := 0; side < sides; side++ {
+      orders[side] = table.pairs[side][file].order
+    }
+    out = append(out, byte(orders[0][0] | orders[1][0] << 4))
+    if table.hasPawns && table.pawnCount[1] > 0 {
+      out = append(out, byte(orders[0][1] | orders[1][1] << 4))
+    }
+    for i := 0; i < table.pieceCount; i++ {
+      b := byte(0)
+      for side := 0; side < sides; side++ {
+        b |= byte(table.pairs[side][file].pieces[i]) << (4 * side)
+      }
+      out = append(out, b)
+    }
+  }
+  out = pad(out, 2)
+
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      out = packed[side][file].header(out, table.pairs[side][file])
+    }
+  }
+  if table.kind == DTZ {
+    out = pad(out, 2) // no maps
+  }
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      for _, entry := range packed[side][file].sparse {
+        out = binary.LittleEndian.AppendUint32(out, uint32(entry[0]))
+        out = binary.LittleEndian.AppendUint16(out, uint16(entry[1]))
+      }
+    }
+  }
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      for _, length := range packed[side][file].blockLengths {
+        out = binary.LittleEndian.AppendUint16(out, uint16(length))
+      }
+    }
+  }
+  for file := 0; file < files; file++ {
+    for side := 0; side < sides; side++ {
+      out = pad(out, 64)
+      out = append(out, packed[side][file].blocks...)
+    }
+  }
+  _, err := w.Write(out)
+  return err
+}
+
+func pad(out []byte, to int) []byte {
+  for len(out) % to != 0 {
+    out = append(out, 0)
+  }
+  return out
+}
+
+// =================================== COMPRESSION ===================================
+// values are turned into a string of symbols, where a symbol is either a value or a pair of
+// symbols, and the symbols get canonical huffman codes that are packed into fixed size blocks
+type compressed struct {
+  single int // the value if there's only one, -1 otherwise
+  spanLog int
+  minLen, maxLen int
+  lowestSym []int
+  tree [][2]int // left and right of every symbol, a leaf has its value and 0xFFF
+  sparse [][2]int
+  blockLengths []int
+  numBlocks int
+  blocks []byte
+}
+
+func (c *compressed) header(out []byte, d *pairsData) []byte {
+  if c.single >= 0 {
+    return append(out, d.flags | FLAG_SINGLE_VALUE, byte(c.single))
+  }
+  out = append(out, d.flags, BLOCK_SIZE_LOG, byte(c.spanLog), byte(len(c.blockLengths) - c.numBlocks))
+  out = binary.LittleEndian.AppendUint32(out, uint32(c.numBlocks))
+  out = append(out, byte(c.maxLen), byte(c.minLen))
+  for _, sym := range c.lowestSym {
+    out = binary.LittleEndian.AppendUint16(out, uint16(sym))
+  }
+  out = binary.LittleEndian.AppendUint16(out, uint16(len(c.tree)))
+  for _, pair := range c.tree {
+    out = append(out, byte(pair[0]), byte(pair[0] >> 8 & 0xF | pair[1] & 0xF << 4), byte(pair[1] >> 4))
+  }
+  if len(c.tree) & 1 != 0 {
+    out = append(out, 0)
+  }
+  return out
+}
+
+type symbol struct {
+  left, right int
+  values int
+}
+
+func compress(values []uint16) (*compressed, error) {
+  // anything goes for a don't care, so it gets whatever's before it to make the runs longer
+  filled := make([]uint16, len(values))
+  last := uint16(DONT_CARE)
+  for _, value := range values {
+    if value != DONT_CARE {
+      last = value
+      break
+    }
+  }
+  single := true
+  for i, value := range values {
+    if value != DONT_CARE {
+      if value >= MAX_SYMBOLS {
+        return nil, fmt.Errorf("value %d is too big", value)
+      }
+      single = single && (last == value)
+      last = value
+    }
+    filled[i] = last
+  }
+  if single || len(values) == 0 {
+    if last == DONT_CARE {
+      last = 0
+    }
+    if last > 255 {
+      return nil, fmt.Errorf("value %d is too big", last)
+    }
+    return &compressed{ single: int(last) }, nil
+  }
+
+  symbols := []symbol{}
+  leaves := map[uint16]int32{}
+  seq := make([]int32, len(filled))
+  for i, value := range filled {
+    leaf, ok := leaves[value]
+    if !ok {
+      leaf = int32(len(symbols))
+      leaves[value] = leaf
+      symbols = append(symbols, symbol{ int(value), MAX_SYMBOLS, 1 })
+    }
+    seq[i] = leaf
+  }
+  seq = pairUp(seq, &symbols)
+
+  // huffman code lengths, with the counts halved until no code is longer than the decoder reads
+  counts := make([]int, len(symbols))
+  for _, sym := range seq {
+    counts[sym]++
+  }
+  var lengths []int
+  for {
+    lengths = codeLengths(counts)
+    longest := 0
+    for _, length := range lengths {
+      longest = max(longest, length)
+    }
+    if longest <= MAX_CODE_LENGTH {
+      break
+    }
+    for i := range counts {
+      if counts[i] > 0 {
+        counts[i] = (counts[i] + 1) / 2
+      }
+    }
+  }
+
+  // the longest codes get the lowest symbols, and symbols that are only ever inside pairs go last
+  ids := make([]int, len(symbols))
+  for i := range ids {
+    ids[i] = i
+  }
+  sort.SliceStable(ids, func(i, j int) bool {
+    a, b := lengths[ids[i]], lengths[ids[j]]
+    if (a == 0) != (b == 0) {
+      return b == 0
+    }
+    return a > b
+  })
+  renumber := make([]int, len(symbols))
+  for id, old := range ids {
+    renumber[old] = id
+  }
+
+  c := &compressed{ single: -1, minLen: MAX_CODE_LENGTH, maxLen: 1 }
+  for _, length := range lengths {
+    if length > 0 {
+      c.minLen = min(c.minLen, length)
+      c.maxLen = max(c.maxLen, length)
+    }
+  }
+  c.tree = make([][2]int, len(symbols))
+  for old, sym := range symbols {
+    if sym.right == MAX_SYMBOLS {
+      c.tree[renumber[old]] = [2]int{ sym.left, MAX_SYMBOLS }
+    } else {
+      c.tree[renumber[old]] = [2]int{ renumber[sym.left], renumber[sym.right] }
+    }
+  }
+  // lowestSym[i] is the first symbol with a code of length minLen + i, base[i] its code
+  perLength := make([]int, c.maxLen + 2)
+  for _, length := range lengths {
+    perLength[length]++
+  }
+  c.lowestSym = make([]int, c.maxLen - c.minLen + 1)
+  base := make([]uint64, len(c.lowestSym))
+  for length := c.maxLen - 1; length >= c.minLen; length-- {
+    i := length - c.minLen
+    c.lowestSym[i] = c.lowestSym[i + 1] + perLength[length + 1]
+    base[i] = (base[i + 1] + uint64(perLength[length + 1])) / 2
+  }
+  code := func(sym int) (uint64, int) {
+    length := lengths[ids[sym]]
+    i := length - c.minLen
+    return base[i] + uint64(sym - c.lowestSym[i]), length
+  }
+
+  // symbols go into blocks until the next one doesn't fit or the block has 65536 values
+  blockBits := 8 << BLOCK_SIZE_LOG
+  var block []byte
+  var blockStarts []uint64
+  used, blockValues, total := 0, 0, uint64(0)
+  var acc uint64
+  accBits := 0
+  flush := func() {
+    if accBits > 0 {
+      acc <<= 64 - accBits
+      for accBits > 0 {
+        block = append(block, byte(acc >> 56))
+        acc <<= 8
+        accBits -= 8
+      }
+    }
+    acc, accBits = 0, 0
+    for len(block) < 1 << BLOCK_SIZE_LOG {
+      block = append(block, 0)
+    }
+    c.blocks = append(c.blocks, block...)
+    c.blockLengths = append(c.blockLengths, blockValues - 1)
+    block, used, blockValues = nil, 0, 0
+  }
+  for _, old := range seq {
+    sym := renumber[old]
+    codeBits, length := code(sym)
+    n := symbols[old].values
+    if used + length > blockBits || blockValues + n > 1 << 16 {
+      flush()
+    }
+    if blockValues == 0 {
+      blockStarts = append(blockStarts, total)
+    }
+    used += length
+    for length > 0 {
+      take := min(length, 56 - accBits)
+      acc = acc << take | codeBits >> (length - take) & (1 << take - 1)
+      accBits += take
+      length -= take
+      for accBits >= 8 {
+        block = append(block, byte(acc >> (accBits - 8)))
+        accBits -= 8
+      }
+    }
+    blockValues += n
+    total += uint64(n)
+  }
+  flush()
+  c.numBlocks = len(c.blockLengths)
+  c.blockLengths = append(c.blockLengths, 0) // one padding block, for sparse entries past the end
+
+  // a sparse index entry for every span values, pointing at the middle of the span
+  perBlock := len(filled) / c.numBlocks
+  c.spanLog = min(max(bits.Len(uint(perBlock)) - 1, 1), 16)
+  span := uint64(1) << c.spanLog
+  for k := uint64(0); k * span < uint64(len(filled)); k++ {
+    target := k * span + span / 2
+    if target >= uint64(len(filled)) {
+      c.sparse = append(c.sparse, [2]int{ c.numBlocks, int(target - uint64(len(filled))) })
+      continue
+    }
+    block := sort.Search(len(blockStarts), func(i int) bool { return blockStarts[i] > target }) - 1
+    c.sparse = append(c.sparse, [2]int{ block, int(target - blockStarts[block]) })
+  }
+  return c, nil
+}
+
+// replaces the commonest pairs of neighbouring symbols with new symbols, a few at a time, until
+// no pair is common enough or there are as many symbols as the tree can have
+func pairUp(seq []int32, symbols *[]symbol) []int32 {
+  counts := make([]int32, MAX_SYMBOLS * MAX_SYMBOLS)
+  var touched []int32
+  for len(*symbols) < MAX_SYMBOLS && len(seq) > 1 {
+    touched = touched[:0]
+    counted := -2
+    for i := 0; i + 1 < len(seq); i++ {
+      // a run of one symbol only has half as many pairs as neighbours
+      if counted == i - 1 && seq[i - 1] == seq[i] && seq[i] == seq[i + 1] {
+        continue
+      }
+      key := seq[i] * MAX_SYMBOLS + seq[i + 1]
+      if counts[key] == 0 {
+        touched = append(touched, key)
+      }
+      counts[key]++
+      counted = i
+    }
+
+    // only the pairs common enough to be worth it get sorted
+    common := touched[:0:0]
+    for _, key := range touched {
+      if counts[key] >= MIN_PAIR_COUNT {
+        common = append(common, key)
+      }
+    }
+    sort.Slice(common, func(i, j int) bool {
+      if counts[common[i]] != counts[common[j]] {
+        return counts[common[i]] > counts[common[j]]
+      }
+      return common[i] < common[j]
+    })
+    for _, key := range touched {
+      counts[key] = 0
+    }
+    // a chosen pair's count is now minus its new symbol, less one
+    chosen := 0
+    for _, key := range common {
+      if chosen == 256 || len(*symbols) == MAX_SYMBOLS {
+        break
+      }
+      left, right := key / MAX_SYMBOLS, key % MAX_SYMBOLS
+      values := (*symbols)[left].values + (*symbols)[right].values
+      if values > MAX_SYMBOL_VALUES {
+        continue
+      }
+      counts[key] = -1 - int32(len(*symbols))
+      *symbols = append(*symbols, symbol{ int(left), int(right), values })
+      chosen++
+    }
+    if chosen == 0 {
+      break
+    }
+
+    out := seq[:0]
+    for i := 0; i < len(seq); i++ {
+      if i + 1 < len(seq) {
+        if sym := counts[seq[i] * MAX_SYMBOLS + seq[i + 1]]; sym < 0 {
+          out = append(out, -1 - sym)
+          i++
+          continue
+        }
+      }
+      out = append(out, seq[i])
+    }
+    seq = out
+    for _, key := range common {
+      counts[key] = 0
+    }
+  }
+  return seq
+}
+
+// =================================== HUFFMAN ===================================
+type huffmanNode struct {
+  count int
+  index int // a symbol, or -1 - the index of an inner node
+}
+
+type huffmanHeap []huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+  if h[i].count != h[j].count {
+    return h[i].count < h[j].count
+  }
+  return h[i].index < h[j].index
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any) { *h = append(*h, x.(huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+  old := *h
+  node := old[len(old) - 1]
+  *h = old[:len(old) - 1]
+  return node
+}
+
+// the code length of every symbol, 0 for those that are never written
+func codeLengths(counts []int) []int {
+  lengths := make([]int, len(counts))
+  h := &huffmanHeap{}
+  for sym, count := range counts {
+    if count > 0 {
+      *h = append(*h, huffmanNode{ count, sym })
+    }
+  }
+  if h.Len() == 1 {
+    lengths[(*h)[0].index] = 1
+    return lengths
+  }
+  heap.Init(h)
+  var parents []int // of symbols and inner nodes, inner nodes as -1 - index
+  symbolParent := make([]int, len(counts))
+  for h.Len() > 1 {
+    a := heap.Pop(h).(huffmanNode)
+    b := heap.Pop(h).(huffmanNode)
+    inner := len(parents)
+    parents = append(parents, -1)
+    for _, node := range []huffmanNode{ a, b } {
+      if node.index >= 0 {
+        symbolParent[node.index] = inner
+      } else {
+        parents[-1 - node.index] = inner
+      }
+    }
+    heap.Push(h, huffmanNode{ a.count + b.count, -1 - inner })
+  }
+  depth := make([]int, len(parents))
+  for i := len(parents) - 1; i >= 0; i-- {
+    if parents[i] >= 0 {
+      depth[i] = depth[parents[i]] + 1
+    }
+  }
+  for sym, count := range counts {
+    if count > 0 {
+      lengths[sym] = depth[symbolParent[sym]] + 1
+    }
+  }
+  return lengths
+}
@@ -0,0 +1,117 @@
+package utils
+
+// =================================== ATTACK MAPS ===================================
+// These return every square a piece standing on `square` attacks, using the same
+// layout as the Bitboard fields (bit 0 is a8, bit 63 is h1). Unlike the move
+// generators they don't care what is standing on the attacked squares.
+
+type direction struct {
+  step int      // positive shifts left (towards rank 1), negative shifts right (towards rank 8)
+  edge uint64   // squares the ray can't leave from without wrapping off the board
+  diagonal bool
+}
+
+var rayDirections = [8]direction{
+  { -8, RANK_8, false },          // up
+  { 8, RANK_1, false },           // down
+  { 1, H_File, false },           // right
+  { -1, A_File, false },          // left
+  { -7, RANK_8 | H_File, true },  // up right
+  { -9, RANK_8 | A_File, true },  // up left
+  { 9, RANK_1 | H_File, true },   // down right
+  { 7, RANK_1 | A_File, true },   // down left
+}
+
+func shiftSquare(square uint64, step int) uint64 {
+  if step > 0 {
+    return square << uint(step)
+  }
+  return square >> uint(-step)
+}
+
+// walks from square in one direction until it falls off the board or hits something in occupied
+func rayAttacks(square uint64, occupied uint64, dir direction) uint64 {
+  var attacks uint64
+  for square != 0 && (square & dir.edge) == 0 {
+    square = shiftSquare(square, dir.step)
+    attacks |= square
+    if (square & occupied) != 0 { break }
+  }
+  return attacks
+}
+
+func KnightAttacks(square uint64) uint64 {
+  return ((square << 17) &^ A_File) | ((square << 10) &^ AB_File) |
+    ((square << 15) &^ H_File) | ((square << 6) &^ GH_File) |
+    ((square >> 17) &^ H_File) | ((square >> 10) &^ GH_File) |
+    ((square >> 15) &^ A_File) | ((square >> 6) &^ AB_File)
+}
+
+func KingAttacks(square uint64) uint64 {
+  sides := ((square << 1) &^ A_File) | ((square >> 1) &^ H_File)
+  row := square | sides
+  return sides | (row << 8) | (row >> 8)
+}
+
+func PawnAttacks(square uint64, isWhite bool) uint64 {
+  if isWhite {
+    return ((square >> 7) &^ A_File) | ((square >> 9) &^ H_File)
+  }
+  return ((square << 7) &^ H_File) | ((square << 9) &^ A_File)
+}
+
+func RookAttacks(square uint64, occupied uint64) uint64 {
+  var attacks uint64
+  for _, dir := range rayDirections {
+    if !dir.diagonal {
+      attacks |= rayAttacks(square, occupied, dir)
+    }
+  }
+  return attacks
+}
+
+func BishopAttacks(square uint64, occupied uint64) uint64 {
+  var attacks uint64
+  for _, dir := range rayDirections {
+    if dir.diagonal {
+      attacks |= rayAttacks(square, occupied, dir)
+    }
+  }
+  return attacks
+}
+
+func QueenAttacks(square uint64, occupied uint64) uint64 {
+  return RookAttacks(square, occupied) | BishopAttacks(square, occupied)
+}
+
+// =================================== WHO IS ATTACKING ===================================
+func WhitePieces(bitboard *Bitboard) uint64 {
+  return bitboard.whitePawns | bitboard.whiteKnights | bitboard.whiteBishops | bitboard.whiteRooks | bitboard.whiteQueens | bitboard.whiteKing
+}
+
+func BlackPieces(bitboard *Bitboard) uint64 {
+  return bitboard.blackPawns | bitboard.blackKnights | bitboard.blackBishops | bitboard.blackRooks | bitboard.blackQueens | bitboard.blackKing
+}
+
+// returns the pieces of the given color that attack square
+func AttackersOf(square uint64, byWhite bool, bitboard *Bitboard) uint64 {
+  occupied := WhitePieces(bitboard) | BlackPieces(bitboard)
+
+  if byWhite {
+    return (KnightAttacks(square) & bitboard.whiteKnights) |
+      (PawnAttacks(square, false) & bitboard.whitePawns) |
+      (KingAttacks(square) & bitboard.whiteKing) |
+      (RookAttacks(square, occupied) & (bitboard.whiteRooks | bitboard.whiteQueens)) |
+      (BishopAttacks(square, occupied) & (bitboard.whiteBishops | bitboard.whiteQueens))
+  }
+
+  return (KnightAttacks(square) & bitboard.blackKnights) |
+    (PawnAttacks(square, true) & bitboard.blackPawns) |
+    (KingAttacks(square) & bitboard.blackKing) |
+    (RookAttacks(square, occupied) & (bitboard.blackRooks | bitboard.blackQueens)) |
+    (BishopAttacks(square, occupied) & (bitboard.blackBishops | bitboard.blackQueens))
+}
+
+func IsSquareAttacked(square uint64, byWhite bool, bitboard *Bitboard) bool {
+  return AttackersOf(square, byWhite, bitboard) != 0
+}
@@ -26,6 +26,10 @@ const (
   // this is for general use
   A_File uint64 = 0x0101010101010101
   B_File uint64 = 0x0202020202020202
+  C_File uint64 = 0x0404040404040404
+  D_File uint64 = 0x0808080808080808
+  E_File uint64 = 0x1010101010101010
+  F_File uint64 = 0x2020202020202020
   G_File uint64 = 0x4040404040404040
   H_File uint64 = 0x8080808080808080
   AB_File uint64 = 0x0303030303030303
@@ -54,6 +58,20 @@ type Bitboard struct {
   enPassant uint64
   whiteTurn bool
   mailbox []uint8
+  halfmoveClock int // moves since the last capture or pawn move, for the fifty move rule
+  fullmoveNumber int
+  history []boardHistory // one entry per move played, popped again by UnmakeMove
+  hash uint64 // zobrist hash of the position, see zobrist.go
+  startingFen string // where the moves in history were played from
+}
+
+// the move that was played plus the state from before it that can't be worked out again from the move itself
+type boardHistory struct {
+  move Move
+  castlingRights uint8
+  enPassant uint64
+  halfmoveClock int
+  hash uint64
 }
 
 
@@ -102,37 +120,110 @@ func GetMailBoxIndex(square uint64) int {
   return int(math.Log2(float64(square)))
 }
 
-func MakeMove(piece uint8, from uint64, to uint64, bitboard *Bitboard) {
-  // =================================== removing enemy pawn from enpassant ===================================
-  if (piece & 0x1 > 0) && (to & bitboard.enPassant) != 0 {
-    if (to & RANK_6) != 0 {
-      enemyPawn := to << 8
-      if piece == WHITE_PAWN {
-        bitboard.blackPawns &= ^enemyPawn
-        bitboard.mailbox[GetMailBoxIndex(enemyPawn)] = 0
-      } else {
-        bitboard.whitePawns &= ^enemyPawn
-        bitboard.mailbox[GetMailBoxIndex(enemyPawn)] = 0
-      }
-    } else if (to & RANK_3) != 0 {
-      enemyPawn := to >> 8
-      if piece == WHITE_PAWN {
-        bitboard.blackPawns &= ^enemyPawn
-        bitboard.mailbox[GetMailBoxIndex(enemyPawn)] = 0
-      } else {
-        bitboard.whitePawns &= ^enemyPawn
-        bitboard.mailbox[GetMailBoxIndex(enemyPawn)] = 0
-      }
-    }
+// returns the piece standing on the square (0 if it's empty)
+func PieceAt(bitboard *Bitboard, square uint64) uint8 {
+  if square == 0 {
+    return 0
+  }
+  return bitboard.mailbox[GetMailBoxIndex(square)]
+}
+
+func IsWhiteTurn(bitboard *Bitboard) bool {
+  return bitboard.whiteTurn
+}
+
+// how many plies into the game the position is, going by the move number. 0 is white's first move
+func GamePly(bitboard *Bitboard) int {
+  ply := (bitboard.fullmoveNumber - 1) * 2
+  if !bitboard.whiteTurn {
+    ply++
+  }
+  return ply
+}
+
+// returns every move played since the board was set up, oldest first
+func GetMoveHistory(bitboard *Bitboard) []Move {
+  moves := make([]Move, len(bitboard.history))
+  for i, entry := range bitboard.history {
+    moves[i] = entry.move
+  }
+  return moves
+}
+
+func GetStartingFEN(bitboard *Bitboard) string {
+  return bitboard.startingFen
+}
+
+// returns a copy that can be changed without touching the original board
+func CopyBitboard(bitboard *Bitboard) Bitboard {
+  copied := *bitboard
+  copied.mailbox = append([]uint8(nil), bitboard.mailbox...)
+  copied.history = append([]boardHistory(nil), bitboard.history...)
+  return copied
+}
+
+// plays the move and pushes everything UnmakeMove needs to take it back again
+func MakeMove(move Move, bitboard *Bitboard) {
+  piece, from, to := move.Piece(), move.From(), move.To()
+
+  // =================================== saving the history ===================================
+  bitboard.history = append(bitboard.history, boardHistory{
+    move: move,
+    castlingRights: bitboard.castlingRights,
+    enPassant: bitboard.enPassant,
+    halfmoveClock: bitboard.halfmoveClock,
+    hash: bitboard.hash,
+  })
+
+  // castling and en passant rights are xored back in once they're known after the move
+  bitboard.hash ^= castlingHash(bitboard.castlingRights) ^ enPassantHash(bitboard)
+
+  if (piece & 0x1 > 0) || move.IsCapture() {
+    bitboard.halfmoveClock = 0
+  } else {
+    bitboard.halfmoveClock++
+  }
+  if !bitboard.whiteTurn {
+    bitboard.fullmoveNumber++
+  }
+
+  // =================================== removing the captured piece ===================================
+  // for en passant that's the pawn beside the one that moved, not the square it moved to
+  if captured := move.Captured(); captured != 0 {
+    square := move.CaptureSquare()
+    togglePiece(bitboard, captured, square)
+    bitboard.mailbox[GetMailBoxIndex(square)] = 0
+  }
+
+  // =================================== moving the piece ===================================
+  togglePiece(bitboard, piece, from)
+  bitboard.mailbox[GetMailBoxIndex(from)] = 0
+
+  // =================================== Pawn Promotion ===================================
+  landing := piece
+  if move.IsPromotion() {
+    landing = move.Promotion()
+  }
+  togglePiece(bitboard, landing, to)
+  bitboard.mailbox[GetMailBoxIndex(to)] = landing
+
+  // ===================================== Moving the rook after castling =====================================
+  if move.IsCastling() {
+    rookFrom, rookTo := castlingRookSquares(move)
+    rook := bitboard.mailbox[GetMailBoxIndex(rookFrom)]
+    togglePiece(bitboard, rook, rookFrom)
+    togglePiece(bitboard, rook, rookTo)
+    bitboard.mailbox[GetMailBoxIndex(rookFrom)] = 0
+    bitboard.mailbox[GetMailBoxIndex(rookTo)] = rook
   }
 
   // =================================== updates enpassant rights ===================================
   bitboard.enPassant = 0
-  if piece == WHITE_PAWN && (from >> 16) == to {
+  if move.IsDoublePush() && piece == WHITE_PAWN {
     bitboard.enPassant = from >> 8
-  } else if piece == BLACK_PAWN && (from << 16) == to {
+  } else if move.IsDoublePush() {
     bitboard.enPassant = from << 8
-  } 
+  }
 
   // ===================================== updating castling rights =====================================
   bottomLeft := uint64(1) << 56
@@ -171,163 +262,159 @@ func MakeMove(piece uint8, from uint64, to uint64, bitboard *Bitboard) {
     bitboard.castlingRights &= 0x43 // 01000011
   }
 
-  // ===================================== Moving the rook after castling =====================================
-  if piece == WHITE_KING && (from << 2) == to {
-    if moveRook, ok := PieceMoveFuncs[WHITE_ROOK]; ok {
-      moveRook(bitboard, bottomRight, bottomRight >> 2)
-      bitboard.mailbox[int(math.Log2(float64(bottomRight)))] = 0
-      bitboard.mailbox[int(math.Log2(float64(bottomRight >> 2)))] = WHITE_ROOK
-    }
-  } else if piece == WHITE_KING && (from >> 2) == to {
-    if moveRook, ok := PieceMoveFuncs[WHITE_ROOK]; ok {
-      moveRook(bitboard, bottomLeft, bottomLeft << 3)
-      bitboard.mailbox[int(math.Log2(float64(bottomLeft)))] = 0
-      bitboard.mailbox[int(math.Log2(float64(bottomLeft << 3)))] = WHITE_ROOK
-    }
-  } else if piece == BLACK_KING && (from << 2) == to {
-    if moveRook, ok := PieceMoveFuncs[BLACK_ROOK]; ok {
-      moveRook(bitboard, topRight, topRight >> 2)
-      bitboard.mailbox[int(math.Log2(float64(topRight)))] = 0
-      bitboard.mailbox[int(math.Log2(float64(topRight >> 2)))] = BLACK_ROOK
-    }
-  } else if piece == BLACK_KING && (from >> 2) == to {
-    if moveRook, ok := PieceMoveFuncs[BLACK_ROOK]; ok {
-      moveRook(bitboard, topLeft, topLeft << 3)
-      bitboard.mailbox[int(math.Log2(float64(topLeft)))] = 0
-      bitboard.mailbox[int(math.Log2(float64(topLeft << 3)))] = BLACK_ROOK
-    }
+  // capturing a rook that never moved takes that side's castling right away too
+  if to == bottomRight {
+    bitboard.castlingRights &= 0xC2 // 11000010
+  } else if to == bottomLeft {
+    bitboard.castlingRights &= 0xC1 // 11000001
+  } else if to == topRight {
+    bitboard.castlingRights &= 0x43 // 01000011
+  } else if to == topLeft {
+    bitboard.castlingRights &= 0x83 // 10000011
   }
 
-  // Moving the pieces
-  toLocation := GetMailBoxIndex(to)
-  if capturePiece, ok := PieceCaptureFuncs[bitboard.mailbox[toLocation]]; ok {
-    capturePiece(bitboard, to)
+  bitboard.whiteTurn = !bitboard.whiteTurn
+  bitboard.hash ^= ZOBRIST_BLACK_TO_MOVE ^ castlingHash(bitboard.castlingRights) ^ enPassantHash(bitboard)
+  if DEBUG_HASH {
+    checkHash(bitboard, "MakeMove")
   }
+}
 
-  bitboard.mailbox[GetMailBoxIndex(from)] = 0
-  bitboard.mailbox[toLocation] = piece
-
-  if movePiece, ok := PieceMoveFuncs[piece]; ok {
-    movePiece(bitboard, from, to)
-    // =================================== Pawn Promotion ===================================
-    if piece == WHITE_PAWN && (to & RANK_8) != 0 {
-      bitboard.whitePawns ^= to
-      bitboard.whiteQueens |= to
-      bitboard.mailbox[toLocation] = WHITE_QUEEN
-    } else if piece == BLACK_PAWN && (to & RANK_1) != 0 {
-      bitboard.blackPawns ^= to
-      bitboard.blackQueens |= to
-      bitboard.mailbox[toLocation] = BLACK_QUEEN
-    }
-    // ====================================================================================== 
+// takes back the last move MakeMove played. Everything that can't be worked out from the move
+// itself (castling and en passant rights, the halfmove clock, the hash) comes off the history
+func UnmakeMove(bitboard *Bitboard) {
+  last := len(bitboard.history) - 1
+  if last < 0 {
+    return
   }
+  previous := bitboard.history[last]
+  bitboard.history = bitboard.history[:last]
+  move := previous.move
+  piece, from, to := move.Piece(), move.From(), move.To()
 
   bitboard.whiteTurn = !bitboard.whiteTurn
-  PrintGame(bitboard)
-}
-
-func UndoMove(movedPiece uint8, capturedPiece uint8, originalLocationOfMovedPiece uint64, newLocationOfMovedPiece uint64, bitboard *Bitboard) {
-  // =================================== Undoing the castling rights ===================================
-  bottomLeft := uint64(1) << 56
-  bottomRight := uint64(1) << 63
-  topLeft := uint64(1)
-  topRight := uint64(1) << 7
-
-  if movedPiece == WHITE_KING {
-    //bitboard.castlingRights |= 0xC0 // 11000000
-
-  } else if movedPiece == BLACK_KING {
-    //bitboard.castlingRights |= 0x3 // 00000011
-
-  } else if movedPiece == WHITE_ROOK && bitboard.whiteOnBottom && originalLocationOfMovedPiece == bottomRight {
-    bitboard.castlingRights |= 0xC2 // 11000010
-
-  } else if movedPiece == WHITE_ROOK && bitboard.whiteOnBottom && originalLocationOfMovedPiece == bottomLeft {
-    bitboard.castlingRights |= 0xC1 // 11000001
-
-  } else if movedPiece == WHITE_ROOK && !bitboard.whiteOnBottom && originalLocationOfMovedPiece == topLeft { 
-    bitboard.castlingRights |= 0xC2 // 11000010
+  if !bitboard.whiteTurn {
+    bitboard.fullmoveNumber--
+  }
 
-  } else if movedPiece == WHITE_ROOK && !bitboard.whiteOnBottom && originalLocationOfMovedPiece == topRight { 
-    bitboard.castlingRights |= 0xC1 // 11000001
+  // =================================== Undoing the castling move ===================================
+  if move.IsCastling() {
+    rookFrom, rookTo := castlingRookSquares(move)
+    rook := bitboard.mailbox[GetMailBoxIndex(rookTo)]
+    togglePiece(bitboard, rook, rookTo)
+    togglePiece(bitboard, rook, rookFrom)
+    bitboard.mailbox[GetMailBoxIndex(rookTo)] = 0
+    bitboard.mailbox[GetMailBoxIndex(rookFrom)] = rook
+  }
 
-  } else if movedPiece == BLACK_ROOK && bitboard.whiteOnBottom && originalLocationOfMovedPiece == topLeft {
-    bitboard.castlingRights |= 0x83 // 10000011
+  // =================================== Undoing the move and the pawn promotion ===================================
+  togglePiece(bitboard, bitboard.mailbox[GetMailBoxIndex(to)], to)
+  bitboard.mailbox[GetMailBoxIndex(to)] = 0
+  togglePiece(bitboard, piece, from)
+  bitboard.mailbox[GetMailBoxIndex(from)] = piece
 
-  } else if movedPiece == BLACK_ROOK && bitboard.whiteOnBottom && originalLocationOfMovedPiece == topRight {
-    bitboard.castlingRights |= 0x43 // 01000011
+  // =================================== Undoing the capture ===================================
+  if captured := move.Captured(); captured != 0 {
+    square := move.CaptureSquare()
+    togglePiece(bitboard, captured, square)
+    bitboard.mailbox[GetMailBoxIndex(square)] = captured
+  }
 
-  } else if movedPiece == BLACK_ROOK && !bitboard.whiteOnBottom && originalLocationOfMovedPiece == bottomLeft {
-    bitboard.castlingRights |= 0x83 // 10000011
+  // ================== Undoing the castling rights, enpassant rights and move clocks ==================
+  bitboard.castlingRights = previous.castlingRights
+  bitboard.enPassant = previous.enPassant
+  bitboard.halfmoveClock = previous.halfmoveClock
+  bitboard.hash = previous.hash
 
-  } else if movedPiece == BLACK_ROOK && !bitboard.whiteOnBottom && originalLocationOfMovedPiece == bottomRight {
-    bitboard.castlingRights |= 0x43 // 01000011
+  if DEBUG_HASH {
+    checkHash(bitboard, "UnmakeMove")
   }
+}
 
-  // =================================== Undoing the enpassant rights ===================================
+// =================================== NULL MOVE ===================================
+// passes the turn without moving anything, which the search uses to ask "is this position so
+// good that even doing nothing is enough?". The halfmove clock starts over so nothing before
+// the pass counts as a repetition. Has to be undone with UnmakeNullMove, not UnmakeMove
+func MakeNullMove(bitboard *Bitboard) {
+  bitboard.history = append(bitboard.history, boardHistory{
+    move: NO_MOVE,
+    castlingRights: bitboard.castlingRights,
+    enPassant: bitboard.enPassant,
+    halfmoveClock: bitboard.halfmoveClock,
+    hash: bitboard.hash,
+  })
+
+  bitboard.hash ^= enPassantHash(bitboard) ^ ZOBRIST_BLACK_TO_MOVE
   bitboard.enPassant = 0
+  bitboard.halfmoveClock = 0
+  bitboard.whiteTurn = !bitboard.whiteTurn
 
-  // =================================== Undoing the move ===================================
-  if move := PieceMoveFuncs[movedPiece]; move != nil {
-    move(bitboard, newLocationOfMovedPiece, originalLocationOfMovedPiece)
-  }
-
-  // =================================== Undoing the capture ===================================
-  if capture := PieceCaptureFuncs[capturedPiece]; capture != nil {
-    capture(bitboard, newLocationOfMovedPiece)
+  if DEBUG_HASH {
+    checkHash(bitboard, "MakeNullMove")
   }
+}
 
-  // =================================== Undoing the pawn promotion ===================================
-  if movedPiece == WHITE_PAWN && (newLocationOfMovedPiece & RANK_8) != 0 {
-    bitboard.whitePawns ^= newLocationOfMovedPiece
-    bitboard.whiteQueens ^= newLocationOfMovedPiece
-    bitboard.mailbox[GetMailBoxIndex(newLocationOfMovedPiece)] = 0
+func UnmakeNullMove(bitboard *Bitboard) {
+  last := len(bitboard.history) - 1
+  if last < 0 {
+    return
   }
+  previous := bitboard.history[last]
+  bitboard.history = bitboard.history[:last]
 
-  if movedPiece == BLACK_PAWN && (newLocationOfMovedPiece & RANK_1) != 0 {
-    bitboard.blackPawns ^= newLocationOfMovedPiece
-    bitboard.blackQueens ^= newLocationOfMovedPiece
-    bitboard.mailbox[GetMailBoxIndex(newLocationOfMovedPiece)] = 0
-  }
+  bitboard.whiteTurn = !bitboard.whiteTurn
+  bitboard.enPassant = previous.enPassant
+  bitboard.halfmoveClock = previous.halfmoveClock
+  bitboard.hash = previous.hash
+}
 
-  // =================================== Undoing the castling move ===================================
-  if movedPiece == WHITE_KING && (newLocationOfMovedPiece << 2) == originalLocationOfMovedPiece {
-    if moveRook, ok := PieceMoveFuncs[WHITE_ROOK]; ok {
-      moveRook(bitboard, bottomRight >> 2, bottomRight)
-      bitboard.mailbox[GetMailBoxIndex(bottomRight)] = WHITE_ROOK
-      bitboard.mailbox[GetMailBoxIndex(bottomRight >> 2)] = 0
-    }
+// where the rook starts and ends up when the king castles. The king lands on the g or c file and
+// the rook goes over it, from the corner to the square the king crossed
+func castlingRookSquares(move Move) (uint64, uint64) {
+  to := move.To()
+  if (move.From() << 2) == to {
+    return to << 1, to >> 1
   }
+  return to >> 2, to << 1
+}
 
-  if movedPiece == WHITE_KING && (newLocationOfMovedPiece >> 2) == originalLocationOfMovedPiece {
-    if moveRook, ok := PieceMoveFuncs[WHITE_ROOK]; ok {
-      moveRook(bitboard, bottomLeft << 3, bottomLeft)
-      bitboard.mailbox[GetMailBoxIndex(bottomLeft)] = WHITE_ROOK
-      bitboard.mailbox[GetMailBoxIndex(bottomLeft << 3)] = 0
-    }
+// adds a piece to its piece set, or takes it away if it's already there. The hash follows along
+func togglePiece(bitboard *Bitboard, piece uint8, square uint64) {
+  if set := pieceSet(bitboard, piece); set != nil {
+    *set ^= square
+    hashPiece(bitboard, piece, square)
   }
+}
 
-  if movedPiece == BLACK_KING && (newLocationOfMovedPiece << 2) == originalLocationOfMovedPiece {
-    if moveRook, ok := PieceMoveFuncs[BLACK_ROOK]; ok {
-      moveRook(bitboard, topRight >> 2, topRight)
-      bitboard.mailbox[GetMailBoxIndex(topRight)] = BLACK_ROOK
-      bitboard.mailbox[GetMailBoxIndex(topRight >> 2)] = 0
-    }
+// the bitboard that holds every piece of that type
+func pieceSet(bitboard *Bitboard, piece uint8) *uint64 {
+  switch piece {
+  case WHITE_PAWN: return &bitboard.whitePawns
+  case WHITE_KNIGHT: return &bitboard.whiteKnights
+  case WHITE_BISHOP: return &bitboard.whiteBishops
+  case WHITE_ROOK: return &bitboard.whiteRooks
+  case WHITE_QUEEN: return &bitboard.whiteQueens
+  case WHITE_KING: return &bitboard.whiteKing
+  case BLACK_PAWN: return &bitboard.blackPawns
+  case BLACK_KNIGHT: return &bitboard.blackKnights
+  case BLACK_BISHOP: return &bitboard.blackBishops
+  case BLACK_ROOK: return &bitboard.blackRooks
+  case BLACK_QUEEN: return &bitboard.blackQueens
+  case BLACK_KING: return &bitboard.blackKing
   }
+  return nil
+}
 
-  if movedPiece == BLACK_KING && (newLocationOfMovedPiece >> 2) == originalLocationOfMovedPiece {
-    if moveRook, ok := PieceMoveFuncs[BLACK_ROOK]; ok {
-      moveRook(bitboard, topLeft << 3, topLeft)
-      bitboard.mailbox[GetMailBoxIndex(topLeft)] = BLACK_ROOK
-      bitboard.mailbox[GetMailBoxIndex(topLeft << 3)] = 0
-    }
+// returns the squares the piece can legally move to (nothing if the piece isn't actually on that square)
+func GetValidMoves(typeOfPiece uint8, piece uint64, bitboard *Bitboard) []uint64 {
+  if piece == 0 || bitboard.mailbox[GetMailBoxIndex(piece)] != typeOfPiece {
+    return []uint64{}
   }
-
-  bitboard.whiteTurn = !bitboard.whiteTurn
-  PrintGame(bitboard)
+  return filterLegalMoves(typeOfPiece, piece, GetPseudoLegalMoves(typeOfPiece, piece, bitboard), bitboard)
 }
 
-func GetValidMoves(typeOfPiece uint8, piece uint64, bitboard *Bitboard) []uint64 {
+// returns the squares the piece can reach without caring if its own king is left in check
+func GetPseudoLegalMoves(typeOfPiece uint8, piece uint64, bitboard *Bitboard) []uint64 {
   if typeOfPiece & 0x2 > 0 {
     return GetKnightMoves(piece, bitboard, typeOfPiece == WHITE_KNIGHT)
 
@@ -418,6 +505,10 @@ func InitBoard(bitboard *Bitboard) {
   bitboard.castlingRights = 0xC3 // 11000011
   bitboard.whiteTurn = true;
   bitboard.whiteOnBottom = true;
+  bitboard.halfmoveClock = 0
+  bitboard.fullmoveNumber = 1
+  bitboard.history = nil
+  bitboard.startingFen = STARTING_FEN
 
   bitboard.mailbox = make([]uint8, 64)
   for i := 0; i < 8; i++ {
@@ -441,6 +532,7 @@ func InitBoard(bitboard *Bitboard) {
   bitboard.mailbox[61] = WHITE_BISHOP
   bitboard.mailbox[62] = WHITE_KNIGHT
   bitboard.mailbox[63] = WHITE_ROOK
+  bitboard.hash = ComputeHash(bitboard)
 }
 
 // =================================== PRINTING STUFF ===================================
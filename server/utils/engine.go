@@ -1,69 +1,698 @@
 package utils
 
-func RandomAI_move(bitboard *Bitboard, whiteTurn bool) (uint64, uint64) {
-  return 0, 0
+import (
+  "context"
+  "math"
+  "math/rand"
+  "slices"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+const (
+  MATE_SCORE int32 = 1000000 // a mate found n plies from the root scores MATE_SCORE - n
+  INFINITY int32 = MATE_SCORE + 1
+  MAX_PLY = 128
+)
+
+type SearchResult struct {
+  Move Move `json:"-"`
+  Score int32 `json:"score"` // from the point of view of the side to move
+  PV []Move `json:"-"` // the line the search expects, starting with Move
+  Depth int `json:"depth"`
+  Nodes uint64 `json:"nodes"`
+  Book bool `json:"book,omitempty"` // the move came out of the opening book, nothing was searched
+}
+
+// true if the score means somebody gets mated
+func IsMateScore(score int32) bool {
+  return score > MATE_SCORE - MAX_PLY || score < -MATE_SCORE + MAX_PLY
+}
+
+// how many moves (not plies) until the mate, negative when the side to move is getting mated
+func MateIn(score int32) int {
+  if score > 0 {
+    return int(MATE_SCORE - score + 1) / 2
+  }
+  return -int(MATE_SCORE + score) / 2
+}
+
+// =================================== TIME MANAGEMENT ===================================
+// what the engine is allowed to spend on a move. Zero values mean no limit, and a search with
+// no limits at all goes until MAX_DEPTH or until its context is cancelled
+type SearchLimits struct {
+  Depth int
+  MoveTime time.Duration // think for exactly this long
+  Remaining time.Duration // the clock of the side to move
+  Increment time.Duration
+  MovesToGo int // moves until the next time control, 0 for sudden death
+}
+
+const (
+  MAX_DEPTH = 64
+  DEFAULT_MOVES_TO_GO = 30 // how many more moves a sudden death game is assumed to last
+  MOVE_OVERHEAD = 20 * time.Millisecond // left on the clock for sending the move back
+)
+
+// works out when to stop starting new iterations (soft) and when to abandon the one that's
+// running (hard). Both are zero when there's no time limit
+func (limits SearchLimits) Budget() (soft time.Duration, hard time.Duration) {
+  if limits.MoveTime > 0 {
+    return limits.MoveTime, limits.MoveTime
+  }
+  if limits.Remaining <= 0 {
+    return 0, 0
+  }
+
+  movesToGo := limits.MovesToGo
+  if movesToGo <= 0 {
+    movesToGo = DEFAULT_MOVES_TO_GO
+  }
+  usable := limits.Remaining - MOVE_OVERHEAD
+  if usable < time.Millisecond {
+    usable = time.Millisecond
+  }
+
+  soft = usable / time.Duration(movesToGo) + limits.Increment / 2
+  hard = soft * 3 // an iteration that's already running gets some extra room
+  if hard > usable / 2 {
+    hard = usable / 2
+  }
+  if soft > hard {
+    soft = hard
+  }
+  return soft, hard
 }
 
-func AI_move(bitboard *Bitboard, whiteTurn bool, depth int) (uint64, uint64) {
-  from := uint64(0)
-  to := uint64(0)
+// =================================== SEARCH ===================================
+const (
+  STOP_CHECK_INTERVAL = 1023 // the context only gets looked at every 1024 nodes, it isn't free
+  MAX_THREADS = 256
+)
 
-  if whiteTurn { // we want a score that is high position for white
-    //var bestValue float32 = -500
-    //allWhiteMoves := GenerateAllMoves(bitboard, true)
-    //for _, move := range allWhiteMoves {
-      //bitboard.MakeMove(move)
-      //value := Minimax(bitboard, false, depth - 1)
-      //if value > bestValue {
-       // bestValue = value
-       // from = move.from
-       // to = move.to
-      //}
-      //bitboard.UndoMove(move)
-    //}
+// what the search can use besides the board. The zero value searches with nothing
+type SearchOptions struct {
+  TT *TranspositionTable // kept between searches so the next move starts with what this one learned
+  Features *SearchFeatures // nil is DEFAULT_FEATURES
+  Threads int // how many goroutines search at once, 0 is the same as 1. More than 1 isn't repeatable, see IterativeAI_move
+  Noise int32 // up to this many centipawns either way get added to every eval, to play worse on purpose
+  Book *Book // looked at before searching, nil plays without one
+  Tablebase *Tablebase // narrows down the root moves and ends lines inside the search, nil plays without one
+}
+
+// =================================== SELECTIVITY ===================================
+// everything that makes the search skip or shorten lines it thinks are pointless. Each of them
+// can be switched off on its own, so they can be played against each other to see what they're worth
+type SearchFeatures struct {
+  PVS bool // search every move after the first with a null window, and only re-search the ones that beat it
+  Aspiration bool // start each iteration with a small window around the last score
+  NullMove bool // pass, and if the opponent still can't get back to beta don't bother searching
+  LMR bool // search quiet moves late in the order less deep
+  Futility bool // near the leaves, skip quiet moves that can't bring the eval back up to alpha
+  ReverseFutility bool // near the leaves, stop when the eval is so far above beta a quiet move won't change it
+  CheckExtensions bool // search one ply deeper when in check
+}
+
+var DEFAULT_FEATURES = SearchFeatures{ true, true, true, true, true, true, true }
+
+const (
+  ASPIRATION_WINDOW int32 = 25 // centipawns either side of the last score, doubled every time it fails
+  ASPIRATION_DEPTH = 4 // the first few iterations are too quick and too jumpy to bother
+
+  NULL_MOVE_DEPTH = 3 // null move only saves anything with a few plies left to skip
+  FUTILITY_DEPTH = 2
+  REVERSE_FUTILITY_DEPTH = 3
+  REVERSE_FUTILITY_MARGIN int32 = 120 // per ply
+  LMR_DEPTH = 3
+  LMR_MOVES = 3 // the first few moves are never reduced, the ordering is good enough to trust them
+)
+
+// how much a node a few plies from the horizon can gain from one quiet move, by depth
+var FUTILITY_MARGINS = [FUTILITY_DEPTH + 1]int32{ 0, 150, 300 }
+
+// LMR_REDUCTIONS[depth][moveNumber] grows with the log of both, late moves at high depths get cut the most
+var LMR_REDUCTIONS [MAX_DEPTH + 1][64]int
+
+func init() {
+  for depth := 1; depth <= MAX_DEPTH; depth++ {
+    for moves := 1; moves < 64; moves++ {
+      LMR_REDUCTIONS[depth][moves] = int(0.75 + math.Log(float64(depth)) * math.Log(float64(moves)) / 2.25)
+    }
   }
+}
+
+type searcher struct {
+  bitboard *Bitboard
+  tt *TranspositionTable
+  pawns *PawnHashTable
+  features SearchFeatures
+  killers [MAX_PLY][2]Move
+  history historyTable
+  rootBest Move // best move of the last iteration, tried first at the root if there's no table
+  rootMoves []Move // the only moves searched at the root when the tablebase ruled out the rest, nil for all of them
+  tablebase *Tablebase
+  nodes uint64
+  sharedNodes *atomic.Uint64 // the helper threads count into this as they go, so the main one can report them
+  noise int32
+  noiseSeed uint64
+  ctx context.Context
+  stopped bool
+  cutShort bool // iterate stopped for the clock or the context instead of reaching its last depth
+}
+
+func newSearcher(bitboard *Bitboard, tt *TranspositionTable, features SearchFeatures) *searcher {
+  return &searcher{ bitboard: bitboard, tt: tt, pawns: NewPawnHashTable(DEFAULT_PAWN_HASH_ENTRIES), features: features }
+}
 
-  return from, to
+// searches depth plies ahead and returns the best move for whiteTurn, which has to be the side to move
+func AI_move(bitboard *Bitboard, whiteTurn bool, depth int) SearchResult {
+  if depth < 1 {
+    return SearchResult{}
+  }
+  return IterativeAI_move(context.Background(), bitboard, whiteTurn, SearchLimits{ Depth: depth }, SearchOptions{}, nil)
 }
 
-func Minimax(bitboard *Bitboard, whiteTurn bool, depth int) int32 {
-  if depth == 0 {
-    return Evaluate(bitboard)
+// searches one ply deeper at a time until the limits run out or ctx is cancelled, and returns the
+// result of the last iteration that finished. The first iteration always finishes so there's a move
+// to play even with no time left. report, if given, is called after every finished iteration
+func IterativeAI_move(ctx context.Context, bitboard *Bitboard, whiteTurn bool, limits SearchLimits, options SearchOptions, report func(SearchResult)) SearchResult {
+  if whiteTurn != bitboard.whiteTurn {
+    return SearchResult{}
   }
 
-  if whiteTurn {
+  if move := options.Book.Probe(bitboard); move != NO_MOVE {
+    return SearchResult{ Move: move, PV: []Move{ move }, Book: true }
+  }
 
-    var bestValue int32 = -500
-    //allMoveForWhite := GenerateAllMoves(bitboard, true)
-    //for _, move := range allMoveForWhite {
-      //MakeMove(move)
-      //bestValue = math.Max(bestValue, Minimax(bitboard, false, depth - 1))
-      //bitboard.UndoMove(move)
-    //}
-    return bestValue
+  // with few enough pieces the tables know which moves keep the result, and only those get searched
+  rootMoves, _ := options.Tablebase.RootMoves(bitboard)
 
-  } else {
+  start := time.Now()
+  soft, hard := limits.Budget()
+  if hard > 0 {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithDeadline(ctx, start.Add(hard))
+    defer cancel()
+  }
+
+  maxDepth := limits.Depth
+  if maxDepth <= 0 || maxDepth > MAX_DEPTH {
+    maxDepth = MAX_DEPTH
+  }
 
-    var bestValue int32 = 500
+  features := DEFAULT_FEATURES
+  if options.Features != nil {
+    features = *options.Features
+  }
+  threads := min(max(options.Threads, 1), MAX_THREADS)
+  tt := options.TT
+  if tt == nil && threads > 1 {
+    tt = NewTranspositionTable(DEFAULT_TT_MB) // the only way the threads help each other is through the table
+  }
+  if tt != nil {
+    tt.NewSearch()
+  }
+
+  // every thread has to see the same noise for the same position, or the table would mix them up
+  noiseSeed := rand.Uint64()
+
+  // ================= lazy smp =================
+  // the helpers search the same position on their own copies of the board, filling the shared
+  // table with results the main thread then finds. They stop when the main thread does
+  helperCtx, stopHelpers := context.WithCancel(ctx)
+  defer stopHelpers()
+  var helperNodes atomic.Uint64
+  helpers := make([]*searcher, threads - 1)
+  results := make([]SearchResult, threads - 1)
+  var wg sync.WaitGroup
+  for i := range helpers {
+    board := CopyBitboard(bitboard)
+    helpers[i] = newSearcher(&board, tt, features)
+    helpers[i].sharedNodes = &helperNodes
+    helpers[i].noise, helpers[i].noiseSeed = options.Noise, noiseSeed
+    helpers[i].tablebase, helpers[i].rootMoves = options.Tablebase, rootMoves
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      // every other helper starts a ply deeper, so they don't all finish the same depth at once
+      results[i] = helpers[i].iterate(helperCtx, 1 + (i + 1) % 2, maxDepth, start, 0, nil)
+    }(i)
+  }
+
+  s := newSearcher(bitboard, tt, features)
+  s.noise, s.noiseSeed = options.Noise, noiseSeed
+  s.tablebase, s.rootMoves = options.Tablebase, rootMoves
+  var progress func(SearchResult)
+  if report != nil {
+    progress = func(result SearchResult) {
+      result.Nodes += helperNodes.Load()
+      report(result)
+    }
+  }
+  best := s.iterate(ctx, 1, maxDepth, start, soft, progress)
+  stopHelpers()
+  wg.Wait()
+
+  // when the main thread ran to its last depth or to a mate its answer stands, however far the
+  // helpers got before they were stopped. When the clock cut it short, a helper that got further
+  // knows more and the deepest finished iteration wins, picked by betterResult so it never depends
+  // on which goroutine finished first. Even so more than one thread isn't repeatable: the threads
+  // read each other's table entries as they go, and which entries are there by then is down to
+  // timing. Only a single thread gives the same answer every time
+  nodes := s.nodes
+  for i, result := range results {
+    if s.cutShort && len(result.PV) > 0 && betterResult(result, best) {
+      best = result
+    }
+    nodes += helpers[i].nodes
+  }
+  best.Nodes = nodes
+  return best
+}
+
+// deeper first, then the higher score, then the lower move so there's never a tie
+func betterResult(a SearchResult, b SearchResult) bool {
+  switch {
+  case len(b.PV) == 0:
+    return true
+  case a.Depth != b.Depth:
+    return a.Depth > b.Depth
+  case a.Score != b.Score:
+    return a.Score > b.Score
+  default:
+    return a.Move < b.Move
+  }
+}
+
+// the iterative deepening loop of one thread, from firstDepth up to maxDepth
+func (s *searcher) iterate(ctx context.Context, firstDepth int, maxDepth int, start time.Time, soft time.Duration, report func(SearchResult)) SearchResult {
+  var best SearchResult
+  var pv []Move
+  for depth := firstDepth; depth <= maxDepth; depth++ {
+    if depth > 1 {
+      s.ctx = ctx
+    }
+    s.history.age()
+    score := s.aspirationSearch(depth, best.Score, &pv)
+    if s.stopped {
+      s.cutShort = true
+      break // a partial iteration only looked at some of the moves, its answer can't be trusted
+    }
+
+    best = SearchResult{ Score: score, PV: append([]Move(nil), pv...), Depth: depth, Nodes: s.nodes }
+    if len(pv) > 0 {
+      best.Move = pv[0]
+      s.rootBest = pv[0]
+    }
+    if report != nil {
+      report(best)
+    }
+
+    if len(pv) == 0 || (IsMateScore(score) && MATE_SCORE - abs32(score) <= int32(depth)) {
+      break // no legal moves, or a mate that's already been seen all the way to the end
+    }
+    if soft > 0 && time.Since(start) >= soft / 2 {
+      s.cutShort = depth < maxDepth
+      break // the next ply takes a few times as long as this one, it won't finish in time
+    }
+    if ctx.Err() != nil {
+      s.cutShort = depth < maxDepth
+      break
+    }
+  }
+
+  best.Nodes = s.nodes
+  return best
+}
+
+// searches the root with a window around the score of the last iteration, which makes for a lot
+// more cutoffs as long as the score doesn't move much. When it does, the window gets wider on the
+// side it fell out of until the score fits
+func (s *searcher) aspirationSearch(depth int, previous int32, pv *[]Move) int32 {
+  if !s.features.Aspiration || depth < ASPIRATION_DEPTH || IsMateScore(previous) {
+    return s.negamax(depth, 0, -INFINITY, INFINITY, pv)
+  }
+
+  delta := ASPIRATION_WINDOW
+  alpha, beta := previous - delta, previous + delta
+  for {
+    score := s.negamax(depth, 0, alpha, beta, pv)
+    if s.stopped {
+      return 0
+    }
+    if score <= alpha {
+      alpha = max32(score - delta, -INFINITY)
+    } else if score >= beta {
+      beta = min32(score + delta, INFINITY)
+    } else {
+      return score
+    }
+    delta *= 2
+    if delta > MATE_SCORE / 2 {
+      alpha, beta = -INFINITY, INFINITY
+    }
+  }
+}
+
+func min32(a int32, b int32) int32 {
+  if a < b {
+    return a
+  }
+  return b
+}
 
-    return bestValue
+func abs32(n int32) int32 {
+  if n < 0 {
+    return -n
+  }
+  return n
+}
 
+// true once the search has to unwind, whatever it returns after that gets thrown away
+func (s *searcher) shouldStop() bool {
+  if s.stopped {
+    return true
+  }
+  if s.nodes & STOP_CHECK_INTERVAL == 0 {
+    if s.sharedNodes != nil {
+      s.sharedNodes.Add(STOP_CHECK_INTERVAL + 1)
+    }
+    if s.ctx != nil && s.ctx.Err() != nil {
+      s.stopped = true
+    }
   }
+  return s.stopped
 }
 
-func Evaluate(bitboard *Bitboard) int32 { // positive is good for white, negative is good for black
-  var score int32 = 0
+// scores the position for the side to move, searching depth plies ahead. Only scores between
+// alpha and beta are exact: anything at or below alpha means "not good enough", anything at or
+// above beta means "too good, the opponent won't allow it". pv gets the best line from here
+func (s *searcher) negamax(depth int, ply int, alpha int32, beta int32, pv *[]Move) int32 {
+  bitboard := s.bitboard
+  inCheck := IsInCheck(bitboard, bitboard.whiteTurn)
+  if inCheck && s.features.CheckExtensions && ply < MAX_PLY {
+    depth++ // a check is forcing, it's worth seeing how it plays out
+  }
+  if depth <= 0 || ply >= MAX_PLY {
+    return s.quiescence(ply, alpha, beta, pv)
+  }
+
+  s.nodes++
+  *pv = (*pv)[:0]
+  if s.shouldStop() {
+    return 0
+  }
+  if ply > 0 && isDrawByRule(bitboard) {
+    return 0
+  }
+
+  // ================= transposition table =================
+  // the root always gets searched so there's a move and a pv to hand back
+  var hashMove Move
+  if s.tt != nil {
+    if entry, ok := s.tt.Probe(bitboard.hash, ply); ok {
+      hashMove = entry.Move
+      if ply > 0 && int(entry.Depth) >= depth {
+        if entry.Bound == BOUND_EXACT ||
+          (entry.Bound == BOUND_LOWER && entry.Score >= beta) ||
+          (entry.Bound == BOUND_UPPER && entry.Score <= alpha) {
+          if entry.Move != NO_MOVE {
+            *pv = append(*pv, entry.Move)
+          }
+          return entry.Score
+        }
+      }
+    }
+  }
+
+  if ply == 0 && hashMove == NO_MOVE {
+    hashMove = s.rootBest
+  }
+
+  // ================= tablebases =================
+  // only right after a capture or pawn move: anywhere else the fifty move rule could have turned
+  // the result into a draw the tables can't know about. A result that can't end the search here
+  // still bounds what the moves below can score
+  floor, ceiling := -INFINITY, INFINITY
+  if ply > 0 && bitboard.halfmoveClock == 0 {
+    if wdl, ok := s.tablebase.ProbeWDL(bitboard); ok {
+      score, bound := tablebaseScore(wdl)
+      if bound == BOUND_EXACT || (bound == BOUND_LOWER && score >= beta) || (bound == BOUND_UPPER && score <= alpha) {
+        if s.tt != nil {
+          s.tt.Store(bitboard.hash, ply, min(depth + TB_DEPTH_BONUS, MAX_DEPTH), bound, score, NO_MOVE)
+        }
+        return score
+      }
+      if bound == BOUND_LOWER {
+        floor = score
+      } else {
+        ceiling = score
+      }
+    }
+  }
+
+  // ================= pruning =================
+  // only outside the pv, where a window of one tells us all that's wanted is a yes or a no
+  var childPV []Move
+  pvNode := beta - alpha > 1
+  staticEval := -INFINITY
+  if !inCheck {
+    staticEval = s.evaluate()
+  }
+
+  if !pvNode && !inCheck && !IsMateScore(beta) {
+    if s.features.ReverseFutility && depth <= REVERSE_FUTILITY_DEPTH && staticEval - REVERSE_FUTILITY_MARGIN * int32(depth) >= beta {
+      return staticEval
+    }
+
+    // the zugzwang guards: with only pawns left passing can really be the best move, and two
+    // passes in a row would just be the same position searched shallower
+    if s.features.NullMove && depth >= NULL_MOVE_DEPTH && staticEval >= beta &&
+      hasPieces(bitboard, bitboard.whiteTurn) && !lastMoveWasNull(bitboard) {
+      reduction := 2
+      if depth > 6 {
+        reduction = 3
+      }
+      MakeNullMove(bitboard)
+      score := -s.negamax(depth - 1 - reduction, ply + 1, -beta, -beta + 1, &childPV)
+      UnmakeNullMove(bitboard)
+      if s.stopped {
+        return 0
+      }
+      if score >= beta {
+        if IsMateScore(score) {
+          score = beta // a mate found after passing isn't a real mate
+        }
+        return score
+      }
+    }
+  }
+
+  futile := s.features.Futility && !pvNode && !inCheck && depth <= FUTILITY_DEPTH &&
+    !IsMateScore(alpha) && staticEval + FUTILITY_MARGINS[depth] <= alpha
+
+  originalAlpha := alpha
+  bestScore := -INFINITY
+  var bestMove Move
+  legalMoves := 0
+  picker := newMovePicker(bitboard, hashMove, s.killers[ply], &s.history)
+  for move, ok := picker.next(); ok; move, ok = picker.next() {
+    if ply == 0 && s.rootMoves != nil && !slices.Contains(s.rootMoves, move) {
+      continue
+    }
+    legalMoves++
+    quiet := !isTactical(move)
+    MakeMove(move, bitboard)
+    givesCheck := IsInCheck(bitboard, bitboard.whiteTurn)
 
-  for i := 0; i < 64; i++ {
-    if bitboard.mailbox[i] == 0 {
+    if futile && quiet && !givesCheck && legalMoves > 1 {
+      UnmakeMove(bitboard)
+      if staticEval + FUTILITY_MARGINS[depth] > bestScore {
+        bestScore = staticEval + FUTILITY_MARGINS[depth] // what the move could have been worth at most
+      }
       continue
     }
-    score += PIECE_TO_VALUE[bitboard.mailbox[i]] + PIECE_TO_TABLE[bitboard.mailbox[i]][i]
+
+    reduction := 0
+    if s.features.LMR && depth >= LMR_DEPTH && legalMoves > LMR_MOVES && quiet && !inCheck && !givesCheck &&
+      move != s.killers[ply][0] && move != s.killers[ply][1] {
+      reduction = LMR_REDUCTIONS[min(depth, MAX_DEPTH)][min(legalMoves, 63)]
+      if pvNode {
+        reduction--
+      }
+      reduction = max(0, min(reduction, depth - 2)) // always leave at least one ply
+    }
+
+    var score int32
+    if legalMoves == 1 || (!s.features.PVS && reduction == 0) {
+      score = -s.negamax(depth - 1, ply + 1, -beta, -alpha, &childPV)
+    } else {
+      // a move that isn't expected to be best only has to be shown to be no better than alpha
+      low := -beta
+      if s.features.PVS {
+        low = -alpha - 1
+      }
+      score = -s.negamax(depth - 1 - reduction, ply + 1, low, -alpha, &childPV)
+      if reduction > 0 && score > alpha {
+        score = -s.negamax(depth - 1, ply + 1, low, -alpha, &childPV)
+      }
+      if s.features.PVS && score > alpha && score < beta {
+        score = -s.negamax(depth - 1, ply + 1, -beta, -alpha, &childPV)
+      }
+    }
+    UnmakeMove(bitboard)
+    if s.stopped {
+      return 0
+    }
+
+    if score > bestScore {
+      bestScore, bestMove = score, move
+    }
+    if score > alpha {
+      alpha = score
+      *pv = append(append((*pv)[:0], move), childPV...)
+      if alpha >= beta {
+        if !isTactical(move) {
+          s.storeKiller(move, ply)
+          s.history.add(move, depth)
+        }
+        break
+      }
+    }
   }
 
-  // calculate the pawn structure score (isolated, doubled, passed)
-  // calculate the mobility score
-  // calculate the rook on open file score
+  if legalMoves == 0 {
+    if IsInCheck(bitboard, bitboard.whiteTurn) {
+      return -MATE_SCORE + int32(ply) // getting mated later is better than getting mated now
+    }
+    return 0
+  }
+  bestScore = min32(max32(bestScore, floor), ceiling)
 
-  return score
+  if s.tt != nil {
+    bound := BOUND_EXACT
+    if bestScore <= originalAlpha {
+      bound, bestMove = BOUND_UPPER, NO_MOVE // every move failed low, none of them is known to be best
+    } else if bestScore >= beta {
+      bound = BOUND_LOWER
+    }
+    s.tt.Store(bitboard.hash, ply, depth, bound, bestScore, bestMove)
+  }
+
+  return bestScore
+}
+
+// =================================== QUIESCENCE ===================================
+// stopping dead at depth 0 means a queen that just took a pawn looks like a pawn up even if it
+// gets taken right back. Past the horizon only captures and promotions get searched, until the
+// position is quiet. The side to move can always "stand pat" and take the static eval instead,
+// since nobody is forced to capture. In check there's no standing pat, every evasion is looked at
+func (s *searcher) quiescence(ply int, alpha int32, beta int32, pv *[]Move) int32 {
+  bitboard := s.bitboard
+  s.nodes++
+  *pv = (*pv)[:0]
+  if s.shouldStop() {
+    return 0
+  }
+  if ply > 0 && isDrawByRule(bitboard) {
+    return 0
+  }
+
+  inCheck := IsInCheck(bitboard, bitboard.whiteTurn)
+  if ply >= MAX_PLY {
+    return s.evaluate()
+  }
+
+  bestScore := -INFINITY
+  if !inCheck {
+    bestScore = s.evaluate()
+    if bestScore >= beta {
+      return bestScore
+    }
+    if bestScore > alpha {
+      alpha = bestScore
+    }
+  }
+
+  // in check every evasion gets searched, otherwise only the captures that don't lose material
+  picker := newTacticalPicker(bitboard)
+  if inCheck {
+    picker = newMovePicker(bitboard, NO_MOVE, [2]Move{}, nil)
+  }
+
+  var childPV []Move
+  legalMoves := 0
+  for move, ok := picker.next(); ok; move, ok = picker.next() {
+    legalMoves++
+    MakeMove(move, bitboard)
+    score := -s.quiescence(ply + 1, -beta, -alpha, &childPV)
+    UnmakeMove(bitboard)
+    if s.stopped {
+      return 0
+    }
+
+    if score > bestScore {
+      bestScore = score
+    }
+    if score > alpha {
+      alpha = score
+      *pv = append(append((*pv)[:0], move), childPV...)
+      if alpha >= beta {
+        break
+      }
+    }
+  }
+
+  if inCheck && legalMoves == 0 {
+    return -MATE_SCORE + int32(ply)
+  }
+  return bestScore
+}
+
+// true if the side has something other than pawns and its king
+func hasPieces(bitboard *Bitboard, isWhite bool) bool {
+  if isWhite {
+    return bitboard.whiteKnights | bitboard.whiteBishops | bitboard.whiteRooks | bitboard.whiteQueens != 0
+  }
+  return bitboard.blackKnights | bitboard.blackBishops | bitboard.blackRooks | bitboard.blackQueens != 0
+}
+
+func lastMoveWasNull(bitboard *Bitboard) bool {
+  return len(bitboard.history) > 0 && bitboard.history[len(bitboard.history) - 1].move == NO_MOVE
+}
+
+// a quiet move that caused a cutoff will probably cause one in the sibling positions too
+func (s *searcher) storeKiller(move Move, ply int) {
+  if s.killers[ply][0] != move {
+    s.killers[ply][1] = s.killers[ply][0]
+    s.killers[ply][0] = move
+  }
+}
+
+// draws the search can see without looking at the moves: fifty moves, repetition and dead material.
+// Inside the search a single repetition is enough, since whoever could avoid it would have already
+func isDrawByRule(bitboard *Bitboard) bool {
+  return bitboard.halfmoveClock >= 100 || RepetitionCount(bitboard) >= 2 || IsInsufficientMaterial(bitboard)
+}
+
+// the static eval from the side to move's point of view, with the pawn structure coming out of
+// this search's own pawn table
+func (s *searcher) evaluate() int32 {
+  score := evaluate(s.bitboard, s.pawns) + s.evalNoise()
+  if s.bitboard.whiteTurn {
+    return score
+  }
+  return -score
+}
+
+// a made up adjustment between -noise and +noise that's always the same for the same position
+// within one search, so the search stays consistent with itself while it plays the wrong moves
+func (s *searcher) evalNoise() int32 {
+  if s.noise <= 0 {
+    return 0
+  }
+  mixed := (s.bitboard.hash ^ s.noiseSeed) * 0x9E3779B97F4A7C15
+  mixed ^= mixed >> 31
+  return int32(mixed % uint64(2 * s.noise + 1)) - s.noise
 }
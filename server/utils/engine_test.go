@@ -0,0 +1,303 @@
+package utils
+
+import (
+  "context"
+  "runtime"
+  "testing"
+  "time"
+)
+
+var searchPositions = []struct {
+  name string
+  fen string
+  depth int
+  best string // in UCI notation, empty when any move will do
+  mateIn int // 0 when the position isn't a forced mate
+}{
+  {
+    name: "back rank mate",
+    fen: "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1",
+    depth: 2,
+    best: "a1a8",
+    mateIn: 1,
+  },
+  {
+    name: "black mates too",
+    fen: "r5k1/8/8/8/8/8/5PPP/6K1 b - - 0 1",
+    depth: 2,
+    best: "a8a1",
+    mateIn: 1,
+  },
+  {
+    name: "getting mated",
+    fen: "7r/8/8/8/8/8/2k5/K7 w - - 0 1",
+    depth: 3,
+    mateIn: -1,
+  },
+  {
+    name: "two rook ladder",
+    fen: "7k/8/8/8/8/8/R7/1R4K1 w - - 0 1",
+    depth: 4,
+    mateIn: 2,
+  },
+}
+
+func TestSearch(t *testing.T) {
+  for _, position := range searchPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatalf("%s: %v", position.name, err)
+    }
+    fen := GetFEN(&board)
+
+    result := AI_move(&board, IsWhiteTurn(&board), position.depth)
+    if GetFEN(&board) != fen {
+      t.Errorf("%s: the search changed the board to %s", position.name, GetFEN(&board))
+    }
+    if position.best != "" && MoveToUCI(result.Move) != position.best {
+      t.Errorf("%s: best move %s, want %s", position.name, MoveToUCI(result.Move), position.best)
+    }
+    if position.mateIn != 0 && (!IsMateScore(result.Score) || MateIn(result.Score) != position.mateIn) {
+      t.Errorf("%s: score %d, want mate in %d", position.name, result.Score, position.mateIn)
+    }
+    if len(result.PV) == 0 || result.PV[0] != result.Move {
+      t.Errorf("%s: pv doesn't start with the best move", position.name)
+    }
+  }
+}
+
+func TestSearchStalemateIsADraw(t *testing.T) {
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1"); err != nil {
+    t.Fatal(err)
+  }
+  result := AI_move(&board, false, 3)
+  if result.Score != 0 || len(result.PV) != 0 {
+    t.Errorf("stalemate scored %d with pv %v", result.Score, result.PV)
+  }
+}
+
+func TestBudget(t *testing.T) {
+  soft, hard := SearchLimits{ MoveTime: 500 * time.Millisecond }.Budget()
+  if soft != 500 * time.Millisecond || hard != 500 * time.Millisecond {
+    t.Errorf("movetime budget %v/%v, want 500ms/500ms", soft, hard)
+  }
+
+  soft, hard = SearchLimits{}.Budget()
+  if soft != 0 || hard != 0 {
+    t.Errorf("no limits gave a budget of %v/%v", soft, hard)
+  }
+
+  limits := SearchLimits{ Remaining: 60 * time.Second, Increment: time.Second }
+  soft, hard = limits.Budget()
+  if soft <= 0 || soft > hard || hard > limits.Remaining / 2 {
+    t.Errorf("clock budget %v/%v out of range for %v + %v", soft, hard, limits.Remaining, limits.Increment)
+  }
+
+  // almost flagging still leaves something to search with
+  soft, hard = SearchLimits{ Remaining: 5 * time.Millisecond }.Budget()
+  if soft <= 0 || hard <= 0 {
+    t.Errorf("low clock budget %v/%v", soft, hard)
+  }
+}
+
+func TestSearchCancelled(t *testing.T) {
+  var board Bitboard
+  InitBoard(&board)
+  fen := GetFEN(&board)
+
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+  result := IterativeAI_move(ctx, &board, true, SearchLimits{}, SearchOptions{}, nil)
+  if result.Depth != 1 || result.Move == NO_MOVE {
+    t.Errorf("a cancelled search should still finish depth 1, got depth %d move %s", result.Depth, MoveToUCI(result.Move))
+  }
+  if GetFEN(&board) != fen {
+    t.Errorf("the search changed the board to %s", GetFEN(&board))
+  }
+}
+
+func TestSearchMoveTime(t *testing.T) {
+  var board Bitboard
+  InitBoard(&board)
+  fen := GetFEN(&board)
+
+  // the budget itself is checked in TestBudget. A loaded machine can overshoot it by a lot, so
+  // the clock only catches a search that ignores the limit altogether
+  limits := SearchLimits{ MoveTime: 200 * time.Millisecond }
+  var iterations []int
+  start := time.Now()
+  result := IterativeAI_move(context.Background(), &board, true, limits, SearchOptions{}, func(result SearchResult) {
+    iterations = append(iterations, result.Depth)
+  })
+  elapsed := time.Since(start)
+
+  if _, hard := limits.Budget(); elapsed > 10 * hard {
+    t.Errorf("a %v search took %v", limits.MoveTime, elapsed)
+  }
+  if result.Depth >= MAX_DEPTH {
+    t.Errorf("searched to depth %d, the clock never stopped it", result.Depth)
+  }
+  if len(iterations) == 0 || iterations[len(iterations) - 1] != result.Depth {
+    t.Errorf("returned depth %d, but the finished iterations were %v", result.Depth, iterations)
+  }
+  if GetFEN(&board) != fen {
+    t.Errorf("the search changed the board to %s", GetFEN(&board))
+  }
+}
+
+// switching any of the selective search features off (or all of them) mustn't change what
+// gets found in the search positions
+func TestSearchFeatureToggles(t *testing.T) {
+  configs := map[string]SearchFeatures{ "all on": DEFAULT_FEATURES, "all off": {} }
+  names := []string{ "pvs", "aspiration", "null move", "lmr", "futility", "reverse futility", "check extensions" }
+  for i, name := range names {
+    features := DEFAULT_FEATURES
+    switch i {
+    case 0: features.PVS = false
+    case 1: features.Aspiration = false
+    case 2: features.NullMove = false
+    case 3: features.LMR = false
+    case 4: features.Futility = false
+    case 5: features.ReverseFutility = false
+    case 6: features.CheckExtensions = false
+    }
+    configs["no " + name] = features
+  }
+
+  for config, features := range configs {
+    features := features
+    for _, position := range searchPositions {
+      var board Bitboard
+      if err := InitBoardFromFEN(&board, position.fen); err != nil {
+        t.Fatal(err)
+      }
+      limits := SearchLimits{ Depth: position.depth }
+      result := IterativeAI_move(context.Background(), &board, IsWhiteTurn(&board), limits, SearchOptions{ Features: &features }, nil)
+      if position.best != "" && MoveToUCI(result.Move) != position.best {
+        t.Errorf("%s, %s: best move %s, want %s", config, position.name, MoveToUCI(result.Move), position.best)
+      }
+      if position.mateIn != 0 && (!IsMateScore(result.Score) || MateIn(result.Score) != position.mateIn) {
+        t.Errorf("%s, %s: score %d, want mate in %d", config, position.name, result.Score, position.mateIn)
+      }
+    }
+  }
+}
+
+func TestSelectivityCutsTheTree(t *testing.T) {
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, perftPositions[1].fen); err != nil {
+    t.Fatal(err)
+  }
+
+  none := SearchFeatures{}
+  full := IterativeAI_move(context.Background(), &board, true, SearchLimits{ Depth: 5 }, SearchOptions{ Features: &none }, nil)
+  selective := IterativeAI_move(context.Background(), &board, true, SearchLimits{ Depth: 5 }, SearchOptions{}, nil)
+  if selective.Nodes >= full.Nodes {
+    t.Errorf("%d nodes with everything on, %d with everything off", selective.Nodes, full.Nodes)
+  }
+}
+
+func TestLazySMPFindsTheSameMoves(t *testing.T) {
+  for _, position := range searchPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    fen := GetFEN(&board)
+
+    limits := SearchLimits{ Depth: position.depth }
+    result := IterativeAI_move(context.Background(), &board, IsWhiteTurn(&board), limits, SearchOptions{ Threads: 4 }, nil)
+    if GetFEN(&board) != fen {
+      t.Errorf("%s: the search changed the board to %s", position.name, GetFEN(&board))
+    }
+    if position.best != "" && MoveToUCI(result.Move) != position.best {
+      t.Errorf("%s: best move %s, want %s", position.name, MoveToUCI(result.Move), position.best)
+    }
+    if position.mateIn != 0 && (!IsMateScore(result.Score) || MateIn(result.Score) != position.mateIn) {
+      t.Errorf("%s: score %d, want mate in %d", position.name, result.Score, position.mateIn)
+    }
+    if len(result.PV) == 0 || result.PV[0] != result.Move {
+      t.Errorf("%s: pv doesn't start with the best move", position.name)
+    }
+  }
+}
+
+// the threads share a table, so the nodes they search differ from run to run, but a fixed depth
+// search of a forced line has to come back with the same score, and the same move when only one works
+func TestLazySMPIsConsistent(t *testing.T) {
+  for _, position := range searchPositions {
+    var first SearchResult
+    for run := 0; run < 5; run++ {
+      var board Bitboard
+      if err := InitBoardFromFEN(&board, position.fen); err != nil {
+        t.Fatal(err)
+      }
+      limits := SearchLimits{ Depth: position.depth }
+      result := IterativeAI_move(context.Background(), &board, IsWhiteTurn(&board), limits, SearchOptions{ Threads: 4 }, nil)
+      if result.Depth > position.depth || len(result.PV) == 0 {
+        t.Errorf("%s: run %d came back from depth %d with pv %v", position.name, run, result.Depth, result.PV)
+      }
+      if run == 0 {
+        first = result
+        continue
+      }
+      // how deep it had to go to see the mate can change with what's in the table by then
+      if result.Score != first.Score || (position.best != "" && result.Move != first.Move) {
+        t.Errorf("%s: run %d gave %s %d, the first run %s %d", position.name, run,
+          MoveToUCI(result.Move), result.Score, MoveToUCI(first.Move), first.Score)
+      }
+    }
+  }
+}
+
+func TestBetterResult(t *testing.T) {
+  move := func(i int) Move { return Move(i) }
+  shallow := SearchResult{ Move: move(1), PV: []Move{ move(1) }, Depth: 4, Score: 90 }
+  deep := SearchResult{ Move: move(2), PV: []Move{ move(2) }, Depth: 5, Score: 10 }
+  higher := SearchResult{ Move: move(3), PV: []Move{ move(3) }, Depth: 5, Score: 20 }
+  lower := SearchResult{ Move: move(1), PV: []Move{ move(1) }, Depth: 5, Score: 20 }
+
+  if !betterResult(deep, shallow) || betterResult(shallow, deep) {
+    t.Error("the deeper result didn't win")
+  }
+  if !betterResult(higher, deep) || betterResult(deep, higher) {
+    t.Error("the higher score didn't win at the same depth")
+  }
+  if !betterResult(lower, higher) || betterResult(higher, lower) {
+    t.Error("the lower move didn't break the tie")
+  }
+  if !betterResult(shallow, SearchResult{}) {
+    t.Error("an empty result beat a real one")
+  }
+}
+
+// cancelling has to bring every helper back before the search returns
+func TestLazySMPStopsCleanly(t *testing.T) {
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, perftPositions[1].fen); err != nil {
+    t.Fatal(err)
+  }
+  before := runtime.NumGoroutine()
+
+  ctx, cancel := context.WithCancel(context.Background())
+  time.AfterFunc(100 * time.Millisecond, cancel)
+  tt := NewTranspositionTable(1)
+  started := time.Now()
+  result := IterativeAI_move(ctx, &board, true, SearchLimits{}, SearchOptions{ TT: tt, Threads: 4 }, func(SearchResult) {
+    tt.Hashfull() // reads the table while the helpers are writing to it
+  })
+
+  if elapsed := time.Since(started); elapsed > 2 * time.Second {
+    t.Errorf("took %v to stop", elapsed)
+  }
+  if result.Move == NO_MOVE {
+    t.Error("no move after cancelling")
+  }
+  if after := runtime.NumGoroutine(); after > before {
+    t.Errorf("%d goroutines before the search, %d after", before, after)
+  }
+  if GetFEN(&board) != perftPositions[1].fen {
+    t.Errorf("the search changed the board to %s", GetFEN(&board))
+  }
+}
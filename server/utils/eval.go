@@ -0,0 +1,352 @@
+package utils
+
+import (
+  "math/bits"
+)
+
+// =================================== WEIGHTS ===================================
+// every term of the eval has a middlegame and an endgame weight in centipawns, blended by the
+// game phase just like the piece square tables. Setting a weight to zero turns the term off
+
+type Weight struct {
+  MG int32 `json:"mg"`
+  EG int32 `json:"eg"`
+}
+
+// adds count times w
+func (s *Weight) add(w Weight, count int32) {
+  s.MG += w.MG * count
+  s.EG += w.EG * count
+}
+
+type EvalWeights struct {
+  DoubledPawn Weight `json:"doubled_pawn"` // for every pawn past the first on a file
+  IsolatedPawn Weight `json:"isolated_pawn"` // no pawns of its own on the files next to it
+  PassedPawn [8]Weight `json:"passed_pawn"` // by rank counted from the pawn's own side, so index 1 is its starting rank
+
+  KnightMobility Weight `json:"knight_mobility"` // per square the piece can go to
+  BishopMobility Weight `json:"bishop_mobility"`
+  RookMobility Weight `json:"rook_mobility"`
+  QueenMobility Weight `json:"queen_mobility"`
+
+  RookOpenFile Weight `json:"rook_open_file"` // no pawns at all on the rook's file
+  RookSemiOpenFile Weight `json:"rook_semi_open_file"` // only enemy pawns on it
+
+  PawnShield Weight `json:"pawn_shield"` // per pawn on the two ranks in front of the king
+  KnightKingAttack Weight `json:"knight_king_attack"` // per piece attacking the squares around the enemy king
+  BishopKingAttack Weight `json:"bishop_king_attack"`
+  RookKingAttack Weight `json:"rook_king_attack"`
+  QueenKingAttack Weight `json:"queen_king_attack"`
+}
+
+var DEFAULT_WEIGHTS = EvalWeights{
+  DoubledPawn: Weight{ -10, -20 },
+  IsolatedPawn: Weight{ -10, -15 },
+  PassedPawn: [8]Weight{ { 0, 0 }, { 0, 5 }, { 5, 10 }, { 10, 20 }, { 20, 35 }, { 35, 60 }, { 50, 90 }, { 0, 0 } },
+
+  KnightMobility: Weight{ 4, 4 },
+  BishopMobility: Weight{ 4, 5 },
+  RookMobility: Weight{ 2, 4 },
+  QueenMobility: Weight{ 1, 2 },
+
+  RookOpenFile: Weight{ 20, 10 },
+  RookSemiOpenFile: Weight{ 10, 5 },
+
+  PawnShield: Weight{ 10, 0 },
+  KnightKingAttack: Weight{ 8, 0 },
+  BishopKingAttack: Weight{ 8, 0 },
+  RookKingAttack: Weight{ 10, 0 },
+  QueenKingAttack: Weight{ 15, 0 },
+}
+
+// the weights Evaluate uses
+var Weights = DEFAULT_WEIGHTS
+
+// =================================== MASKS ===================================
+var FILES = [8]uint64{ A_File, B_File, C_File, D_File, E_File, F_File, G_File, H_File }
+var RANKS = [8]uint64{ RANK_1, RANK_2, RANK_3, RANK_4, RANK_5, RANK_6, RANK_7, RANK_8 }
+
+// ADJACENT_FILES[f] is the files either side of file f.
+// AHEAD[0][r] is every rank in front of rank r for white, AHEAD[1][r] the same for black.
+// PASSED_PAWN_MASKS[color][square] is where an enemy pawn would have to be to stop a pawn on square
+var ADJACENT_FILES [8]uint64
+var AHEAD [2][8]uint64
+var PASSED_PAWN_MASKS [2][64]uint64
+
+func init() {
+  for file := 0; file < 8; file++ {
+    if file > 0 {
+      ADJACENT_FILES[file] |= FILES[file - 1]
+    }
+    if file < 7 {
+      ADJACENT_FILES[file] |= FILES[file + 1]
+    }
+  }
+
+  for rank := 0; rank < 8; rank++ {
+    for other := 0; other < 8; other++ {
+      if other > rank {
+        AHEAD[0][rank] |= RANKS[other]
+      } else if other < rank {
+        AHEAD[1][rank] |= RANKS[other]
+      }
+    }
+  }
+
+  for square := 0; square < 64; square++ {
+    file, rank := squareFile(square), squareRank(square)
+    for color := 0; color < 2; color++ {
+      PASSED_PAWN_MASKS[color][square] = (FILES[file] | ADJACENT_FILES[file]) & AHEAD[color][rank]
+    }
+  }
+}
+
+// file 0 is the a file and rank 0 is the first rank, for a mailbox index
+func squareFile(square int) int {
+  return square % 8
+}
+
+func squareRank(square int) int {
+  return 7 - square / 8
+}
+
+func colorIndex(isWhite bool) int {
+  if isWhite {
+    return 0
+  }
+  return 1
+}
+
+// =================================== EVALUATE ===================================
+// the eval is split into terms, each worked out for both sides from that side's point of view
+// (positive is good for the side). The score is white's terms minus black's
+const (
+  TERM_MATERIAL = iota
+  TERM_PST
+  TERM_PAWN_STRUCTURE
+  TERM_MOBILITY
+  TERM_ROOK_FILES
+  TERM_KING_SAFETY
+  TERM_COUNT
+)
+
+var TERM_NAMES = [TERM_COUNT]string{ "material", "pst", "pawn_structure", "mobility", "rook_files", "king_safety" }
+
+// terms[term][colorIndex]
+type evalTerms [TERM_COUNT][2]Weight
+
+func (terms *evalTerms) total() Weight {
+  var score Weight
+  for term := range terms {
+    score.add(terms[term][0], 1)
+    score.add(terms[term][1], -1)
+  }
+  return score
+}
+
+// blends a middlegame and an endgame score by the phase
+func taper(score Weight, phase int32) int32 {
+  return (score.MG * phase + score.EG * (TOTAL_PHASE - phase)) / TOTAL_PHASE
+}
+
+// in centipawns. The middlegame and endgame scores are blended by how much material is left,
+// so the king can come out and the pawns get pushed as the pieces come off
+func Evaluate(bitboard *Bitboard) int32 { // positive is good for white, negative is good for black
+  return evaluate(bitboard, nil)
+}
+
+// same as Evaluate, looking the pawn structure up in pawns if it isn't nil
+func evaluate(bitboard *Bitboard, pawns *PawnHashTable) int32 {
+  terms := evaluateTerms(bitboard, pawns)
+  return taper(terms.total(), GamePhase(bitboard))
+}
+
+func evaluateTerms(bitboard *Bitboard, pawns *PawnHashTable) evalTerms {
+  var terms evalTerms
+
+  for i := 0; i < 64; i++ {
+    if bitboard.mailbox[i] == 0 {
+      continue
+    }
+    index := zobristPieceIndex(bitboard.mailbox[i])
+    color := index / 6
+    terms[TERM_MATERIAL][color].add(Weight{ MG_PIECE_VALUES[index % 6], EG_PIECE_VALUES[index % 6] }, 1)
+    terms[TERM_PST][color].add(Weight{ MG_PST[index][i], EG_PST[index][i] }, 1)
+  }
+
+  terms[TERM_PAWN_STRUCTURE] = pawnStructure(bitboard, pawns)
+  for _, isWhite := range []bool{ true, false } {
+    evaluatePieces(bitboard, isWhite, &terms)
+    evaluateKingSafety(bitboard, isWhite, &terms)
+  }
+  return terms
+}
+
+// =================================== TRACE ===================================
+// everything that went into an Evaluate score, for working out why the engine likes a move
+type TraceTerm struct {
+  Name string `json:"name"`
+  White Weight `json:"white"`
+  Black Weight `json:"black"`
+  Score int32 `json:"score"` // white minus black, tapered
+}
+
+type EvalTrace struct {
+  Terms []TraceTerm `json:"terms"`
+  Phase int32 `json:"phase"` // TOTAL_PHASE is the middlegame, 0 the endgame
+  MG int32 `json:"mg"`
+  EG int32 `json:"eg"`
+  Score int32 `json:"score"` // the same as Evaluate. Rounding can leave it a little off the sum of the terms
+}
+
+func TraceEvaluate(bitboard *Bitboard) EvalTrace {
+  terms := evaluateTerms(bitboard, nil)
+  phase := GamePhase(bitboard)
+  total := terms.total()
+
+  trace := EvalTrace{ Phase: phase, MG: total.MG, EG: total.EG, Score: taper(total, phase) }
+  for term := range terms {
+    white, black := terms[term][0], terms[term][1]
+    score := white
+    score.add(black, -1)
+    trace.Terms = append(trace.Terms, TraceTerm{ TERM_NAMES[term], white, black, taper(score, phase) })
+  }
+  return trace
+}
+
+// =================================== PAWN STRUCTURE ===================================
+func pawnStructure(bitboard *Bitboard, pawns *PawnHashTable) [2]Weight {
+  if pawns != nil {
+    if score, ok := pawns.Probe(bitboard.whitePawns, bitboard.blackPawns); ok {
+      return score
+    }
+  }
+
+  var score [2]Weight
+  pawnStructureFor(bitboard.whitePawns, bitboard.blackPawns, true, &score[0])
+  pawnStructureFor(bitboard.blackPawns, bitboard.whitePawns, false, &score[1])
+
+  if pawns != nil {
+    pawns.Store(bitboard.whitePawns, bitboard.blackPawns, score)
+  }
+  return score
+}
+
+func pawnStructureFor(own uint64, enemy uint64, isWhite bool, score *Weight) {
+  color := colorIndex(isWhite)
+
+  for file := 0; file < 8; file++ {
+    if count := int32(bits.OnesCount64(own & FILES[file])); count > 1 {
+      score.add(Weights.DoubledPawn, count - 1)
+    }
+  }
+
+  for rest := own; rest != 0; rest &= rest - 1 {
+    square := bits.TrailingZeros64(rest)
+    file, rank := squareFile(square), squareRank(square)
+
+    if own & ADJACENT_FILES[file] == 0 {
+      score.add(Weights.IsolatedPawn, 1)
+    }
+
+    // only the front pawn of a doubled pair can be passed
+    if PASSED_PAWN_MASKS[color][square] & enemy == 0 && FILES[file] & AHEAD[color][rank] & own == 0 {
+      relativeRank := rank
+      if !isWhite {
+        relativeRank = 7 - rank
+      }
+      score.add(Weights.PassedPawn[relativeRank], 1)
+    }
+  }
+}
+
+// =================================== PIECES ===================================
+// mobility counts the squares a piece attacks that aren't taken by its own side or covered by
+// an enemy pawn. Rooks also like files without their own pawns in the way
+func evaluatePieces(bitboard *Bitboard, isWhite bool, terms *evalTerms) {
+  color := colorIndex(isWhite)
+  mobility, rookFiles := &terms[TERM_MOBILITY][color], &terms[TERM_ROOK_FILES][color]
+
+  occupied := WhitePieces(bitboard) | BlackPieces(bitboard)
+  own, ownPawns, enemyPawns := WhitePieces(bitboard), bitboard.whitePawns, bitboard.blackPawns
+  knights, bishops, rooks, queens := bitboard.whiteKnights, bitboard.whiteBishops, bitboard.whiteRooks, bitboard.whiteQueens
+  if !isWhite {
+    own, ownPawns, enemyPawns = BlackPieces(bitboard), bitboard.blackPawns, bitboard.whitePawns
+    knights, bishops, rooks, queens = bitboard.blackKnights, bitboard.blackBishops, bitboard.blackRooks, bitboard.blackQueens
+  }
+  area := ^own &^ PawnAttacks(enemyPawns, !isWhite)
+
+  for rest := knights; rest != 0; rest &= rest - 1 {
+    mobility.add(Weights.KnightMobility, int32(bits.OnesCount64(KnightAttacks(rest & -rest) & area)))
+  }
+  for rest := bishops; rest != 0; rest &= rest - 1 {
+    mobility.add(Weights.BishopMobility, int32(bits.OnesCount64(BishopAttacks(rest & -rest, occupied) & area)))
+  }
+  for rest := rooks; rest != 0; rest &= rest - 1 {
+    square := rest & -rest
+    mobility.add(Weights.RookMobility, int32(bits.OnesCount64(RookAttacks(square, occupied) & area)))
+
+    file := FILES[squareFile(GetMailBoxIndex(square))]
+    if file & (ownPawns | enemyPawns) == 0 {
+      rookFiles.add(Weights.RookOpenFile, 1)
+    } else if file & ownPawns == 0 {
+      rookFiles.add(Weights.RookSemiOpenFile, 1)
+    }
+  }
+  for rest := queens; rest != 0; rest &= rest - 1 {
+    mobility.add(Weights.QueenMobility, int32(bits.OnesCount64(QueenAttacks(rest & -rest, occupied) & area)))
+  }
+}
+
+// =================================== KING SAFETY ===================================
+// pawns standing in front of our own king, and our pieces that can reach the squares around theirs
+func evaluateKingSafety(bitboard *Bitboard, isWhite bool, terms *evalTerms) {
+  score := &terms[TERM_KING_SAFETY][colorIndex(isWhite)]
+
+  occupied := WhitePieces(bitboard) | BlackPieces(bitboard)
+  king, ownPawns := bitboard.whiteKing, bitboard.whitePawns
+  enemyKing := bitboard.blackKing
+  knights, bishops, rooks, queens := bitboard.whiteKnights, bitboard.whiteBishops, bitboard.whiteRooks, bitboard.whiteQueens
+  if !isWhite {
+    king, ownPawns = bitboard.blackKing, bitboard.blackPawns
+    enemyKing = bitboard.whiteKing
+    knights, bishops, rooks, queens = bitboard.blackKnights, bitboard.blackBishops, bitboard.blackRooks, bitboard.blackQueens
+  }
+
+  if king != 0 {
+    index := GetMailBoxIndex(king)
+    file, rank := squareFile(index), squareRank(index)
+    shield := (FILES[file] | ADJACENT_FILES[file]) & AHEAD[colorIndex(isWhite)][rank]
+    if isWhite && rank < 6 {
+      shield &= RANKS[rank + 1] | RANKS[rank + 2]
+    } else if !isWhite && rank > 1 {
+      shield &= RANKS[rank - 1] | RANKS[rank - 2]
+    }
+    score.add(Weights.PawnShield, int32(bits.OnesCount64(shield & ownPawns)))
+  }
+
+  if enemyKing == 0 {
+    return
+  }
+  zone := enemyKing | KingAttacks(enemyKing)
+  for rest := knights; rest != 0; rest &= rest - 1 {
+    if KnightAttacks(rest & -rest) & zone != 0 {
+      score.add(Weights.KnightKingAttack, 1)
+    }
+  }
+  for rest := bishops; rest != 0; rest &= rest - 1 {
+    if BishopAttacks(rest & -rest, occupied) & zone != 0 {
+      score.add(Weights.BishopKingAttack, 1)
+    }
+  }
+  for rest := rooks; rest != 0; rest &= rest - 1 {
+    if RookAttacks(rest & -rest, occupied) & zone != 0 {
+      score.add(Weights.RookKingAttack, 1)
+    }
+  }
+  for rest := queens; rest != 0; rest &= rest - 1 {
+    if QueenAttacks(rest & -rest, occupied) & zone != 0 {
+      score.add(Weights.QueenKingAttack, 1)
+    }
+  }
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+  "testing"
+)
+
+// scores a position with only one term switched on
+func evaluateWith(t *testing.T, fen string, weights EvalWeights) int32 {
+  t.Helper()
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, fen); err != nil {
+    t.Fatal(err)
+  }
+
+  saved := Weights
+  defer func() { Weights = saved }()
+  Weights = weights
+
+  var without EvalWeights
+  Weights = without
+  base := Evaluate(&board)
+  Weights = weights
+  return Evaluate(&board) - base
+}
+
+func TestEvalTerms(t *testing.T) {
+  one := Weight{ 1, 1 }
+  terms := []struct {
+    name string
+    fen string
+    weights EvalWeights
+    want int32
+  }{
+    { "doubled pawns", "4k3/8/8/8/8/4P3/4P3/4K3 w - - 0 1", EvalWeights{ DoubledPawn: one }, 1 },
+    { "tripled pawns", "4k3/8/8/4p3/4p3/4p3/8/4K3 w - - 0 1", EvalWeights{ DoubledPawn: one }, -2 },
+    { "isolated pawns", "4k3/p1p5/8/8/8/8/PP6/4K3 w - - 0 1", EvalWeights{ IsolatedPawn: one }, -2 },
+    // the c pawn is stopped by the b pawn (and the other way around), the front pawn on e is passed and the one behind it isn't
+    { "passed pawns", "4k3/1p6/8/8/4P3/2P1P3/8/4K3 w - - 0 1", EvalWeights{ PassedPawn: [8]Weight{ 3: one } }, 1 },
+    { "black passed pawn", "4k3/8/8/8/p7/8/8/4K3 w - - 0 1", EvalWeights{ PassedPawn: [8]Weight{ 4: one } }, -1 },
+    { "knight mobility", "4k3/8/8/8/8/8/8/N3K3 w - - 0 1", EvalWeights{ KnightMobility: one }, 2 },
+    { "knight kept off pawn covered squares", "4k3/8/8/8/8/3p4/8/N3K3 w - - 0 1", EvalWeights{ KnightMobility: one }, 1 },
+    { "rook on an open file", "4k3/pp6/8/8/8/8/1P6/R3K3 w - - 0 1", EvalWeights{ RookOpenFile: one, RookSemiOpenFile: Weight{ 10, 10 } }, 10 },
+    { "rook on a semi open file", "4k3/1p6/8/8/8/8/8/1R2K3 w - - 0 1", EvalWeights{ RookOpenFile: Weight{ 10, 10 }, RookSemiOpenFile: one }, 1 },
+    { "pawn shield", "6k1/8/8/8/8/8/5PPP/6K1 w - - 0 1", EvalWeights{ PawnShield: one }, 3 },
+    { "pieces around the king", "6k1/8/8/7Q/8/3B4/8/4K3 w - - 0 1", EvalWeights{ BishopKingAttack: one, QueenKingAttack: Weight{ 10, 10 } }, 11 },
+  }
+
+  for _, term := range terms {
+    if got := evaluateWith(t, term.fen, term.weights); got != term.want {
+      t.Errorf("%s: %d, want %d", term.name, got, term.want)
+    }
+  }
+}
+
+func TestPawnHashMatchesEvaluate(t *testing.T) {
+  pawns := NewPawnHashTable(DEFAULT_PAWN_HASH_ENTRIES)
+  for _, position := range perftPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    // the second lookup is a hit
+    for i := 0; i < 2; i++ {
+      if got, want := evaluate(&board, pawns), Evaluate(&board); got != want {
+        t.Errorf("%s: %d with the pawn table, %d without", position.name, got, want)
+      }
+    }
+    if _, ok := pawns.Probe(board.whitePawns, board.blackPawns); !ok {
+      t.Errorf("%s: pawn structure wasn't stored", position.name)
+    }
+  }
+}
+
+func TestTraceAddsUpToEvaluate(t *testing.T) {
+  for _, position := range perftPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+
+    trace := TraceEvaluate(&board)
+    if trace.Score != Evaluate(&board) || len(trace.Terms) != TERM_COUNT {
+      t.Errorf("%s: trace scored %d with %d terms, Evaluate %d", position.name, trace.Score, len(trace.Terms), Evaluate(&board))
+    }
+
+    var total Weight
+    for _, term := range trace.Terms {
+      total.add(term.White, 1)
+      total.add(term.Black, -1)
+    }
+    if total.MG != trace.MG || total.EG != trace.EG {
+      t.Errorf("%s: terms add up to %v, trace says %d %d", position.name, total, trace.MG, trace.EG)
+    }
+  }
+}
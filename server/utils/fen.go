@@ -0,0 +1,217 @@
+package utils
+
+import (
+  "errors"
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+const STARTING_FEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+var FEN_TO_PIECE = map[byte]uint8{
+  'P': WHITE_PAWN, 'N': WHITE_KNIGHT, 'B': WHITE_BISHOP, 'R': WHITE_ROOK, 'Q': WHITE_QUEEN, 'K': WHITE_KING,
+  'p': BLACK_PAWN, 'n': BLACK_KNIGHT, 'b': BLACK_BISHOP, 'r': BLACK_ROOK, 'q': BLACK_QUEEN, 'k': BLACK_KING,
+}
+
+var PIECE_TO_FEN = map[uint8]byte{
+  WHITE_PAWN: 'P', WHITE_KNIGHT: 'N', WHITE_BISHOP: 'B', WHITE_ROOK: 'R', WHITE_QUEEN: 'Q', WHITE_KING: 'K',
+  BLACK_PAWN: 'p', BLACK_KNIGHT: 'n', BLACK_BISHOP: 'b', BLACK_ROOK: 'r', BLACK_QUEEN: 'q', BLACK_KING: 'k',
+}
+
+// =================================== SQUARE NAMES ===================================
+// "e4" <-> the uint64 with only that square set
+func SquareName(square uint64) string {
+  if square == 0 {
+    return "-"
+  }
+  index := GetMailBoxIndex(square)
+  return string([]byte{ byte('a' + index % 8), byte('8' - index / 8) })
+}
+
+func SquareFromName(name string) (uint64, error) {
+  if len(name) != 2 || name[0] < 'a' || name[0] > 'h' || name[1] < '1' || name[1] > '8' {
+    return 0, fmt.Errorf("invalid square %q", name)
+  }
+  file := int(name[0] - 'a')
+  row := int('8' - name[1])
+  return uint64(1) << (row * 8 + file), nil
+}
+
+// =================================== READING A FEN ===================================
+// sets the board up from a FEN string. The board is only changed if the whole FEN is valid
+func InitBoardFromFEN(bitboard *Bitboard, fen string) error {
+  fields := strings.Fields(fen)
+  if len(fields) < 4 || len(fields) > 6 {
+    return errors.New("a FEN needs between 4 and 6 fields")
+  }
+
+  var board Bitboard
+  board.whiteOnBottom = true
+  board.mailbox = make([]uint8, 64)
+
+  // ================= piece placement =================
+  ranks := strings.Split(fields[0], "/")
+  if len(ranks) != 8 {
+    return fmt.Errorf("expected 8 ranks but got %d", len(ranks))
+  }
+  for row, rank := range ranks {
+    col := 0
+    for i := 0; i < len(rank); i++ {
+      c := rank[i]
+      if c >= '1' && c <= '8' {
+        col += int(c - '0')
+        continue
+      }
+      piece, ok := FEN_TO_PIECE[c]
+      if !ok {
+        return fmt.Errorf("unknown piece %q", c)
+      }
+      if col > 7 {
+        return fmt.Errorf("rank %d has more than 8 squares", 8 - row)
+      }
+      square := uint64(1) << (row * 8 + col)
+      board.mailbox[row * 8 + col] = piece
+      PieceMoveFuncs[piece](&board, 0, square)
+      col++
+    }
+    if col != 8 {
+      return fmt.Errorf("rank %d has %d squares instead of 8", 8 - row, col)
+    }
+  }
+
+  if countBits(board.whiteKing) != 1 || countBits(board.blackKing) != 1 {
+    return errors.New("each side needs exactly one king")
+  }
+  if (board.whitePawns | board.blackPawns) & (RANK_1 | RANK_8) != 0 {
+    return errors.New("pawns can't stand on the first or last rank")
+  }
+
+  // ================= side to move =================
+  switch fields[1] {
+  case "w":
+    board.whiteTurn = true
+  case "b":
+    board.whiteTurn = false
+  default:
+    return fmt.Errorf("side to move has to be w or b, not %q", fields[1])
+  }
+
+  if IsInCheck(&board, !board.whiteTurn) {
+    return errors.New("the side that just moved can't be left in check")
+  }
+
+  // ================= castling rights =================
+  if fields[2] != "-" {
+    for i := 0; i < len(fields[2]); i++ {
+      switch fields[2][i] {
+      case 'K':
+        board.castlingRights |= 0x1
+      case 'Q':
+        board.castlingRights |= 0x2
+      case 'k':
+        board.castlingRights |= 0x80
+      case 'q':
+        board.castlingRights |= 0x40
+      default:
+        return fmt.Errorf("invalid castling rights %q", fields[2])
+      }
+    }
+  }
+
+  // drop any rights the pieces on the board can't back up
+  if board.mailbox[60] != WHITE_KING { board.castlingRights &= 0xC0 }
+  if board.mailbox[4] != BLACK_KING { board.castlingRights &= 0x3 }
+  if board.mailbox[63] != WHITE_ROOK { board.castlingRights &= 0xC2 }
+  if board.mailbox[56] != WHITE_ROOK { board.castlingRights &= 0xC1 }
+  if board.mailbox[7] != BLACK_ROOK { board.castlingRights &= 0x43 }
+  if board.mailbox[0] != BLACK_ROOK { board.castlingRights &= 0x83 }
+
+  // ================= en passant =================
+  if fields[3] != "-" {
+    square, err := SquareFromName(fields[3])
+    if err != nil {
+      return err
+    }
+    if (board.whiteTurn && square & RANK_6 == 0) || (!board.whiteTurn && square & RANK_3 == 0) {
+      return fmt.Errorf("%s can't be an en passant square", fields[3])
+    }
+    // the pawn that just moved two squares is in front of it, and the square it came from is empty
+    pawn, from, pawns := square << 8, square >> 8, board.blackPawns
+    if !board.whiteTurn {
+      pawn, from, pawns = square >> 8, square << 8, board.whitePawns
+    }
+    if pawn & pawns == 0 || (square | from) & (WhitePieces(&board) | BlackPieces(&board)) != 0 {
+      return fmt.Errorf("%s can't be an en passant square, no pawn just moved two squares past it", fields[3])
+    }
+    board.enPassant = square
+  }
+
+  // ================= move clocks =================
+  board.fullmoveNumber = 1
+  if len(fields) > 4 {
+    halfmoveClock, err := strconv.Atoi(fields[4])
+    if err != nil || halfmoveClock < 0 {
+      return fmt.Errorf("invalid halfmove clock %q", fields[4])
+    }
+    board.halfmoveClock = halfmoveClock
+  }
+  if len(fields) > 5 {
+    fullmoveNumber, err := strconv.Atoi(fields[5])
+    if err != nil || fullmoveNumber < 1 {
+      return fmt.Errorf("invalid fullmove number %q", fields[5])
+    }
+    board.fullmoveNumber = fullmoveNumber
+  }
+
+  board.startingFen = GetFEN(&board)
+  board.hash = ComputeHash(&board)
+  *bitboard = board
+  return nil
+}
+
+// =================================== WRITING A FEN ===================================
+func GetFEN(bitboard *Bitboard) string {
+  var fen strings.Builder
+
+  for row := 0; row < 8; row++ {
+    empty := 0
+    for col := 0; col < 8; col++ {
+      piece := bitboard.mailbox[row * 8 + col]
+      if piece == 0 {
+        empty++
+        continue
+      }
+      if empty > 0 {
+        fen.WriteByte(byte('0' + empty))
+        empty = 0
+      }
+      fen.WriteByte(PIECE_TO_FEN[piece])
+    }
+    if empty > 0 {
+      fen.WriteByte(byte('0' + empty))
+    }
+    if row < 7 {
+      fen.WriteByte('/')
+    }
+  }
+
+  if bitboard.whiteTurn {
+    fen.WriteString(" w ")
+  } else {
+    fen.WriteString(" b ")
+  }
+
+  castling := ""
+  if bitboard.castlingRights & 0x1 != 0 { castling += "K" }
+  if bitboard.castlingRights & 0x2 != 0 { castling += "Q" }
+  if bitboard.castlingRights & 0x80 != 0 { castling += "k" }
+  if bitboard.castlingRights & 0x40 != 0 { castling += "q" }
+  if castling == "" {
+    castling = "-"
+  }
+  fen.WriteString(castling)
+
+  fmt.Fprintf(&fen, " %s %d %d", SquareName(bitboard.enPassant), bitboard.halfmoveClock, bitboard.fullmoveNumber)
+  return fen.String()
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestFENRoundTrip(t *testing.T) {
+  fens := []string{
+    STARTING_FEN,
+    "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+    "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+    "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 11 42",
+    "r3k3/8/8/8/8/8/8/4K2R b Kq - 5 20",
+  }
+  for _, fen := range fens {
+    var bitboard Bitboard
+    if err := InitBoardFromFEN(&bitboard, fen); err != nil {
+      t.Errorf("%s: %v", fen, err)
+      continue
+    }
+    if got := GetFEN(&bitboard); got != fen {
+      t.Errorf("read %s, wrote %s", fen, got)
+    }
+  }
+
+  // the clocks can be left off
+  var short Bitboard
+  if err := InitBoardFromFEN(&short, "4k3/8/8/8/8/8/8/4K3 b - -"); err != nil || GetFEN(&short) != "4k3/8/8/8/8/8/8/4K3 b - - 0 1" {
+    t.Errorf("short FEN read as %s (%v)", GetFEN(&short), err)
+  }
+}
+
+// a FEN that's rejected leaves the board the way it was
+func TestFENRejected(t *testing.T) {
+  fens := map[string]string{
+    "too few fields": "8/8/8/8/8/8/8/8 w",
+    "seven ranks": "rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+    "nine ranks": "rnbqkbnr/pppppppp/8/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+    "a rank too long": "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+    "a rank too short": "rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+    "bad piece letter": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNX w KQkq - 0 1",
+    "no black king": "rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1",
+    "pawn on the last rank": "rnbqkbnP/pppppppp/8/8/8/8/PPPPPPP1/RNBQKBNR w KQkq - 0 1",
+    "bad side to move": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+    "mover left in check": "4k3/8/8/8/8/8/4R3/4K3 w - - 0 1",
+    "bad castling field": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1",
+    "bad en passant square": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1",
+    "en passant on the wrong rank": "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e4 0 1",
+    "en passant with no pawn in front": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq e3 0 1",
+    "en passant with the pawn still behind": "rnbqkbnr/pppppppp/8/8/4P3/8/PPPPPPPP/RNBQKBN1 b Qkq e3 0 1",
+    "en passant onto a piece": "rnbqkbnr/pppp1ppp/4p3/8/4P3/4N3/PPPP1PPP/R1BQKB1R b KQkq e3 0 1",
+    "non-numeric halfmove clock": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - x 1",
+    "negative halfmove clock": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1",
+    "non-numeric fullmove number": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 one",
+    "fullmove number zero": "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0",
+  }
+
+  var bitboard Bitboard
+  InitBoard(&bitboard)
+  playUCIMoves(t, &bitboard, "e2e4", "c7c5")
+  before := CopyBitboard(&bitboard)
+  for name, fen := range fens {
+    if err := InitBoardFromFEN(&bitboard, fen); err == nil {
+      t.Errorf("%s: accepted %s", name, fen)
+    }
+    if !reflect.DeepEqual(bitboard, before) {
+      t.Fatalf("%s: the board changed to %s", name, GetFEN(&bitboard))
+    }
+  }
+}
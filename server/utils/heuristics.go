@@ -1,168 +1,213 @@
 package utils
 
-// CHANGE ALL THE DECIALS TO INTERGERS 
-// 0.05 are going to be 1, 0.1 are going to be 2, 0.2 are going to be 4, 0.3 are going to be 6, 0.4 are going to be 8, 0.5 are going to be 10
+// =================================== PIECE VALUES ===================================
+// everything here is in centipawns, a pawn is worth 100.
+// These are the nominal values that SEE and move ordering trade in, Evaluate uses the tapered ones below
+var PIECE_TO_VALUE = map[uint8]int32 {
+  WHITE_PAWN: 100,
+  WHITE_KNIGHT: 320,
+  WHITE_BISHOP: 330,
+  WHITE_ROOK: 500,
+  WHITE_QUEEN: 900,
+  WHITE_KING: 20000,
+  BLACK_PAWN: -100,
+  BLACK_KNIGHT: -320,
+  BLACK_BISHOP: -330,
+  BLACK_ROOK: -500,
+  BLACK_QUEEN: -900,
+  BLACK_KING: -20000,
+}
+
+// indexed pawn, knight, bishop, rook, queen, king (the same order as zobristPieceIndex).
+// Rooks and queens get a bit better once the board empties out, minor pieces a bit worse
+var MG_PIECE_VALUES = [6]int32 { 100, 320, 330, 500, 900, 0 }
+var EG_PIECE_VALUES = [6]int32 { 120, 300, 315, 530, 950, 0 }
+
+// =================================== GAME PHASE ===================================
+// the phase counts the pieces that are left. 24 is everything still on the board (the middlegame)
+// and 0 is kings and pawns only (the endgame). Pawns and kings don't count towards it
+var PHASE_WEIGHTS = [6]int32 { 0, 1, 1, 2, 4, 0 }
+const TOTAL_PHASE = 24
+
+func GamePhase(bitboard *Bitboard) int32 {
+  var phase int32
+  for i := 0; i < 64; i++ {
+    if bitboard.mailbox[i] != 0 {
+      phase += PHASE_WEIGHTS[zobristPieceIndex(bitboard.mailbox[i]) % 6]
+    }
+  }
+  // promotions can push it past the starting material
+  if phase > TOTAL_PHASE {
+    phase = TOTAL_PHASE
+  }
+  return phase
+}
+
+// =================================== PIECE SQUARE TABLES ===================================
+// the tables are from white's side, with a8 first so they read like the board does.
+// Black's are the same tables flipped top to bottom, see init below
 
-var BLACK_PAWN_TABLE = [64]int8{ // black pieces are good when negative
+var MG_PAWN_TABLE = [64]int32 {
   0, 0, 0, 0, 0, 0, 0, 0,
-  -.05, -.1, -.1, .2, .2, -.1, -.1, -.05,
-  -.05, .05, .1, 0, 0, .1, .05, -.05,
-  0, 0, 0, -.2, -.2, 0, 0, 0,
-  -.05, -.05, -.1, -.25, -.25, -.1, -.05, -.05,
-  -.1, -.1, -.2, -.3, -.3, -.2, -.1, -.1,
-  -.5, -.5, -.5, -.5, -.5, -.5, -.5, -.5,
+  50, 50, 50, 50, 50, 50, 50, 50,
+  10, 10, 20, 30, 30, 20, 10, 10,
+  5, 5, 10, 25, 25, 10, 5, 5,
+  0, 0, 0, 20, 20, 0, 0, 0,
+  5, -5, -10, 0, 0, -10, -5, 5,
+  5, 10, 10, -20, -20, 10, 10, 5,
   0, 0, 0, 0, 0, 0, 0, 0,
 }
 
-var WHITE_PAWN_TABLE = [64]float64 {
+// in the endgame a pawn is worth more the closer it gets to promoting
+var EG_PAWN_TABLE = [64]int32 {
   0, 0, 0, 0, 0, 0, 0, 0,
-  .5, .5, .5, .5, .5, .5, .5, .5,
-  .1, .1, .2, .3, .3, .2, .1, .1,
-  .05, .05, .1, .25, .25, .1, .05, .05,
-  0, 0, 0, .2, .2, 0, 0, 0,
-  .05, -.05, -.1, 0, 0, -.1, -.05, .05,
-  .05, .1, .1, -.2, -.2, .1, .1, .05,
+  80, 80, 80, 80, 80, 80, 80, 80,
+  50, 50, 50, 50, 50, 50, 50, 50,
+  30, 30, 30, 30, 30, 30, 30, 30,
+  15, 15, 15, 15, 15, 15, 15, 15,
+  5, 5, 5, 5, 5, 5, 5, 5,
   0, 0, 0, 0, 0, 0, 0, 0,
+  0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var MG_KNIGHT_TABLE = [64]int32 {
+  -50, -40, -30, -30, -30, -30, -40, -50,
+  -40, -20, 0, 0, 0, 0, -20, -40,
+  -30, 0, 10, 15, 15, 10, 0, -30,
+  -30, 5, 15, 20, 20, 15, 5, -30,
+  -30, 0, 15, 20, 20, 15, 0, -30,
+  -30, 5, 10, 15, 15, 10, 5, -30,
+  -40, -20, 0, 5, 5, 0, -20, -40,
+  -50, -40, -30, -30, -30, -30, -40, -50,
 }
 
-var WHITE_KNIGHT_TABLE = [64]float64 {
-  0, -.1, -.05, -.05, -.05, -.05, -.1, 0,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  -.05, 0, .05, .05, .05, .05, 0, -.05,
-  -.05, 0, .05, .1, .1, .05, 0, -.05,
-  -.05, 0, .05, .1, .1, .05, 0, -.05,
-  -.05, 0, .05, .05, .05, .05, 0, -.05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  0, -.1, -.05, -.05, -.05, -.05, -.1, 0,
+var EG_KNIGHT_TABLE = [64]int32 {
+  -50, -40, -30, -30, -30, -30, -40, -50,
+  -40, -20, 0, 0, 0, 0, -20, -40,
+  -30, 0, 10, 15, 15, 10, 0, -30,
+  -30, 0, 15, 20, 20, 15, 0, -30,
+  -30, 0, 15, 20, 20, 15, 0, -30,
+  -30, 0, 10, 15, 15, 10, 0, -30,
+  -40, -20, 0, 0, 0, 0, -20, -40,
+  -50, -40, -30, -30, -30, -30, -40, -50,
 }
 
-var WHITE_BISHOP_TABLE = [64]float64 {
-  -.2, -.1, -.1, -.1, -.1, -.1, -.1, -.2,
-  -.1, 0, 0, 0, 0, 0, 0, -.1,
-  -.1, 0, .05, .1, .1, .05, 0, -.1,
-  -.1, .05, .05, .1, .1, .05, .05, -.1,
-  -.1, 0, .1, .1, .1, .1, 0, -.1,
-  -.1, .1, .1, .1, .1, .1, .1, -.1,
-  -.1, .05, 0, 0, 0, 0, .05, -.1,
-  -.2, -.1, -.1, -.1, -.1, -.1, -.1, -.2,
+var MG_BISHOP_TABLE = [64]int32 {
+  -20, -10, -10, -10, -10, -10, -10, -20,
+  -10, 0, 0, 0, 0, 0, 0, -10,
+  -10, 0, 5, 10, 10, 5, 0, -10,
+  -10, 5, 5, 10, 10, 5, 5, -10,
+  -10, 0, 10, 10, 10, 10, 0, -10,
+  -10, 10, 10, 10, 10, 10, 10, -10,
+  -10, 5, 0, 0, 0, 0, 5, -10,
+  -20, -10, -10, -10, -10, -10, -10, -20,
 }
 
-var WHITE_ROOK_TABLE = [64]float64 {
+var EG_BISHOP_TABLE = [64]int32 {
+  -20, -10, -10, -10, -10, -10, -10, -20,
+  -10, 0, 0, 0, 0, 0, 0, -10,
+  -10, 0, 5, 10, 10, 5, 0, -10,
+  -10, 0, 10, 15, 15, 10, 0, -10,
+  -10, 0, 10, 15, 15, 10, 0, -10,
+  -10, 0, 5, 10, 10, 5, 0, -10,
+  -10, 0, 0, 0, 0, 0, 0, -10,
+  -20, -10, -10, -10, -10, -10, -10, -20,
+}
+
+var MG_ROOK_TABLE = [64]int32 {
+  0, 0, 0, 0, 0, 0, 0, 0,
+  5, 10, 10, 10, 10, 10, 10, 5,
+  -5, 0, 0, 0, 0, 0, 0, -5,
+  -5, 0, 0, 0, 0, 0, 0, -5,
+  -5, 0, 0, 0, 0, 0, 0, -5,
+  -5, 0, 0, 0, 0, 0, 0, -5,
+  -5, 0, 0, 0, 0, 0, 0, -5,
+  0, 0, 0, 5, 5, 0, 0, 0,
+}
+
+// the seventh rank is still good, but there's no corner to hide in anymore
+var EG_ROOK_TABLE = [64]int32 {
+  0, 0, 0, 0, 0, 0, 0, 0,
+  10, 10, 10, 10, 10, 10, 10, 10,
+  0, 0, 0, 0, 0, 0, 0, 0,
+  0, 0, 0, 0, 0, 0, 0, 0,
   0, 0, 0, 0, 0, 0, 0, 0,
-  .05, .1, .1, .1, .1, .1, .1, .05,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-}
-
-var WHITE_QUEEN_TABLE = [64]float64 {
-  -.2, -.1, -.1, -.05, -.05, -.1, -.1, -.2,
-  -.1, 0, 0, 0, 0, 0, 0, -.1,
-  -.1, 0, .05, .05, .05, .05, 0, -.1,
-  -.05, 0, .05, .05, .05, .05, 0, -.05,
-  0, 0, .05, .05, .05, .05, 0, -.05,
-  -.1, .05, .05, .05, .05, .05, 0, -.1,
-  -.1, 0, .05, 0, 0, 0, 0, -.1,
-  -.2, -.1, -.1, -.05, -.05, -.1, -.1, -.2,
-}
-
-var WHITE_KING_TABLE = [64]float64 {
-  -.3, -.4, -.4, -.5, -.5, -.4, -.4, -.3,
-  -.3, -.4, -.4, -.5, -.5, -.4, -.4, -.3,
-  -.3, -.4, -.4, -.5, -.5, -.4, -.4, -.3,
-  -.3, -.4, -.4, -.5, -.5, -.4, -.4, -.3, 
-  -.2, -.3, -.3, -.4, -.4, -.3, -.3, -.2,
-  -.1, -.2, -.2, -.2, -.2, -.2, -.2, -.1,
-  .2, .2, 0, 0, 0, 0, .2, .2,
-  .2, .3, .1, 0, 0, .1, .3, .2,
-}
-
-// This should be the same as the white tables, but negative
-var BLACK_KNIGHT_TABLE = [64]float64 {
-  0, .1, .05, .05, .05, .05, .1, 0,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  .05, 0, -.05, -.05, -.05, -.05, 0, .05,
-  .05, 0, -.05, -.1, -.1, -.05, 0, .05,
-  .05, 0, -.05, -.1, -.1, -.05, 0, .05,
-  .05, 0, -.05, -.05, -.05, -.05, 0, .05,
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  0, .1, .05, .05, .05, .05, .1, 0,
-}
-
-var BLACK_BISHOP_TABLE = [64]float64 {
-  .2, .1, .1, .1, .1, .1, .1, .2,
-  .1, -.05, 0, 0, 0, 0, -.05, .1,
-  .1, -.1, -.1, -.1, -.1, -.1, -.1, .1,
-  .1, 0, -.1, -.1, -.1, -.1, 0, .1,
-  .1, -.05, -.05, -.1, -.1, -.05, -.05, .1,
-  .1, 0, -.05, -.1, -.1, -.05, 0, .1,
-  .1, 0, 0, 0, 0, 0, 0, .1,
-  .2, .1, .1, .1, .1, .1, .1, .2,
-}
-
-var BLACK_ROOK_TABLE = [64]float64 {
-  .05, 0, 0, 0, 0, 0, 0, .05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  -.05, 0, 0, 0, 0, 0, 0, -.05,
-  -.05, -.1, -.1, -.1, -.1, -.1, -.1, -.05,
   0, 0, 0, 0, 0, 0, 0, 0,
+  0, 0, 0, 0, 0, 0, 0, 0,
+  0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var MG_QUEEN_TABLE = [64]int32 {
+  -20, -10, -10, -5, -5, -10, -10, -20,
+  -10, 0, 0, 0, 0, 0, 0, -10,
+  -10, 0, 5, 5, 5, 5, 0, -10,
+  -5, 0, 5, 5, 5, 5, 0, -5,
+  0, 0, 5, 5, 5, 5, 0, -5,
+  -10, 5, 5, 5, 5, 5, 0, -10,
+  -10, 0, 5, 0, 0, 0, 0, -10,
+  -20, -10, -10, -5, -5, -10, -10, -20,
+}
+
+var EG_QUEEN_TABLE = [64]int32 {
+  -20, -10, -10, -5, -5, -10, -10, -20,
+  -10, 0, 5, 5, 5, 5, 0, -10,
+  -10, 5, 10, 10, 10, 10, 5, -10,
+  -5, 5, 10, 15, 15, 10, 5, -5,
+  -5, 5, 10, 15, 15, 10, 5, -5,
+  -10, 5, 10, 10, 10, 10, 5, -10,
+  -10, 0, 5, 5, 5, 5, 0, -10,
+  -20, -10, -10, -5, -5, -10, -10, -20,
+}
+
+// the king hides behind its pawns while there are pieces around to attack it
+var MG_KING_TABLE = [64]int32 {
+  -30, -40, -40, -50, -50, -40, -40, -30,
+  -30, -40, -40, -50, -50, -40, -40, -30,
+  -30, -40, -40, -50, -50, -40, -40, -30,
+  -30, -40, -40, -50, -50, -40, -40, -30,
+  -20, -30, -30, -40, -40, -30, -30, -20,
+  -10, -20, -20, -20, -20, -20, -20, -10,
+  20, 20, 0, 0, 0, 0, 20, 20,
+  20, 30, 10, 0, 0, 10, 30, 20,
 }
 
-var BLACK_QUEEN_TABLE = [64]float64 {
-  .2, .1, .1, .05, .05, .1, .1, .2,
-  .1, 0, 0, 0, 0, 0, 0, .1,
-  .1, 0, -.05, -.05, -.05, -.05, 0, .1,
-  .05, 0, -.05, -.05, -.05, -.05, 0, .05,
-  0, 0, -.05, -.05, -.05, -.05, 0, .05,
-  .1, -.05, -.05, -.05, -.05, -.05, 0, .1,
-  .1, 0, -.05, 0, 0, 0, 0, .1,
-  .2, .1, .1, .05, .05, .1, .1, .2,
-}
-
-var BLACK_KING_TABLE = [64]float64 {
-  -.2, -.2, 0, 0, 0, 0, -.2, -.2,
-  -.2, -.3, -.1, 0, 0, -.1, -.3, -.2,
-  .1, .2, .2, .2, .2, .2, .2, .1,
-  .3, .4, .4, .5, .5, .4, .4, .3,
-  .3, .4, .4, .5, .5, .4, .4, .3,
-  .2, .3, .3, .4, .4, .3, .3, .2,
-  .3, .4, .4, .5, .5, .4, .4, .3,
-  .3, .4, .4, .5, .5, .4, .4, .3,
-}
-
-var PIECE_TO_VALUE = map[uint8]float64 {
-  WHITE_PAWN: 10,
-  WHITE_KNIGHT:30, 
-  WHITE_BISHOP:30,
-  WHITE_ROOK:50,
-  WHITE_QUEEN:90,
-  WHITE_KING:1000,
-  BLACK_PAWN:-10,
-  BLACK_KNIGHT:-30,
-  BLACK_BISHOP:-30,
-  BLACK_ROOK:-50,
-  BLACK_QUEEN:-90,
-  BLACK_KING:-1000,
-}
-
-var PIECE_TO_TABLE = map[uint8][64]float64 {
-  WHITE_PAWN: WHITE_PAWN_TABLE,
-  BLACK_PAWN: BLACK_PAWN_TABLE,
-  WHITE_KNIGHT: WHITE_KNIGHT_TABLE,
-  BLACK_KNIGHT: BLACK_KNIGHT_TABLE,
-  WHITE_BISHOP: WHITE_BISHOP_TABLE,
-  BLACK_BISHOP: BLACK_BISHOP_TABLE,
-  WHITE_ROOK: WHITE_ROOK_TABLE,
-  BLACK_ROOK: BLACK_ROOK_TABLE,
-  WHITE_QUEEN: WHITE_QUEEN_TABLE,
-  BLACK_QUEEN: BLACK_QUEEN_TABLE,
-  WHITE_KING: WHITE_KING_TABLE,
-  BLACK_KING: BLACK_KING_TABLE,
+// and walks to the middle once they're gone
+var EG_KING_TABLE = [64]int32 {
+  -50, -40, -30, -20, -20, -30, -40, -50,
+  -30, -20, -10, 0, 0, -10, -20, -30,
+  -30, -10, 20, 30, 30, 20, -10, -30,
+  -30, -10, 30, 40, 40, 30, -10, -30,
+  -30, -10, 30, 40, 40, 30, -10, -30,
+  -30, -10, 20, 30, 30, 20, -10, -30,
+  -30, -30, 0, 0, 0, 0, -30, -30,
+  -50, -30, -30, -30, -30, -30, -30, -50,
 }
 
+var MG_TABLES = [6][64]int32 { MG_PAWN_TABLE, MG_KNIGHT_TABLE, MG_BISHOP_TABLE, MG_ROOK_TABLE, MG_QUEEN_TABLE, MG_KING_TABLE }
+var EG_TABLES = [6][64]int32 { EG_PAWN_TABLE, EG_KNIGHT_TABLE, EG_BISHOP_TABLE, EG_ROOK_TABLE, EG_QUEEN_TABLE, EG_KING_TABLE }
+
+// the table for every piece (by zobristPieceIndex) on every square, from that piece's own side.
+// Black's are white's flipped, so a black pawn on e7 scores what a white pawn on e2 does
+var MG_PST [12][64]int32
+var EG_PST [12][64]int32
+
+// flips a square top to bottom, a8 <-> a1. Since a8 is 0 this is just flipping the rank bits
+func mirrorSquare(square int) int {
+  return square ^ 56
+}
+
+func init() {
+  buildPieceSquareTables()
+}
+
+// has to run again whenever MG_TABLES or EG_TABLES change
+func buildPieceSquareTables() {
+  for kind := 0; kind < 6; kind++ {
+    for square := 0; square < 64; square++ {
+      MG_PST[kind][square] = MG_TABLES[kind][square]
+      EG_PST[kind][square] = EG_TABLES[kind][square]
+      MG_PST[kind + 6][square] = MG_TABLES[kind][mirrorSquare(square)]
+      EG_PST[kind + 6][square] = EG_TABLES[kind][mirrorSquare(square)]
+    }
+  }
+}
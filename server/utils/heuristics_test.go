@@ -0,0 +1,101 @@
+package utils
+
+import (
+  "strings"
+  "testing"
+)
+
+// the same position with the colors swapped and the board flipped top to bottom
+func mirrorFEN(fen string) string {
+  fields := strings.Fields(fen)
+  swapCase := func(s string) string {
+    return strings.Map(func(r rune) rune {
+      if r >= 'a' && r <= 'z' {
+        return r - 'a' + 'A'
+      }
+      if r >= 'A' && r <= 'Z' {
+        return r - 'A' + 'a'
+      }
+      return r
+    }, s)
+  }
+
+  ranks := strings.Split(fields[0], "/")
+  for i, j := 0, len(ranks) - 1; i < j; i, j = i + 1, j - 1 {
+    ranks[i], ranks[j] = ranks[j], ranks[i]
+  }
+  fields[0] = swapCase(strings.Join(ranks, "/"))
+
+  if fields[1] == "w" {
+    fields[1] = "b"
+  } else {
+    fields[1] = "w"
+  }
+  if fields[2] != "-" {
+    fields[2] = swapCase(fields[2])
+  }
+  if fields[3] != "-" {
+    fields[3] = fields[3][0:1] + string('1' + '8' - fields[3][1])
+  }
+  return strings.Join(fields, " ")
+}
+
+func TestEvaluateIsSymmetric(t *testing.T) {
+  for _, position := range perftPositions {
+    var board, mirrored Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    if err := InitBoardFromFEN(&mirrored, mirrorFEN(position.fen)); err != nil {
+      t.Fatal(err)
+    }
+
+    if Evaluate(&board) != -Evaluate(&mirrored) {
+      t.Errorf("%s: scored %d, but %d with the colors swapped", position.name, Evaluate(&board), Evaluate(&mirrored))
+    }
+  }
+}
+
+func TestGamePhase(t *testing.T) {
+  phases := []struct {
+    fen string
+    phase int32
+  }{
+    { STARTING_FEN, TOTAL_PHASE },
+    { "4k3/pppppppp/8/8/8/8/PPPPPPPP/4K3 w - - 0 1", 0 },
+    { "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", 2 },
+    { "k7/2QQQQQQ/8/8/8/8/8/1QQQK3 w - - 0 1", TOTAL_PHASE }, // more than the starting material
+  }
+
+  for _, position := range phases {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    if got := GamePhase(&board); got != position.phase {
+      t.Errorf("%s: phase %d, want %d", position.fen, got, position.phase)
+    }
+  }
+}
+
+func TestKingWantsTheCenterInTheEndgame(t *testing.T) {
+  var corner, center Bitboard
+  load := func(board *Bitboard, fen string) {
+    if err := InitBoardFromFEN(board, fen); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  load(&corner, "4k3/pppp4/8/8/8/8/PPPP4/K7 w - - 0 1")
+  load(&center, "4k3/pppp4/8/8/3K4/8/PPPP4/8 w - - 0 1")
+  if Evaluate(&center) <= Evaluate(&corner) {
+    t.Errorf("king in the center scored %d, in the corner %d", Evaluate(&center), Evaluate(&corner))
+  }
+
+  // with most of the pieces still on, it's better off tucked away
+  load(&corner, "rnbqk3/pppp4/8/8/8/8/PPPP4/RNBQ2K1 w - - 0 1")
+  load(&center, "rnbqk3/pppp4/8/8/3K4/8/PPPP4/RNBQ4 w - - 0 1")
+  if Evaluate(&center) >= Evaluate(&corner) {
+    t.Errorf("king in the center scored %d, in the corner %d", Evaluate(&center), Evaluate(&corner))
+  }
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+  "strings"
+)
+
+// =================================== CHECKS AND PINS ===================================
+func kingOf(bitboard *Bitboard, isWhite bool) uint64 {
+  if isWhite {
+    return bitboard.whiteKing
+  }
+  return bitboard.blackKing
+}
+
+// returns the enemy pieces that are giving check to the king of the given color
+func Checkers(bitboard *Bitboard, isWhite bool) uint64 {
+  king := kingOf(bitboard, isWhite)
+  if king == 0 {
+    return 0
+  }
+  return AttackersOf(king, !isWhite, bitboard)
+}
+
+func IsInCheck(bitboard *Bitboard, isWhite bool) bool {
+  return Checkers(bitboard, isWhite) != 0
+}
+
+// returns the pieces of the given color that can't leave the line between their king and an enemy slider
+func PinnedPieces(bitboard *Bitboard, isWhite bool) uint64 {
+  king := kingOf(bitboard, isWhite)
+  if king == 0 {
+    return 0
+  }
+
+  var ownPieces, straightSliders, diagonalSliders uint64
+  if isWhite {
+    ownPieces = WhitePieces(bitboard)
+    straightSliders = bitboard.blackRooks | bitboard.blackQueens
+    diagonalSliders = bitboard.blackBishops | bitboard.blackQueens
+  } else {
+    ownPieces = BlackPieces(bitboard)
+    straightSliders = bitboard.whiteRooks | bitboard.whiteQueens
+    diagonalSliders = bitboard.whiteBishops | bitboard.whiteQueens
+  }
+  occupied := WhitePieces(bitboard) | BlackPieces(bitboard)
+
+  var pinned uint64
+  for _, dir := range rayDirections {
+    sliders := straightSliders
+    if dir.diagonal {
+      sliders = diagonalSliders
+    }
+
+    // the first piece on the ray has to be ours, and the one behind it has to be an enemy slider
+    blocker := rayAttacks(king, occupied, dir) & occupied
+    if blocker == 0 || (blocker & ownPieces) == 0 {
+      continue
+    }
+    behind := rayAttacks(blocker, occupied, dir) & occupied
+    if (behind & sliders) != 0 {
+      pinned |= blocker
+    }
+  }
+
+  return pinned
+}
+
+// =================================== LEGALITY ===================================
+func isEnPassantCapture(typeOfPiece uint8, from uint64, to uint64, bitboard *Bitboard) bool {
+  if typeOfPiece & 0x1 == 0 || bitboard.enPassant == 0 || to != bitboard.enPassant {
+    return false
+  }
+  // a pawn only changes file when it captures
+  return (from >> 8) != to && (from << 8) != to
+}
+
+func isCastlingMove(typeOfPiece uint8, from uint64, to uint64) bool {
+  return typeOfPiece & 0x20 != 0 && ((from << 2) == to || (from >> 2) == to)
+}
+
+// plays the move on a copy of the piece sets and checks if the mover's king is left attacked
+func leavesKingAttacked(typeOfPiece uint8, from uint64, to uint64, bitboard *Bitboard) bool {
+  isWhite := typeOfPiece & WHITE_MASK != 0
+  after := *bitboard // shares the mailbox, which is only read from here
+
+  if captured := bitboard.mailbox[GetMailBoxIndex(to)]; captured != 0 {
+    if capturePiece, ok := PieceCaptureFuncs[captured]; ok {
+      capturePiece(&after, to)
+    }
+  }
+
+  if isEnPassantCapture(typeOfPiece, from, to, bitboard) {
+    if isWhite {
+      after.blackPawns &= ^(to << 8)
+    } else {
+      after.whitePawns &= ^(to >> 8)
+    }
+  }
+
+  if movePiece, ok := PieceMoveFuncs[typeOfPiece]; ok {
+    movePiece(&after, from, to)
+  }
+
+  king := kingOf(&after, isWhite)
+  return king != 0 && IsSquareAttacked(king, !isWhite, &after)
+}
+
+// the king can't castle out of, through or into check, and the rook has to still be in its corner
+func castlingIsLegal(typeOfPiece uint8, from uint64, to uint64, bitboard *Bitboard) bool {
+  isWhite := typeOfPiece == WHITE_KING
+  occupied := WhitePieces(bitboard) | BlackPieces(bitboard)
+
+  var rooks uint64
+  if isWhite {
+    rooks = bitboard.whiteRooks
+  } else {
+    rooks = bitboard.blackRooks
+  }
+
+  var passing, rookSquare uint64
+  if (from << 2) == to { // king side
+    passing = from << 1
+    rookSquare = from << 3
+  } else { // queen side
+    passing = from >> 1
+    rookSquare = from >> 4
+    if (from >> 3) & occupied != 0 {
+      return false
+    }
+  }
+
+  if rookSquare & rooks == 0 || (passing | to) & occupied != 0 {
+    return false
+  }
+
+  return !IsSquareAttacked(from, !isWhite, bitboard) &&
+    !IsSquareAttacked(passing, !isWhite, bitboard) &&
+    !IsSquareAttacked(to, !isWhite, bitboard)
+}
+
+// filters pseudo legal moves down to the ones that don't leave the mover's king in check
+func filterLegalMoves(typeOfPiece uint8, piece uint64, moves []uint64, bitboard *Bitboard) []uint64 {
+  isWhite := typeOfPiece & WHITE_MASK != 0
+  inCheck := IsInCheck(bitboard, isWhite)
+  pinned := PinnedPieces(bitboard, isWhite)
+  isKing := typeOfPiece & 0x20 != 0
+
+  legalMoves := make([]uint64, 0, len(moves))
+  for _, to := range moves {
+    if isCastlingMove(typeOfPiece, piece, to) {
+      if castlingIsLegal(typeOfPiece, piece, to, bitboard) {
+        legalMoves = append(legalMoves, to)
+      }
+      continue
+    }
+
+    // a piece that isn't pinned can't expose its own king unless it's already in check
+    // (en passant is the odd one out since it takes two pieces off the same rank)
+    if !inCheck && !isKing && (piece & pinned) == 0 && !isEnPassantCapture(typeOfPiece, piece, to, bitboard) {
+      legalMoves = append(legalMoves, to)
+      continue
+    }
+
+    if !leavesKingAttacked(typeOfPiece, piece, to, bitboard) {
+      legalMoves = append(legalMoves, to)
+    }
+  }
+
+  return legalMoves
+}
+
+// returns every legal move for the side whose turn it is
+func GenerateAllMoves(bitboard *Bitboard) []Move {
+  var moves []Move
+  for i := 0; i < 64; i++ {
+    piece := bitboard.mailbox[i]
+    if piece == 0 || (piece & WHITE_MASK != 0) != bitboard.whiteTurn {
+      continue
+    }
+    from := uint64(1) << i
+    for _, to := range GetValidMoves(piece, from, bitboard) {
+      if piece & 0x1 != 0 && to & (RANK_1 | RANK_8) != 0 {
+        for _, promotion := range PROMOTION_PIECES {
+          moves = append(moves, BuildMove(piece, from, to, promotion, bitboard))
+        }
+        continue
+      }
+      moves = append(moves, BuildMove(piece, from, to, 0, bitboard))
+    }
+  }
+  return moves
+}
+
+func IsValidMove(typeOfPiece uint8, from uint64, to uint64, bitboard *Bitboard) bool {
+  for _, move := range GetValidMoves(typeOfPiece, from, bitboard) {
+    if move == to {
+      return true
+    }
+  }
+  return false
+}
+
+// =================================== VALIDATING A REQUESTED MOVE ===================================
+const (
+  MOVE_ERR_UNKNOWN_PIECE = "unknown_piece"
+  MOVE_ERR_OFF_BOARD = "off_board"
+  MOVE_ERR_EMPTY_SQUARE = "empty_square"
+  MOVE_ERR_PIECE_MISMATCH = "piece_mismatch"
+  MOVE_ERR_WRONG_TURN = "wrong_turn"
+  MOVE_ERR_ILLEGAL = "illegal_move"
+  MOVE_ERR_GAME_OVER = "game_over"
+  MOVE_ERR_INVALID_PROMOTION = "invalid_promotion"
+)
+
+type MoveError struct {
+  Code string `json:"code"`
+  Message string `json:"message"`
+}
+
+func (e *MoveError) Error() string {
+  return e.Code + ": " + e.Message
+}
+
+// checks a move coming from outside the engine without touching the board.
+// Returns nil if it can be passed to MakeMove, or a *MoveError saying why not
+func ValidateMove(typeOfPiece uint8, from uint64, to uint64, bitboard *Bitboard) error {
+  if _, ok := PieceMoveFuncs[typeOfPiece]; !ok {
+    return &MoveError{ MOVE_ERR_UNKNOWN_PIECE, "unknown piece type" }
+  }
+
+  if from == 0 || to == 0 {
+    return &MoveError{ MOVE_ERR_OFF_BOARD, "square is off the board" }
+  }
+
+  onSquare := PieceAt(bitboard, from)
+  if onSquare == 0 {
+    return &MoveError{ MOVE_ERR_EMPTY_SQUARE, "there is no piece on the from square" }
+  }
+
+  if onSquare != typeOfPiece {
+    return &MoveError{ MOVE_ERR_PIECE_MISMATCH, "the piece on the from square is not the one being moved" }
+  }
+
+  if (typeOfPiece & WHITE_MASK != 0) != bitboard.whiteTurn {
+    return &MoveError{ MOVE_ERR_WRONG_TURN, "it is not this side's turn to move" }
+  }
+
+  if !IsValidMove(typeOfPiece, from, to, bitboard) {
+    return &MoveError{ MOVE_ERR_ILLEGAL, "the piece can't legally move to that square" }
+  }
+
+  return nil
+}
+
+// works out what a pawn promotes to from one of the letters in PROMOTION_LETTERS (either case).
+// No letter means a queen, and a letter on a move that isn't a promotion is a *MoveError
+func ParsePromotion(letter string, typeOfPiece uint8, to uint64) (uint8, error) {
+  promotes := typeOfPiece & 0x1 != 0 && to & (RANK_1 | RANK_8) != 0
+  if letter == "" {
+    return 0, nil
+  }
+  if !promotes {
+    return 0, &MoveError{ MOVE_ERR_INVALID_PROMOTION, "only a pawn reaching the last rank can promote" }
+  }
+  promotion, ok := PROMOTION_LETTERS[strings.ToLower(letter)]
+  if !ok {
+    return 0, &MoveError{ MOVE_ERR_INVALID_PROMOTION, "a pawn can only promote to q, r, b or n, not " + letter }
+  }
+  return promotion, nil
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+  "slices"
+  "testing"
+)
+
+// the legal moves of the piece on from, in UCI and sorted
+func movesFrom(t *testing.T, bitboard *Bitboard, from string) []string {
+  t.Helper()
+  square, err := SquareFromName(from)
+  if err != nil {
+    t.Fatal(err)
+  }
+  moves := []string{}
+  for _, move := range GenerateAllMoves(bitboard) {
+    if move.From() == square {
+      moves = append(moves, MoveToUCI(move))
+    }
+  }
+  slices.Sort(moves)
+  return moves
+}
+
+func TestLegalMoves(t *testing.T) {
+  tests := []struct {
+    name string
+    fen string
+    from string
+    want []string
+  }{
+    // a pinned piece can only move along the pin, a knight never can
+    { "pinned knight", "4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", "e2", []string{} },
+    { "pinned rook", "4k3/4r3/8/8/8/8/4R3/4K3 w - - 0 1", "e2", []string{ "e2e3", "e2e4", "e2e5", "e2e6", "e2e7" } },
+    { "pinned bishop", "4k3/8/8/b7/8/8/3B4/4K3 w - - 0 1", "d2", []string{ "d2a5", "d2b4", "d2c3" } },
+    { "pinned pawn", "4k3/8/8/8/7b/8/5P2/4K3 w - - 0 1", "f2", []string{} },
+
+    // in double check only the king can move, and not along the line of the rook
+    { "double check", "4k3/8/8/8/8/5n2/8/r3K2R w K - 0 1", "e1", []string{ "e1e2", "e1f2" } },
+    { "double check, nothing else moves", "4k3/8/8/8/8/5n2/8/r3K2R w K - 0 1", "h1", []string{} },
+
+    // taking en passant takes two pawns off the rank the king is on
+    { "en passant", "8/8/8/K2pP3/8/8/8/4k3 w - d6 0 1", "e5", []string{ "e5d6", "e5e6" } },
+    { "en passant exposing the king", "8/8/8/K2pP2r/8/8/8/4k3 w - d6 0 1", "e5", []string{ "e5e6" } },
+
+    // castling
+    { "castling", "4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1", []string{ "e1c1", "e1d1", "e1d2", "e1e2", "e1f1", "e1f2", "e1g1" } },
+    { "castling out of check", "4r1k1/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1", []string{ "e1d1", "e1d2", "e1f1", "e1f2" } },
+    { "castling through check", "5rk1/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1", []string{ "e1c1", "e1d1", "e1d2", "e1e2" } },
+    { "castling into check", "3k2r1/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1", []string{ "e1c1", "e1d1", "e1d2", "e1e2", "e1f1", "e1f2" } },
+    { "the rook can pass an attacked square", "1r1k4/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1", []string{ "e1c1", "e1d1", "e1d2", "e1e2", "e1f1", "e1f2", "e1g1" } },
+  }
+
+  for _, test := range tests {
+    bitboard := boardFromFEN(t, test.fen)
+    if got := movesFrom(t, bitboard, test.from); !slices.Equal(got, test.want) {
+      t.Errorf("%s: %s has %v, want %v", test.name, test.from, got, test.want)
+    }
+  }
+}
+
+func TestChecksAndPins(t *testing.T) {
+  square := func(name string) uint64 {
+    s, err := SquareFromName(name)
+    if err != nil {
+      t.Fatal(err)
+    }
+    return s
+  }
+
+  bitboard := boardFromFEN(t, "4k3/8/8/8/8/5n2/8/r3K2R w K - 0 1")
+  if checkers := Checkers(bitboard, true); checkers != square("a1") | square("f3") {
+    t.Errorf("checkers %x, want the rook and the knight", checkers)
+  }
+
+  // the rook on e2 and the knight on b4 are pinned, the knight on g1 is one of two pieces in the way
+  bitboard = boardFromFEN(t, "4k3/4r3/8/b7/1N6/8/4R3/4KBNq w - - 0 1")
+  if pinned := PinnedPieces(bitboard, true); pinned != square("e2") | square("b4") {
+    t.Errorf("pinned %x, want e2 and b4", pinned)
+  }
+  if IsInCheck(bitboard, true) || IsInCheck(bitboard, false) {
+    t.Error("nobody should be in check")
+  }
+}
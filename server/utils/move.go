@@ -0,0 +1,149 @@
+package utils
+
+// =================================== MOVES ===================================
+// a move packed into 32 bits. Everything MakeMove needs and everything UnmakeMove needs to put
+// the board back is in here, so a move is the same size as an int and can be compared with ==
+//
+//  bits  0-5   from square (mailbox index)
+//  bits  6-11  to square
+//  bits 12-15  the piece that moves
+//  bits 16-19  the piece that gets captured, if any
+//  bits 20-23  the piece a pawn promotes to, if any
+//  bits 24-27  flags
+//
+// pieces are stored as 1 + their zobrist index, so 0 always means "none"
+type Move uint32
+
+const NO_MOVE Move = 0
+
+const (
+  MOVE_FLAG_DOUBLE_PUSH uint8 = 0x1 // a pawn moved two squares and left an en passant square behind
+  MOVE_FLAG_EN_PASSANT uint8 = 0x2 // the captured pawn isn't on the square the pawn moved to
+  MOVE_FLAG_CASTLING uint8 = 0x4 // the king moved two squares, the rook goes with it
+)
+
+// the piece codes in the order of their zobrist index, with nothing in front
+var PACKED_PIECES = [13]uint8{
+  0,
+  WHITE_PAWN, WHITE_KNIGHT, WHITE_BISHOP, WHITE_ROOK, WHITE_QUEEN, WHITE_KING,
+  BLACK_PAWN, BLACK_KNIGHT, BLACK_BISHOP, BLACK_ROOK, BLACK_QUEEN, BLACK_KING,
+}
+
+// what a pawn can promote to, best first. Only the kind of piece matters, BuildMove gives it the pawn's color
+var PROMOTION_PIECES = [4]uint8{ WHITE_QUEEN, WHITE_ROOK, WHITE_BISHOP, WHITE_KNIGHT }
+
+// the letters UCI and the /place API use for promotions, SAN uses the upper case ones
+var PROMOTION_LETTERS = map[string]uint8{ "q": WHITE_QUEEN, "r": WHITE_ROOK, "b": WHITE_BISHOP, "n": WHITE_KNIGHT }
+
+func PromotionLetter(piece uint8) string {
+  for letter, promotion := range PROMOTION_LETTERS {
+    if promotion & 0x3F == piece & 0x3F {
+      return letter
+    }
+  }
+  return ""
+}
+
+func packPiece(piece uint8) uint32 {
+  return uint32(zobristPieceIndex(piece) + 1)
+}
+
+func NewMove(piece uint8, from uint64, to uint64, captured uint8, promotion uint8, flags uint8) Move {
+  return Move(uint32(GetMailBoxIndex(from)) |
+    uint32(GetMailBoxIndex(to)) << 6 |
+    packPiece(piece) << 12 |
+    packPiece(captured) << 16 |
+    packPiece(promotion) << 20 |
+    uint32(flags) << 24)
+}
+
+// fills in the capture and the flags for a piece going from one square to the other on this
+// board. A pawn reaching the last rank promotes to promotion, or a queen if that's 0
+func BuildMove(piece uint8, from uint64, to uint64, promotion uint8, bitboard *Bitboard) Move {
+  captured := PieceAt(bitboard, to)
+  var flags uint8
+
+  if piece & 0x1 != 0 {
+    if isEnPassantCapture(piece, from, to, bitboard) {
+      flags |= MOVE_FLAG_EN_PASSANT
+      captured = BLACK_PAWN
+      if piece == BLACK_PAWN {
+        captured = WHITE_PAWN
+      }
+    } else if (from >> 16) == to || (from << 16) == to {
+      flags |= MOVE_FLAG_DOUBLE_PUSH
+    }
+
+    if to & (RANK_1 | RANK_8) != 0 {
+      if promotion == 0 {
+        promotion = WHITE_QUEEN
+      }
+      // only the kind of piece is taken from promotion, the color is always the pawn's
+      promotion = (promotion &^ (WHITE_MASK | BLACK_MASK)) | (piece & (WHITE_MASK | BLACK_MASK))
+    } else {
+      promotion = 0
+    }
+  } else {
+    promotion = 0
+    if isCastlingMove(piece, from, to) {
+      flags |= MOVE_FLAG_CASTLING
+    }
+  }
+
+  return NewMove(piece, from, to, captured, promotion, flags)
+}
+
+func (move Move) From() uint64 {
+  return uint64(1) << (uint32(move) & 0x3F)
+}
+
+func (move Move) To() uint64 {
+  return uint64(1) << ((uint32(move) >> 6) & 0x3F)
+}
+
+func (move Move) Piece() uint8 {
+  return PACKED_PIECES[(uint32(move) >> 12) & 0xF]
+}
+
+func (move Move) Captured() uint8 {
+  return PACKED_PIECES[(uint32(move) >> 16) & 0xF]
+}
+
+func (move Move) Promotion() uint8 {
+  return PACKED_PIECES[(uint32(move) >> 20) & 0xF]
+}
+
+func (move Move) Flags() uint8 {
+  return uint8(uint32(move) >> 24)
+}
+
+func (move Move) IsCapture() bool {
+  return move.Captured() != 0
+}
+
+func (move Move) IsPromotion() bool {
+  return move.Promotion() != 0
+}
+
+func (move Move) IsEnPassant() bool {
+  return move.Flags() & MOVE_FLAG_EN_PASSANT != 0
+}
+
+func (move Move) IsCastling() bool {
+  return move.Flags() & MOVE_FLAG_CASTLING != 0
+}
+
+func (move Move) IsDoublePush() bool {
+  return move.Flags() & MOVE_FLAG_DOUBLE_PUSH != 0
+}
+
+// the square the captured piece was standing on, which is only different from To for en passant
+func (move Move) CaptureSquare() uint64 {
+  if !move.IsEnPassant() {
+    return move.To()
+  }
+  if move.Piece() == WHITE_PAWN {
+    return move.To() << 8
+  }
+  return move.To() >> 8
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestMovePacking(t *testing.T) {
+  from, to := uint64(1) << 9, uint64(1) << 0 // b7 takes on a8
+  move := NewMove(WHITE_PAWN, from, to, BLACK_ROOK, WHITE_KNIGHT, 0)
+  if move.From() != from || move.To() != to || move.Piece() != WHITE_PAWN || move.Captured() != BLACK_ROOK || move.Promotion() != WHITE_KNIGHT {
+    t.Errorf("packed move came back as %s %x %x %x %x", MoveToUCI(move), move.Piece(), move.Captured(), move.Promotion(), move.Flags())
+  }
+  if move.IsEnPassant() || move.IsCastling() || move.IsDoublePush() || !move.IsCapture() || !move.IsPromotion() {
+    t.Errorf("wrong flags %x", move.Flags())
+  }
+}
+
+// every move in the tree gets played and taken back, and after UnmakeMove the board has to be
+// exactly what it was, down to the history, the clocks and the hash
+func roundTrip(t *testing.T, bitboard *Bitboard, depth int) {
+  if depth == 0 {
+    return
+  }
+
+  var moves []Move
+  for _, move := range GenerateAllMoves(bitboard) {
+    moves = append(moves, move)
+    // promotions to every piece, not just the ones the generator hands out
+    if move.IsPromotion() {
+      for _, promotion := range []uint8{ WHITE_KNIGHT, WHITE_BISHOP, WHITE_ROOK, WHITE_QUEEN } {
+        if other := BuildMove(move.Piece(), move.From(), move.To(), promotion, bitboard); other != move {
+          moves = append(moves, other)
+        }
+      }
+    }
+  }
+
+  for _, move := range moves {
+    before := CopyBitboard(bitboard)
+    MakeMove(move, bitboard)
+    roundTrip(t, bitboard, depth - 1)
+    UnmakeMove(bitboard)
+
+    if !sameBoard(&before, bitboard) {
+      t.Fatalf("%s then UnmakeMove on %s left %s", MoveToUCI(move), GetFEN(&before), GetFEN(bitboard))
+    }
+  }
+}
+
+// everything in the struct has to match, an empty history is the same as no history
+func sameBoard(a *Bitboard, b *Bitboard) bool {
+  x, y := CopyBitboard(a), CopyBitboard(b)
+  if len(x.history) == 0 {
+    x.history = nil
+  }
+  if len(y.history) == 0 {
+    y.history = nil
+  }
+  return reflect.DeepEqual(x, y)
+}
+
+func TestMakeUnmakeRoundTrip(t *testing.T) {
+  for _, position := range perftPositions {
+    t.Run(position.name, func(t *testing.T) {
+      var bitboard Bitboard
+      if err := InitBoardFromFEN(&bitboard, position.fen); err != nil {
+        t.Fatal(err)
+      }
+      roundTrip(t, &bitboard, 3)
+    })
+  }
+}
+
+func TestNullMoveRoundTrip(t *testing.T) {
+  for _, position := range perftPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    before := CopyBitboard(&board)
+
+    MakeNullMove(&board)
+    if board.whiteTurn == before.whiteTurn || board.hash != ComputeHash(&board) {
+      t.Errorf("%s: the null move didn't pass the turn cleanly", position.name)
+    }
+    UnmakeNullMove(&board)
+    if !sameBoard(&board, &before) {
+      t.Errorf("%s: board changed after a null move and back", position.name)
+    }
+  }
+}
@@ -0,0 +1,238 @@
+package utils
+
+// =================================== MOVE ORDERING ===================================
+// alpha-beta cuts off as soon as one move is good enough, so the sooner the best move gets tried
+// the less of the tree gets searched. The picker hands moves out one at a time in stages, best
+// guesses first, and only does the work for a stage once the search actually gets to it. A cutoff
+// on the hash move never even generates the other moves
+const (
+  PICK_HASH = iota // the best move the transposition table remembers
+  PICK_GENERATE
+  PICK_GOOD_CAPTURES // captures that don't lose material, most valuable victim / least valuable attacker first
+  PICK_PROMOTIONS // promotions that don't capture
+  PICK_KILLERS // quiet moves that caused a cutoff at the same ply somewhere else in the tree
+  PICK_QUIETS // everything else, by history score
+  PICK_BAD_CAPTURES // captures SEE says lose material
+  PICK_DONE
+)
+
+const MAX_HISTORY = 1 << 20 // history scores get halved once any of them reaches this
+
+// how often a quiet move by this piece to this square caused a cutoff, weighted by depth
+type historyTable [12][64]int32
+
+func (history *historyTable) add(move Move, depth int) {
+  index := zobristPieceIndex(move.Piece())
+  if index < 0 {
+    return
+  }
+  entry := &history[index][GetMailBoxIndex(move.To())]
+  *entry += int32(depth * depth)
+  if *entry >= MAX_HISTORY {
+    history.age()
+  }
+}
+
+func (history *historyTable) score(move Move) int32 {
+  index := zobristPieceIndex(move.Piece())
+  if index < 0 {
+    return 0
+  }
+  return history[index][GetMailBoxIndex(move.To())]
+}
+
+// old cutoffs count for less than new ones, without forgetting them completely
+func (history *historyTable) age() {
+  for piece := range history {
+    for square := range history[piece] {
+      history[piece][square] /= 2
+    }
+  }
+}
+
+type scoredMove struct {
+  move Move
+  score int32
+}
+
+// most valuable victim first, and for the same victim the least valuable attacker first
+func mvvLva(move Move) int32 {
+  return seeValue(move.Captured()) * 100 - seeValue(move.Piece()) + seeValue(move.Promotion())
+}
+
+type movePicker struct {
+  bitboard *Bitboard
+  stage int
+  tacticalOnly bool // quiescence only wants captures and promotions that don't lose material
+
+  hashMove Move
+  killers [2]Move
+  history *historyTable
+
+  captures []scoredMove
+  promotions []scoredMove
+  quiets []scoredMove
+  badCaptures []scoredMove
+  killerIndex int
+}
+
+func newMovePicker(bitboard *Bitboard, hashMove Move, killers [2]Move, history *historyTable) *movePicker {
+  return &movePicker{ bitboard: bitboard, hashMove: hashMove, killers: killers, history: history }
+}
+
+// for quiescence: no hash move, no killers, no quiet moves and no losing captures
+func newTacticalPicker(bitboard *Bitboard) *movePicker {
+  return &movePicker{ bitboard: bitboard, stage: PICK_GENERATE, tacticalOnly: true }
+}
+
+// a move from the table or a killer came from some other position, it might not even be legal here.
+// The capture and flags packed into it have to match this board too, or MakeMove would get it wrong
+func (picker *movePicker) isLegal(move Move) bool {
+  if move == NO_MOVE || PieceAt(picker.bitboard, move.From()) != move.Piece() {
+    return false
+  }
+  if BuildMove(move.Piece(), move.From(), move.To(), move.Promotion(), picker.bitboard) != move {
+    return false
+  }
+  return IsValidMove(move.Piece(), move.From(), move.To(), picker.bitboard)
+}
+
+func (picker *movePicker) alreadyPicked(move Move) bool {
+  if move == picker.hashMove {
+    return true
+  }
+  for i := 0; i < picker.killerIndex; i++ {
+    if move == picker.killers[i] {
+      return true
+    }
+  }
+  return false
+}
+
+func (picker *movePicker) generate() {
+  bitboard := picker.bitboard
+  for _, move := range GenerateAllMoves(bitboard) {
+    switch {
+    case picker.tacticalOnly && move.IsPromotion() && move.Promotion() & 0x10 == 0:
+      // an underpromotion is almost never better than a queen, quiescence doesn't bother with them
+    case move.IsCapture():
+      if SEE(move, bitboard) >= 0 {
+        picker.captures = append(picker.captures, scoredMove{ move, mvvLva(move) })
+      } else if !picker.tacticalOnly {
+        picker.badCaptures = append(picker.badCaptures, scoredMove{ move, mvvLva(move) })
+      }
+    case move.IsPromotion():
+      picker.promotions = append(picker.promotions, scoredMove{ move, seeValue(move.Promotion()) })
+    case !picker.tacticalOnly:
+      picker.quiets = append(picker.quiets, scoredMove{ move, 0 })
+    }
+  }
+
+  // quiet moves only get their history scores looked up if the search gets that far
+}
+
+// takes the highest scoring move out of the list. Picking one at a time instead of sorting
+// means a cutoff after the first couple of moves never pays for ordering the rest
+func pickBest(moves *[]scoredMove) (Move, bool) {
+  list := *moves
+  if len(list) == 0 {
+    return NO_MOVE, false
+  }
+  best := 0
+  for i := 1; i < len(list); i++ {
+    if list[i].score > list[best].score {
+      best = i
+    }
+  }
+  move := list[best].move
+  list[best] = list[len(list) - 1]
+  *moves = list[:len(list) - 1]
+  return move, true
+}
+
+// hands out the next move to search, false once every legal move has been handed out
+func (picker *movePicker) next() (Move, bool) {
+  for {
+    switch picker.stage {
+    case PICK_HASH:
+      picker.stage++
+      if picker.isLegal(picker.hashMove) {
+        return picker.hashMove, true
+      }
+      picker.hashMove = NO_MOVE
+
+    case PICK_GENERATE:
+      picker.generate()
+      picker.stage++
+
+    case PICK_GOOD_CAPTURES:
+      for {
+        move, ok := pickBest(&picker.captures)
+        if !ok {
+          break
+        }
+        if !picker.alreadyPicked(move) {
+          return move, true
+        }
+      }
+      picker.stage++
+
+    case PICK_PROMOTIONS:
+      for {
+        move, ok := pickBest(&picker.promotions)
+        if !ok {
+          break
+        }
+        if !picker.alreadyPicked(move) {
+          return move, true
+        }
+      }
+      picker.stage++
+      if picker.tacticalOnly {
+        picker.stage = PICK_DONE
+      }
+
+    case PICK_KILLERS:
+      for picker.killerIndex < len(picker.killers) {
+        killer := picker.killers[picker.killerIndex]
+        picker.killerIndex++
+        if killer != picker.hashMove && picker.isLegal(killer) && !isTactical(killer) {
+          return killer, true
+        }
+      }
+      picker.stage++
+      if picker.history != nil {
+        for i := range picker.quiets {
+          picker.quiets[i].score = picker.history.score(picker.quiets[i].move)
+        }
+      }
+
+    case PICK_QUIETS:
+      for {
+        move, ok := pickBest(&picker.quiets)
+        if !ok {
+          break
+        }
+        if !picker.alreadyPicked(move) {
+          return move, true
+        }
+      }
+      picker.stage++
+
+    case PICK_BAD_CAPTURES:
+      for {
+        move, ok := pickBest(&picker.badCaptures)
+        if !ok {
+          break
+        }
+        if !picker.alreadyPicked(move) {
+          return move, true
+        }
+      }
+      picker.stage++
+
+    default:
+      return NO_MOVE, false
+    }
+  }
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+  "testing"
+)
+
+func pickAll(picker *movePicker) []Move {
+  var moves []Move
+  for move, ok := picker.next(); ok; move, ok = picker.next() {
+    moves = append(moves, move)
+  }
+  return moves
+}
+
+// whatever hash move and killers it's given, the picker has to hand out every legal move once
+func TestPickerHandsOutEveryMoveOnce(t *testing.T) {
+  for _, position := range perftPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    legal := GenerateAllMoves(&board)
+
+    // a legal hash move and killer, an illegal killer and a killer that's really a capture
+    bogus := NewMove(WHITE_QUEEN, uint64(1), uint64(1) << 63, 0, 0, 0)
+    var history historyTable
+    history.add(legal[len(legal) - 1], 5)
+    picked := pickAll(newMovePicker(&board, legal[len(legal) / 2], [2]Move{ legal[0], bogus }, &history))
+
+    if len(picked) != len(legal) {
+      t.Errorf("%s: picked %d moves, there are %d", position.name, len(picked), len(legal))
+    }
+    seen := map[Move]bool{}
+    for _, move := range picked {
+      if seen[move] {
+        t.Errorf("%s: %s picked twice", position.name, MoveToUCI(move))
+      }
+      seen[move] = true
+    }
+    for _, move := range legal {
+      if !seen[move] {
+        t.Errorf("%s: %s never picked", position.name, MoveToUCI(move))
+      }
+    }
+    if picked[0] != legal[len(legal) / 2] {
+      t.Errorf("%s: the hash move wasn't first", position.name)
+    }
+  }
+}
+
+func TestPickerOrder(t *testing.T) {
+  var board Bitboard
+  // Nxd5 wins the exchange and Nxc6 a pawn, Qxd5 loses the queen for a rook once cxd5 comes back
+  if err := InitBoardFromFEN(&board, "1k6/7P/2p5/3r4/1N6/8/3Q4/4K3 w - - 0 1"); err != nil {
+    t.Fatal(err)
+  }
+  killer := NewMove(WHITE_KING, uint64(1) << 60, uint64(1) << 61, 0, 0, 0)
+  picked := pickAll(newMovePicker(&board, NO_MOVE, [2]Move{ killer }, nil))
+
+  // the knight and bishop promotions are worth the same, so they can come in either order
+  want := []string{ "b4d5", "b4c6", "h7h8q", "h7h8r", "", "", "e1f1" }
+  for i, uci := range want {
+    if uci == "" {
+      continue
+    }
+    if MoveToUCI(picked[i]) != uci {
+      t.Errorf("move %d was %s, want %s", i + 1, MoveToUCI(picked[i]), uci)
+    }
+  }
+  if last := MoveToUCI(picked[len(picked) - 1]); last != "d2d5" {
+    t.Errorf("the losing capture should go last, got %s", last)
+  }
+}
+
+func TestTacticalPicker(t *testing.T) {
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, "1k6/7P/2p5/3r4/1N6/8/3Q4/4K3 w - - 0 1"); err != nil {
+    t.Fatal(err)
+  }
+  for _, move := range pickAll(newTacticalPicker(&board)) {
+    if !isTactical(move) || SEE(move, &board) < 0 {
+      t.Errorf("quiescence was handed %s", MoveToUCI(move))
+    }
+  }
+}
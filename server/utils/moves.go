@@ -95,20 +95,20 @@ func GetPawnMoves(pawnPosition uint64, bitboard *Bitboard, isWhite bool) []uint6
     }
   }
 
-  // capture moves
-  tmpMove := pawnPosition >> 7
+  // capture moves (masking the file stops the pawn from wrapping around the edge of the board)
+  tmpMove := (pawnPosition >> 7) &^ A_File
   if isWhite && (tmpMove & oppositeColorPieces != 0 || tmpMove & bitboard.enPassant != 0) {
     moves = append(moves, tmpMove)
   }
-  tmpMove = pawnPosition >> 9
+  tmpMove = (pawnPosition >> 9) &^ H_File
   if isWhite && (tmpMove & oppositeColorPieces != 0 || tmpMove & bitboard.enPassant != 0) {
     moves = append(moves, tmpMove)
   }
-  tmpMove = pawnPosition << 7
+  tmpMove = (pawnPosition << 7) &^ H_File
   if !isWhite && (tmpMove & oppositeColorPieces != 0 || tmpMove & bitboard.enPassant != 0) {
     moves = append(moves, tmpMove)
   }
-  tmpMove = pawnPosition << 9
+  tmpMove = (pawnPosition << 9) &^ A_File
   if !isWhite && (tmpMove & oppositeColorPieces != 0 || tmpMove & bitboard.enPassant != 0) {
     moves = append(moves, tmpMove)
   }
@@ -237,9 +237,9 @@ func GetKingMoves(kingPosition uint64, bitboard *Bitboard, isWhite bool) []uint6
 
   possibleMoves := []uint64{
     kingPosition << 8, kingPosition >> 8,
-    kingPosition << 1, kingPosition >> 1,
-    kingPosition << 7, kingPosition << 9,
-    kingPosition >> 7, kingPosition >> 9,
+    (kingPosition << 1) &^ A_File, (kingPosition >> 1) &^ H_File,
+    (kingPosition << 7) &^ H_File, (kingPosition << 9) &^ A_File,
+    (kingPosition >> 7) &^ A_File, (kingPosition >> 9) &^ H_File,
   }
 
   for _, move := range possibleMoves {
@@ -248,14 +248,16 @@ func GetKingMoves(kingPosition uint64, bitboard *Bitboard, isWhite bool) []uint6
     }
   }
 
-  rights := squaresAreGettingAttacked(bitboard, isWhite)
+  // castling only needs the rights and the empty squares here, the legal move filter
+  // checks that the king isn't castling out of, through or into check
+  rights := bitboard.castlingRights
 
   if isWhite && (rights & 1 != 0) { // white king side
     if (kingPosition << 1) & allPieces == 0 && (kingPosition << 2) & allPieces == 0 { moves = append(moves, kingPosition << 2) }
   }
 
   if isWhite && (rights & 2 != 0) { // white queen side 
-    if (kingPosition >> 1) & allPieces == 0 && (kingPosition >> 2) & allPieces == 0 {
+    if (kingPosition >> 1) & allPieces == 0 && (kingPosition >> 2) & allPieces == 0 && (kingPosition >> 3) & allPieces == 0 {
       moves = append(moves, kingPosition >> 2) 
     }
   }
@@ -265,170 +267,8 @@ func GetKingMoves(kingPosition uint64, bitboard *Bitboard, isWhite bool) []uint6
   }
 
   if !isWhite && (rights & 0x40 != 0) { // black queen side
-    if (kingPosition >> 1) & allPieces == 0 && (kingPosition >> 2) & allPieces == 0 { moves = append(moves, kingPosition >> 2) }
+    if (kingPosition >> 1) & allPieces == 0 && (kingPosition >> 2) & allPieces == 0 && (kingPosition >> 3) & allPieces == 0 { moves = append(moves, kingPosition >> 2) }
   }
 
   return moves
 }
-
-func squaresAreGettingAttacked(bitboard *Bitboard, isWhite bool) uint8 {
-  rights := bitboard.castlingRights
-
-  if isWhite {
-    // ==================== Checking the knights ============================
-    kingSideSquareAttackers := uint64(62197173760032768)
-    queenSideSquareAttackers := uint64(35816591274803200)
-
-    if kingSideSquareAttackers & bitboard.blackKnights > 0 {
-      rights &= 0xC2
-    } else if queenSideSquareAttackers & bitboard.blackKnights > 0 {
-      rights &= 0xC1
-    }
-
-    // ========================== Checking the rooks/queens ====================
-    checkRank := func(start int) bool {
-      for start > 0 {
-        if bitboard.mailbox[start] == BLACK_ROOK || bitboard.mailbox[start] == BLACK_QUEEN {
-          return true
-        } else if bitboard.mailbox[start] != 0 {
-          return false
-        }
-        start -= 8
-      }
-      return false
-    }
-
-    if checkRank(62-8) || checkRank(61-8) || checkRank(60-8) { // king side
-      rights &= 0xC2
-    }
-
-    if checkRank(57-8) || checkRank(58-8) || checkRank(59-8) || checkRank(60-8) { // queen side
-      rights &= 0xC1
-    }
-
-    // ========================== Checking the bishops/queens ====================
-    checkDiagonal := func(start int, increment int) bool {
-      for start > 0 {
-        if bitboard.mailbox[start] == BLACK_BISHOP || bitboard.mailbox[start] == BLACK_QUEEN {
-          return true
-        } else if bitboard.mailbox[start] != 0 {
-          return false
-        }
-        start += increment
-      }
-      return false
-    }
-
-    if checkDiagonal(61, -7) || checkDiagonal(61, -9) || checkDiagonal(62, -7) || checkDiagonal(62, -9) { // king side
-      rights &= 0xC2
-    }
-
-    if checkDiagonal(57, -7) || checkDiagonal(57, -9) || checkDiagonal(58, -7) || checkDiagonal(58, -9) || checkDiagonal(59, -7) || checkDiagonal(59, -9) {
-      rights &= 0xC1
-    }
-
-    // ========================= pawn ========================================
-    pawnAttackers := uint64(69805794224242688)
-    if pawnAttackers & bitboard.blackPawns > 0 {
-      rights &= 0xC2
-    }
-
-    pawnAttackers = uint64(17732923532771328)
-    if pawnAttackers & bitboard.blackPawns > 0 {
-      rights &= 0xC1
-    }
-
-    // ========================= king ========================================
-    kingAttackers := uint64(54043195528445952)
-    if kingAttackers & bitboard.blackKing > 0 {
-      rights &= 0xC2
-    }
-
-    kingAttackers = uint64(1970324836974592)
-    if kingAttackers & bitboard.blackKing > 0 {
-      rights &= 0xC1
-    }
-
-  } else { // this is for black
-    // ==================== Checking the knights ============================
-    kingSideSquareAttackers := uint64(16309248)
-    queenSideSquareAttackers := uint64(4161280)
-
-    if kingSideSquareAttackers & bitboard.whiteKnights > 0 {
-      rights &= 0x43
-    }
-
-    if queenSideSquareAttackers & bitboard.whiteKnights > 0 {
-      rights &= 0x83
-    }
-
-
-    // ========================== Checking the rooks/queens ====================
-    checkRank := func(start int) bool {
-      for start < 64 {
-        if bitboard.mailbox[start] == WHITE_ROOK || bitboard.mailbox[start] == WHITE_QUEEN {
-          return true
-        } else if bitboard.mailbox[start] != 0 {
-          return false
-        }
-        start += 8
-      }
-      return false
-    }
-
-    if checkRank(4+8) || checkRank(5+8) || checkRank(6+8) { // king side
-      rights &= 0x43
-    }
-
-    if checkRank(1+8) || checkRank(2+8) || checkRank(3+8) || checkRank(4+8) { // queen side
-      rights &= 0x83
-    }
-
-    // ========================== Checking the bishops/queens ====================
-    checkDiagonal := func(start int, increment int) bool {
-      for start < 64 {
-        if bitboard.mailbox[start] == WHITE_BISHOP || bitboard.mailbox[start] == WHITE_QUEEN {
-          return true
-        } else if bitboard.mailbox[start] != 0 {
-          return false
-        }
-        start += increment
-      }
-      return false
-    }
-
-    if checkDiagonal(4, 7) || checkDiagonal(4, 9) || checkDiagonal(5, 7) || checkDiagonal(5, 9) || checkDiagonal(6, 7) || checkDiagonal(6, 9){ // king side
-      rights &= 0x43
-    }
-
-    if checkDiagonal(1, 7) || checkDiagonal(1, 9) || checkDiagonal(2, 7) || checkDiagonal(2, 9) || checkDiagonal(3, 7) || checkDiagonal(3, 9) || checkDiagonal(4, 7) || checkDiagonal(4, 9){
-      rights &= 0x83
-    }
-
-    // ========================= pawn ========================================
-    pawnAttackers := uint64(63488) // check these numbers
-    if pawnAttackers & bitboard.whitePawns > 0 {
-      rights &= 0x43
-    }
-
-    pawnAttackers = uint64(16128) // check these numbers
-    if pawnAttackers & bitboard.whitePawns > 0 {
-      rights &= 0x83
-    }
-
-    // ========================= king ========================================
-    kingAttackers := uint64(63488) // check these numbers
-    if kingAttackers & bitboard.whiteKing > 0 {
-      rights &= 0x43
-    }
-
-    kingAttackers = uint64(16128) // check these numbers
-    if kingAttackers & bitboard.whiteKing > 0 {
-      rights &= 0x83
-    }
-  }
-
-  return rights
-}
-
-
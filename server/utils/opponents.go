@@ -0,0 +1,111 @@
+package utils
+
+import (
+  "context"
+  "math/rand"
+)
+
+// =================================== OPPONENTS ===================================
+// weaker players for people who can't beat the real search yet. From weakest to strongest:
+// a random mover, a greedy bot that grabs whatever is worth the most, and the search itself
+// with less depth and a noisy eval
+
+// a legal move picked uniformly at random, NO_MOVE if there aren't any
+func RandomAI_move(bitboard *Bitboard, whiteTurn bool) Move {
+  if whiteTurn != bitboard.whiteTurn {
+    return NO_MOVE
+  }
+  moves := GenerateAllMoves(bitboard)
+  if len(moves) == 0 {
+    return NO_MOVE
+  }
+  return moves[rand.Intn(len(moves))]
+}
+
+// takes the most valuable piece it can, with the cheapest piece that can take it. It doesn't
+// look at what happens next, so it'll happily take a defended pawn with its queen.
+// With nothing to take it moves at random
+func GreedyAI_move(bitboard *Bitboard, whiteTurn bool) Move {
+  if whiteTurn != bitboard.whiteTurn {
+    return NO_MOVE
+  }
+
+  var best []Move
+  var bestScore int32
+  for _, move := range GenerateAllMoves(bitboard) {
+    if !move.IsCapture() {
+      continue
+    }
+    score := mvvLva(move)
+    if len(best) == 0 || score > bestScore {
+      best, bestScore = []Move{ move }, score
+    } else if score == bestScore {
+      best = append(best, move)
+    }
+  }
+
+  if len(best) == 0 {
+    return RandomAI_move(bitboard, whiteTurn)
+  }
+  return best[rand.Intn(len(best))]
+}
+
+// =================================== SKILL LEVELS ===================================
+// 0 is the random mover, 1 the greedy bot, and 2 to 19 the search held to SKILL_DEPTHS plies
+// with SKILL_NOISE centipawns of noise in its eval. 20 is the engine at full strength
+const MAX_SKILL_LEVEL = 20
+
+var SKILL_DEPTHS = [MAX_SKILL_LEVEL + 1]int{ 0, 0, 1, 1, 1, 2, 2, 2, 3, 3, 3, 4, 4, 4, 5, 5, 6, 6, 7, 8, 0 }
+var SKILL_NOISE = [MAX_SKILL_LEVEL + 1]int32{ 0, 0, 300, 260, 220, 190, 160, 140, 120, 100, 85, 70, 60, 50, 40, 30, 25, 20, 15, 10, 0 }
+
+// plays a move at the given skill level. Below MAX_SKILL_LEVEL the search gets its own table
+// and a single thread, so the noise doesn't end up in the table the real engine uses, and no
+// tablebase. The book runs out sooner the lower the level, a weak player that knows twenty plies
+// of theory by heart doesn't feel weak
+func SkillAI_move(ctx context.Context, bitboard *Bitboard, whiteTurn bool, level int, limits SearchLimits, options SearchOptions, report func(SearchResult)) SearchResult {
+  level = min(max(level, 0), MAX_SKILL_LEVEL)
+
+  switch level {
+  case 0, 1:
+    move := RandomAI_move(bitboard, whiteTurn)
+    if level == 1 {
+      move = GreedyAI_move(bitboard, whiteTurn)
+    }
+    if move == NO_MOVE {
+      return SearchResult{}
+    }
+    return SearchResult{ Move: move, PV: []Move{ move } }
+
+  case MAX_SKILL_LEVEL:
+    return IterativeAI_move(ctx, bitboard, whiteTurn, limits, options, report)
+  }
+
+  if limits.Depth <= 0 || limits.Depth > SKILL_DEPTHS[level] {
+    limits.Depth = SKILL_DEPTHS[level]
+  }
+  options.TT, options.Threads, options.Noise = nil, 1, SKILL_NOISE[level]
+  options.Tablebase = nil // playing endgames perfectly doesn't go with blundering the middlegame
+  options.Book = skillBook(options.Book, level)
+  return IterativeAI_move(ctx, bitboard, whiteTurn, limits, options, report)
+}
+
+// the lowest level that gets any of the book
+const SKILL_BOOK_LEVEL = 10
+
+// no book below SKILL_BOOK_LEVEL, and from there a share of its depth that grows with the level
+func skillBook(book *Book, level int) *Book {
+  if book == nil || level < SKILL_BOOK_LEVEL {
+    return nil
+  }
+  depth := book.Depth
+  if depth == 0 {
+    depth = MAX_BOOK_DEPTH
+  }
+  depth = depth * (level - SKILL_BOOK_LEVEL + 1) / (MAX_SKILL_LEVEL - SKILL_BOOK_LEVEL + 1)
+  if depth == 0 {
+    return nil
+  }
+  limited := *book
+  limited.Depth = depth
+  return &limited
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+  "context"
+  "testing"
+)
+
+func isGenerated(move Move, bitboard *Bitboard) bool {
+  for _, legal := range GenerateAllMoves(bitboard) {
+    if legal == move {
+      return true
+    }
+  }
+  return false
+}
+
+func TestRandomMoverPlaysLegalMoves(t *testing.T) {
+  for _, position := range perftPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    for i := 0; i < 20; i++ {
+      if move := RandomAI_move(&board, IsWhiteTurn(&board)); !isGenerated(move, &board) {
+        t.Errorf("%s: random move %s isn't legal", position.name, MoveToUCI(move))
+      }
+    }
+    if move := RandomAI_move(&board, !IsWhiteTurn(&board)); move != NO_MOVE {
+      t.Errorf("%s: moved out of turn", position.name)
+    }
+  }
+
+  var stalemate Bitboard
+  InitBoardFromFEN(&stalemate, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+  if move := RandomAI_move(&stalemate, false); move != NO_MOVE {
+    t.Errorf("found %s in stalemate", MoveToUCI(move))
+  }
+}
+
+func TestGreedyTakesTheBiggestPiece(t *testing.T) {
+  captures := []struct {
+    name string
+    fen string
+    want string
+  }{
+    { "queen over pawn", "4k3/8/8/3q1p2/4P3/8/8/4K3 w - - 0 1", "e4d5" },
+    { "cheapest taker first", "4k3/8/8/3r4/4P3/8/3Q4/4K3 w - - 0 1", "e4d5" },
+    { "even if it's defended", "4k3/8/2p5/3p4/8/8/8/3QK3 w - - 0 1", "d1d5" },
+  }
+  for _, capture := range captures {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, capture.fen); err != nil {
+      t.Fatal(err)
+    }
+    if move := GreedyAI_move(&board, true); MoveToUCI(move) != capture.want {
+      t.Errorf("%s: played %s, want %s", capture.name, MoveToUCI(move), capture.want)
+    }
+  }
+}
+
+func TestSkillLevels(t *testing.T) {
+  var board Bitboard
+  InitBoard(&board)
+
+  for level := 0; level <= MAX_SKILL_LEVEL; level += 5 {
+    result := SkillAI_move(context.Background(), &board, true, level, SearchLimits{ Depth: 4 }, SearchOptions{}, nil)
+    if !isGenerated(result.Move, &board) {
+      t.Errorf("level %d played %s", level, MoveToUCI(result.Move))
+    }
+    if level > 1 && level < MAX_SKILL_LEVEL && result.Depth > SKILL_DEPTHS[level] {
+      t.Errorf("level %d searched to depth %d", level, result.Depth)
+    }
+  }
+
+  // full strength still finds the mate
+  var mate Bitboard
+  InitBoardFromFEN(&mate, searchPositions[0].fen)
+  result := SkillAI_move(context.Background(), &mate, true, MAX_SKILL_LEVEL, SearchLimits{ Depth: 2 }, SearchOptions{}, nil)
+  if MoveToUCI(result.Move) != searchPositions[0].best {
+    t.Errorf("level %d played %s, want %s", MAX_SKILL_LEVEL, MoveToUCI(result.Move), searchPositions[0].best)
+  }
+}
+
+func TestSkillLevelsCutTheBookShort(t *testing.T) {
+  var board Bitboard
+  InitBoard(&board)
+  e4, err := ParseUCIMove("e2e4", &board)
+  if err != nil {
+    t.Fatal(err)
+  }
+  book := buildBook(t, func(builder *BookBuilder) {
+    builder.Add(&board, e4, 2)
+  })
+  book.Depth = DEFAULT_BOOK_DEPTH
+
+  if skillBook(book, SKILL_BOOK_LEVEL - 1) != nil {
+    t.Errorf("level %d kept the book", SKILL_BOOK_LEVEL - 1)
+  }
+  previous := 0
+  for level := SKILL_BOOK_LEVEL; level < MAX_SKILL_LEVEL; level++ {
+    limited := skillBook(book, level)
+    if limited == nil || limited.Depth < previous || limited.Depth >= DEFAULT_BOOK_DEPTH {
+      t.Fatalf("level %d got the book %v plies deep", level, limited)
+    }
+    previous = limited.Depth
+  }
+  if book.Depth != DEFAULT_BOOK_DEPTH {
+    t.Error("cutting the book down changed the engine's own book")
+  }
+
+  // at the bottom of the search levels the book is gone and the move comes from the search
+  result := SkillAI_move(context.Background(), &board, true, 2, SearchLimits{ Depth: 1 }, SearchOptions{ Book: book }, nil)
+  if result.Book {
+    t.Error("level 2 played from the book")
+  }
+  result = SkillAI_move(context.Background(), &board, true, 19, SearchLimits{ Depth: 1 }, SearchOptions{ Book: book }, nil)
+  if !result.Book || result.Move != e4 {
+    t.Errorf("level 19 played %s without the book", MoveToUCI(result.Move))
+  }
+}
+
+func TestEvalNoiseIsStable(t *testing.T) {
+  var board Bitboard
+  InitBoard(&board)
+  s := newSearcher(&board, nil, DEFAULT_FEATURES)
+  s.noise, s.noiseSeed = 50, 12345
+
+  noise := s.evalNoise()
+  if noise < -50 || noise > 50 {
+    t.Errorf("noise %d is out of range", noise)
+  }
+  if s.evalNoise() != noise {
+    t.Error("the same position got different noise")
+  }
+}
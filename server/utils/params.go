@@ -0,0 +1,107 @@
+package utils
+
+import (
+  "encoding/json"
+  "fmt"
+  "go/format"
+  "os"
+  "reflect"
+  "strings"
+)
+
+// =================================== EVAL PARAMETERS ===================================
+// every number the eval is built from, in one place so it can be tuned, saved and loaded.
+// Tables are from white's side with a8 first, the same as in heuristics.go
+type EvalParams struct {
+  MGPieceValues [6]int32 `json:"mg_piece_values"`
+  EGPieceValues [6]int32 `json:"eg_piece_values"`
+  MGTables [6][64]int32 `json:"mg_tables"`
+  EGTables [6][64]int32 `json:"eg_tables"`
+  Weights EvalWeights `json:"weights"`
+}
+
+func CurrentParams() EvalParams {
+  return EvalParams{ MG_PIECE_VALUES, EG_PIECE_VALUES, MG_TABLES, EG_TABLES, Weights }
+}
+
+// makes Evaluate use params. Pawn tables filled in with the old ones have to be cleared,
+// and this can't run while a search is going
+func LoadParams(params EvalParams) {
+  MG_PIECE_VALUES, EG_PIECE_VALUES = params.MGPieceValues, params.EGPieceValues
+  MG_TABLES, EG_TABLES = params.MGTables, params.EGTables
+  Weights = params.Weights
+  buildPieceSquareTables()
+}
+
+// loads a JSON file written by WriteParams. Anything missing from the file keeps its current value
+func LoadParamsFile(path string) error {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return err
+  }
+  params := CurrentParams()
+  if err := json.Unmarshal(data, &params); err != nil {
+    return fmt.Errorf("%s: %v", path, err)
+  }
+  LoadParams(params)
+  return nil
+}
+
+// writes params as JSON, or as Go source if path ends in .go. The Go file goes in this package
+// and loads itself when the engine starts
+func WriteParams(path string, params EvalParams) error {
+  var data []byte
+  if strings.HasSuffix(path, ".go") {
+    var source strings.Builder
+    source.WriteString("package utils\n\n// written by the tune command\nvar TUNED_PARAMS = ")
+    writeGoLiteral(&source, reflect.ValueOf(params))
+    source.WriteString("\n\nfunc init() {\n  LoadParams(TUNED_PARAMS)\n}\n")
+    formatted, err := format.Source([]byte(source.String()))
+    if err != nil {
+      return err
+    }
+    data = formatted
+  } else {
+    encoded, err := json.MarshalIndent(params, "", "  ")
+    if err != nil {
+      return err
+    }
+    data = append(encoded, '\n')
+  }
+  return os.WriteFile(path, data, 0644)
+}
+
+// the parameters are only int32s, arrays and structs of them, all declared in this package,
+// so every value is spelled out with its field names and no package qualifiers
+func writeGoLiteral(source *strings.Builder, value reflect.Value) {
+  switch value.Kind() {
+  case reflect.Int32:
+    fmt.Fprintf(source, "%d", value.Int())
+  case reflect.Array:
+    fmt.Fprintf(source, "%s{", goTypeName(value.Type()))
+    for i := 0; i < value.Len(); i++ {
+      if i > 0 {
+        source.WriteString(", ")
+      }
+      writeGoLiteral(source, value.Index(i))
+    }
+    source.WriteString("}")
+  case reflect.Struct:
+    fmt.Fprintf(source, "%s{\n", goTypeName(value.Type()))
+    for i := 0; i < value.NumField(); i++ {
+      fmt.Fprintf(source, "%s: ", value.Type().Field(i).Name)
+      writeGoLiteral(source, value.Field(i))
+      source.WriteString(",\n")
+    }
+    source.WriteString("}")
+  default:
+    panic(fmt.Sprintf("no Go literal for a %s", value.Type()))
+  }
+}
+
+func goTypeName(t reflect.Type) string {
+  if t.Kind() == reflect.Array {
+    return fmt.Sprintf("[%d]%s", t.Len(), goTypeName(t.Elem()))
+  }
+  return t.Name()
+}
@@ -0,0 +1,54 @@
+package utils
+
+// =================================== PAWN HASH TABLE ===================================
+// pawns hardly ever move compared to everything else, so the pawn structure part of the eval
+// is worked out once per arrangement of pawns and looked up after that. Entries are keyed by
+// the two pawn bitboards themselves, so a hit is never a collision. The empty entry is the
+// position without pawns, which really does score zero.
+// The scores depend on Weights, so the table has to be cleared if those change
+
+const DEFAULT_PAWN_HASH_ENTRIES = 1 << 14
+
+type pawnEntry struct {
+  whitePawns uint64
+  blackPawns uint64
+  score [2]Weight // white's and black's
+}
+
+type PawnHashTable struct {
+  entries []pawnEntry
+  mask uint64
+}
+
+// size is rounded down to a power of two
+func NewPawnHashTable(size int) *PawnHashTable {
+  count := 1
+  for count * 2 <= size {
+    count *= 2
+  }
+  return &PawnHashTable{ entries: make([]pawnEntry, count), mask: uint64(count - 1) }
+}
+
+func (t *PawnHashTable) Clear() {
+  for i := range t.entries {
+    t.entries[i] = pawnEntry{}
+  }
+}
+
+func (t *PawnHashTable) entry(whitePawns uint64, blackPawns uint64) *pawnEntry {
+  key := whitePawns * 0x9E3779B97F4A7C15 ^ blackPawns * 0xC2B2AE3D27D4EB4F
+  key ^= key >> 29
+  return &t.entries[key & t.mask]
+}
+
+func (t *PawnHashTable) Probe(whitePawns uint64, blackPawns uint64) ([2]Weight, bool) {
+  entry := t.entry(whitePawns, blackPawns)
+  if entry.whitePawns != whitePawns || entry.blackPawns != blackPawns {
+    return [2]Weight{}, false
+  }
+  return entry.score, true
+}
+
+func (t *PawnHashTable) Store(whitePawns uint64, blackPawns uint64, score [2]Weight) {
+  *t.entry(whitePawns, blackPawns) = pawnEntry{ whitePawns, blackPawns, score }
+}
@@ -0,0 +1,45 @@
+package utils
+
+// =================================== PERFT ===================================
+// Perft counts every leaf of the legal move tree to the given depth. The counts for well
+// known positions are published, so any difference points at a bug in move generation
+// or in MakeMove/UnmakeMove.
+func Perft(bitboard *Bitboard, depth int) uint64 {
+  if depth == 0 {
+    return 1
+  }
+
+  moves := GenerateAllMoves(bitboard)
+  if depth == 1 {
+    return uint64(len(moves))
+  }
+
+  var nodes uint64
+  for _, move := range moves {
+    MakeMove(move, bitboard)
+    nodes += Perft(bitboard, depth - 1)
+    UnmakeMove(bitboard)
+  }
+  return nodes
+}
+
+type DivideResult struct {
+  Move Move
+  Nodes uint64
+}
+
+// Divide is perft split up by the first move, which makes it easy to find the move
+// where the counts stop matching another engine
+func Divide(bitboard *Bitboard, depth int) []DivideResult {
+  var results []DivideResult
+  if depth < 1 {
+    return results
+  }
+
+  for _, move := range GenerateAllMoves(bitboard) {
+    MakeMove(move, bitboard)
+    results = append(results, DivideResult{ move, Perft(bitboard, depth - 1) })
+    UnmakeMove(bitboard)
+  }
+  return results
+}
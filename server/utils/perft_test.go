@@ -0,0 +1,84 @@
+package utils
+
+import (
+  "testing"
+)
+
+// reference counts from https://www.chessprogramming.org/Perft_Results
+var perftPositions = []struct {
+  name string
+  fen string
+  nodes []uint64 // nodes[i] is the count at depth i + 1
+}{
+  {
+    name: "startpos",
+    fen: STARTING_FEN,
+    nodes: []uint64{ 20, 400, 8902, 197281 },
+  },
+  {
+    name: "kiwipete",
+    fen: "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+    nodes: []uint64{ 48, 2039, 97862 },
+  },
+  {
+    name: "position 3",
+    fen: "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+    nodes: []uint64{ 14, 191, 2812, 43238 },
+  },
+  {
+    name: "position 4",
+    fen: "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+    nodes: []uint64{ 6, 264, 9467 },
+  },
+  {
+    name: "position 5",
+    fen: "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+    nodes: []uint64{ 44, 1486, 62379 },
+  },
+  {
+    name: "position 6",
+    fen: "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+    nodes: []uint64{ 46, 2079, 89890 },
+  },
+}
+
+func TestPerft(t *testing.T) {
+  for _, position := range perftPositions {
+    t.Run(position.name, func(t *testing.T) {
+      var bitboard Bitboard
+      if err := InitBoardFromFEN(&bitboard, position.fen); err != nil {
+        t.Fatal(err)
+      }
+
+      for i, want := range position.nodes {
+        depth := i + 1
+        if testing.Short() && depth > 3 {
+          break
+        }
+        if got := Perft(&bitboard, depth); got != want {
+          t.Errorf("depth %d: got %d nodes, want %d", depth, got, want)
+        }
+      }
+
+      // every MakeMove was undone, so the board has to be back where it started
+      if fen := GetFEN(&bitboard); fen != GetStartingFEN(&bitboard) {
+        t.Errorf("board changed during perft: %s", fen)
+      }
+    })
+  }
+}
+
+func TestDivideAddsUpToPerft(t *testing.T) {
+  var bitboard Bitboard
+  InitBoard(&bitboard)
+
+  var total uint64
+  results := Divide(&bitboard, 3)
+  for _, result := range results {
+    total += result.Nodes
+  }
+
+  if len(results) != 20 || total != 8902 {
+    t.Errorf("got %d moves adding up to %d, want 20 moves adding up to 8902", len(results), total)
+  }
+}
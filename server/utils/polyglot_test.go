@@ -0,0 +1,145 @@
+package utils
+
+import (
+  "bytes"
+  "context"
+  "testing"
+)
+
+// the examples from the polyglot book format description
+func TestPolyglotKeys(t *testing.T) {
+  tests := []struct {
+    moves []string
+    key uint64
+  }{
+    { nil, 0x463b96181691fc9c },
+    { []string{ "e2e4" }, 0x823c9b50fd114196 },
+    { []string{ "e2e4", "d7d5" }, 0x0756b94461c50fb0 },
+    { []string{ "e2e4", "d7d5", "e4e5" }, 0x662fafb965db29d4 },
+    { []string{ "e2e4", "d7d5", "e4e5", "f7f5" }, 0x22a48b5a8e47ff78 },
+    { []string{ "e2e4", "d7d5", "e4e5", "f7f5", "e1e2" }, 0x652a607ca3f242c1 },
+    { []string{ "e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7" }, 0x00fdd303c946bdd9 },
+    { []string{ "a2a4", "b7b5", "h2h4", "b5b4", "c2c4" }, 0x3c8123ea7b067637 },
+    { []string{ "a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3" }, 0x5c3f9b829b279560 },
+  }
+
+  for _, test := range tests {
+    var bitboard Bitboard
+    InitBoard(&bitboard)
+    playUCIMoves(t, &bitboard, test.moves...)
+    if key := PolyglotKey(&bitboard); key != test.key {
+      t.Errorf("after %v: key %016x, want %016x", test.moves, key, test.key)
+    }
+  }
+}
+
+func TestBookMoveEncoding(t *testing.T) {
+  tests := []struct {
+    fen string
+    move string
+    code uint16
+  }{
+    { STARTING_FEN, "e2e4", 4 | 3 << 3 | 4 << 6 | 1 << 9 },
+    { "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", 7 | 4 << 6 }, // castling is the king taking its rook
+    { "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", 7 << 3 | 4 << 6 | 7 << 9 },
+    { "8/P6k/8/8/8/8/8/K7 w - - 0 1", "a7a8n", 7 << 3 | 6 << 9 | 1 << 12 },
+  }
+
+  for _, test := range tests {
+    var bitboard Bitboard
+    if err := InitBoardFromFEN(&bitboard, test.fen); err != nil {
+      t.Fatal(err)
+    }
+    move, err := ParseUCIMove(test.move, &bitboard)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if code := EncodeBookMove(move); code != test.code {
+      t.Errorf("%s: encoded as %04x, want %04x", test.move, code, test.code)
+    }
+    if decoded := decodeBookMove(test.code, &bitboard); decoded != move {
+      t.Errorf("%s: %04x decoded as %s", test.move, test.code, MoveToUCI(decoded))
+    }
+  }
+}
+
+func buildBook(t *testing.T, add func(builder *BookBuilder)) *Book {
+  builder := NewBookBuilder()
+  add(builder)
+  var file bytes.Buffer
+  if _, err := builder.Write(&file, 1); err != nil {
+    t.Fatal(err)
+  }
+  book, err := ReadBook(&file)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return book
+}
+
+func TestBookProbe(t *testing.T) {
+  var bitboard Bitboard
+  InitBoard(&bitboard)
+  move := func(text string) Move {
+    move, err := ParseUCIMove(text, &bitboard)
+    if err != nil {
+      t.Fatal(err)
+    }
+    return move
+  }
+
+  book := buildBook(t, func(builder *BookBuilder) {
+    builder.Add(&bitboard, move("e2e4"), 2)
+    builder.Add(&bitboard, move("e2e4"), 1)
+    builder.Add(&bitboard, move("d2d4"), 1)
+    builder.Add(&bitboard, move("g1h3"), 0) // never scored anything, so it's left out
+  })
+
+  moves := book.Moves(&bitboard)
+  if len(moves) != 2 || moves[0] != (BookMove{ move("e2e4"), 3 }) || moves[1] != (BookMove{ move("d2d4"), 1 }) {
+    t.Fatalf("book moves %v", moves)
+  }
+
+  book.Best = true
+  if got := book.Probe(&bitboard); got != move("e2e4") {
+    t.Errorf("best book move %s, want e2e4", MoveToUCI(got))
+  }
+
+  book.Best = false
+  seen := map[Move]int{}
+  for i := 0; i < 400; i++ {
+    seen[book.Probe(&bitboard)]++
+  }
+  if len(seen) != 2 || seen[move("e2e4")] <= seen[move("d2d4")] {
+    t.Errorf("weighted picks %v", seen)
+  }
+
+  // the search plays the book move without searching
+  result := IterativeAI_move(context.Background(), &bitboard, true, SearchLimits{ Depth: 4 }, SearchOptions{ Book: book }, nil)
+  if !result.Book || result.Nodes != 0 || (result.Move != move("e2e4") && result.Move != move("d2d4")) {
+    t.Errorf("search with a book gave %s, book %v, %d nodes", MoveToUCI(result.Move), result.Book, result.Nodes)
+  }
+
+  // past the book depth the book stays quiet
+  book.Depth = 1
+  MakeMove(move("e2e4"), &bitboard)
+  var black Bitboard
+  InitBoard(&black)
+  if got := book.Probe(&bitboard); got != NO_MOVE {
+    t.Errorf("book played %s past its depth", MoveToUCI(got))
+  }
+  if book.Probe(&black) == NO_MOVE {
+    t.Errorf("book had nothing at the start")
+  }
+
+  var empty *Book
+  if empty.Probe(&black) != NO_MOVE {
+    t.Errorf("a nil book had a move")
+  }
+}
+
+func TestReadBookRejectsPartialEntries(t *testing.T) {
+  if _, err := ReadBook(bytes.NewReader(make([]byte, BOOK_ENTRY_SIZE + 3))); err == nil {
+    t.Errorf("read a book that isn't a whole number of entries")
+  }
+}
@@ -0,0 +1,230 @@
+package utils
+
+import (
+  "fmt"
+  "strings"
+)
+
+// =================================== STANDARD ALGEBRAIC NOTATION ===================================
+var PIECE_TO_SAN = map[uint8]string{
+  WHITE_PAWN: "", WHITE_KNIGHT: "N", WHITE_BISHOP: "B", WHITE_ROOK: "R", WHITE_QUEEN: "Q", WHITE_KING: "K",
+  BLACK_PAWN: "", BLACK_KNIGHT: "N", BLACK_BISHOP: "B", BLACK_ROOK: "R", BLACK_QUEEN: "Q", BLACK_KING: "K",
+}
+
+const SAN_EN_PASSANT_SUFFIX = " e.p."
+
+// turns a legal move on the given board into SAN, e.g. Nbd7, exd6, O-O-O, e8=Q+ or Qxf7#.
+// This is the strict form that goes into PGN files
+func MoveToSAN(move Move, bitboard *Bitboard) string {
+  return FormatSAN(move, bitboard, false)
+}
+
+// same as MoveToSAN, but can mark en passant captures the way people write them by hand (exd6 e.p.)
+func FormatSAN(move Move, bitboard *Bitboard, markEnPassant bool) string {
+  var san strings.Builder
+  enPassant := move.IsEnPassant()
+
+  if move.IsCastling() {
+    if (move.From() << 2) == move.To() {
+      san.WriteString("O-O")
+    } else {
+      san.WriteString("O-O-O")
+    }
+  } else {
+    isCapture := move.IsCapture()
+    from := SquareName(move.From())
+
+    if move.Piece() & 0x1 != 0 {
+      if isCapture {
+        san.WriteByte(from[0])
+      }
+    } else {
+      san.WriteString(PIECE_TO_SAN[move.Piece()])
+      san.WriteString(disambiguation(move, bitboard))
+    }
+
+    if isCapture {
+      san.WriteByte('x')
+    }
+    san.WriteString(SquareName(move.To()))
+
+    if move.IsPromotion() {
+      san.WriteString("=" + PIECE_TO_SAN[move.Promotion()])
+    }
+  }
+
+  san.WriteString(checkSuffix(move, bitboard))
+  if enPassant && markEnPassant {
+    san.WriteString(SAN_EN_PASSANT_SUFFIX)
+  }
+  return san.String()
+}
+
+// adds the file, the rank or both when another piece of the same kind could also reach the square
+func disambiguation(move Move, bitboard *Bitboard) string {
+  from := SquareName(move.From())
+  sameFile, sameRank, others := false, false, false
+
+  for i := 0; i < 64; i++ {
+    other := uint64(1) << i
+    if other == move.From() || bitboard.mailbox[i] != move.Piece() || !IsValidMove(move.Piece(), other, move.To(), bitboard) {
+      continue
+    }
+    others = true
+    otherName := SquareName(other)
+    if otherName[0] == from[0] {
+      sameFile = true
+    }
+    if otherName[1] == from[1] {
+      sameRank = true
+    }
+  }
+
+  switch {
+  case !others:
+    return ""
+  case !sameFile:
+    return from[:1]
+  case !sameRank:
+    return from[1:]
+  default:
+    return from
+  }
+}
+
+func checkSuffix(move Move, bitboard *Bitboard) string {
+  after := CopyBitboard(bitboard)
+  MakeMove(move, &after)
+  if !IsInCheck(&after, after.whiteTurn) {
+    return ""
+  }
+  if HasLegalMoves(&after) {
+    return "+"
+  }
+  return "#"
+}
+
+const (
+  MOVE_ERR_INVALID_SAN = "invalid_san"
+  MOVE_ERR_AMBIGUOUS = "ambiguous_move"
+)
+
+func sanError(code string, san string, reason string) error {
+  return &MoveError{ code, fmt.Sprintf("%s: %s", san, reason) }
+}
+
+// finds the legal move on the board that the SAN describes. Besides strict SAN it takes the
+// things people tend to type: 0-0, a leading P for pawns, e8Q or e8(Q), e.p. after en passant,
+// !/? annotations and fully spelled out moves like Ng1-f3. What it doesn't take is a capture
+// without the x (or :), or an x on a move that isn't one. Errors are always a *MoveError
+func ParseSAN(san string, bitboard *Bitboard) (Move, error) {
+  text := strings.TrimSpace(san)
+  text = strings.TrimSuffix(text, "e.p.")
+  text = strings.TrimSuffix(text, "ep")
+  text = strings.TrimSpace(text)
+  text = strings.TrimRight(text, "+#!?")
+  if text == "" {
+    return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "empty move")
+  }
+
+  moves := GenerateAllMoves(bitboard)
+
+  // ================= castling =================
+  if castling := strings.ReplaceAll(text, "0", "O"); castling == "O-O" || castling == "O-O-O" {
+    for _, move := range moves {
+      if !move.IsCastling() {
+        continue
+      }
+      if (castling == "O-O") == ((move.From() << 2) == move.To()) {
+        return move, nil
+      }
+    }
+    return NO_MOVE, sanError(MOVE_ERR_ILLEGAL, san, "castling is not legal here")
+  }
+
+  // ================= piece letter =================
+  pieceLetter := ""
+  if strings.ContainsRune("NBRQK", rune(text[0])) {
+    pieceLetter = text[:1]
+    text = text[1:]
+  } else if text[0] == 'P' {
+    text = text[1:]
+  }
+
+  // ================= promotion =================
+  promotion := ""
+  if pieceLetter == "" {
+    text = strings.TrimSuffix(text, ")")
+    if i := strings.IndexAny(text, "=(/"); i >= 0 {
+      promotion = text[i + 1:]
+      text = text[:i]
+    } else if len(text) > 2 && strings.ContainsRune("NBRQ", rune(text[len(text) - 1])) {
+      promotion = text[len(text) - 1:]
+      text = text[:len(text) - 1]
+    }
+  }
+  if promotion != "" && (len(promotion) != 1 || !strings.ContainsRune("NBRQ", rune(promotion[0]))) {
+    return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "a pawn can only promote to N, B, R or Q")
+  }
+
+  // ================= destination and disambiguation =================
+  if len(text) < 2 {
+    return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "missing the destination square")
+  }
+  to, err := SquareFromName(text[len(text) - 2:])
+  if err != nil {
+    return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, err.Error())
+  }
+  capture := strings.ContainsAny(text[:len(text) - 2], "x:")
+  hint := strings.NewReplacer("x", "", "-", "", ":", "").Replace(text[:len(text) - 2])
+  if len(hint) > 2 {
+    return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "too much in front of the destination square")
+  }
+  for i := 0; i < len(hint); i++ {
+    if (hint[i] < 'a' || hint[i] > 'h') && (hint[i] < '1' || hint[i] > '8') {
+      return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, fmt.Sprintf("%q is not a file or a rank", hint[i]))
+    }
+  }
+
+  var found []Move
+  for _, move := range moves {
+    if move.To() != to || PIECE_TO_SAN[move.Piece()] != pieceLetter {
+      continue
+    }
+    if move.IsCastling() {
+      continue
+    }
+    // without a promotion piece it's taken to be a queen, people leave the =Q off all the time
+    if move.IsPromotion() && PIECE_TO_SAN[move.Promotion()] != promotion && !(promotion == "" && move.Promotion() & 0x10 != 0) {
+      continue
+    }
+    from := SquareName(move.From())
+    matches := true
+    for i := 0; i < len(hint); i++ {
+      if hint[i] != from[0] && hint[i] != from[1] {
+        matches = false
+      }
+    }
+    if matches {
+      found = append(found, move)
+    }
+  }
+
+  switch len(found) {
+  case 0:
+    return NO_MOVE, sanError(MOVE_ERR_ILLEGAL, san, "no legal move matches")
+  case 1:
+    if promotion != "" && !found[0].IsPromotion() {
+      return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "the move is not a promotion")
+    }
+    if found[0].IsCapture() && !capture {
+      return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "the move is a capture, it needs an x")
+    }
+    if !found[0].IsCapture() && capture {
+      return NO_MOVE, sanError(MOVE_ERR_INVALID_SAN, san, "the move is not a capture")
+    }
+    return found[0], nil
+  default:
+    return NO_MOVE, sanError(MOVE_ERR_AMBIGUOUS, san, fmt.Sprintf("%d legal moves match", len(found)))
+  }
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+  "errors"
+  "testing"
+)
+
+func TestSAN(t *testing.T) {
+  tests := []struct {
+    name string
+    fen string
+    move string
+    san string
+    typed []string // other ways of writing it that have to parse to the same move
+  }{
+    { "file disambiguation", "rnbqkb1r/ppp2ppp/5n2/3pp3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 0 1", "b8d7", "Nbd7", []string{ "Nb8d7", "Nb8-d7" } },
+    { "rank disambiguation", "k7/8/8/8/8/4R3/8/K3R3 w - - 0 1", "e1e2", "R1e2", []string{ "Re1e2" } },
+    { "en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6", []string{ "exd6 e.p.", "exd6ep", "e5xd6", "e:d6" } },
+    { "king side castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O", []string{ "0-0" } },
+    { "queen side castling", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O", []string{ "0-0-0" } },
+    { "promotion with check", "8/4P3/5k2/8/8/8/8/K7 w - - 0 1", "e7e8n", "e8=N+", []string{ "e8N", "e8(N)" } },
+    { "mate", "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", "h5f7", "Qxf7#", []string{ "Qxf7", "Qh5xf7", "Q:f7" } },
+  }
+
+  for _, test := range tests {
+    var bitboard Bitboard
+    if err := InitBoardFromFEN(&bitboard, test.fen); err != nil {
+      t.Fatal(err)
+    }
+    move, err := ParseUCIMove(test.move, &bitboard)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if san := MoveToSAN(move, &bitboard); san != test.san {
+      t.Errorf("%s: %s written as %s, want %s", test.name, test.move, san, test.san)
+    }
+    for _, text := range append([]string{ test.san }, test.typed...) {
+      if parsed, err := ParseSAN(text, &bitboard); err != nil || parsed != move {
+        t.Errorf("%s: %q parsed as %s (%v), want %s", test.name, text, MoveToUCI(parsed), err, test.move)
+      }
+    }
+  }
+
+  // only marked when asked for
+  var enPassant Bitboard
+  InitBoardFromFEN(&enPassant, tests[2].fen)
+  move, _ := ParseUCIMove("e5d6", &enPassant)
+  if san := FormatSAN(move, &enPassant, true); san != "exd6" + SAN_EN_PASSANT_SUFFIX {
+    t.Errorf("marked en passant as %q", san)
+  }
+}
+
+func TestSANErrors(t *testing.T) {
+  tests := []struct {
+    fen string
+    san string
+    code string
+  }{
+    { "rnbqkb1r/ppp2ppp/5n2/3pp3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 0 1", "Nd7", MOVE_ERR_AMBIGUOUS },
+    { "k7/8/8/8/8/4R3/8/K3R3 w - - 0 1", "Re2", MOVE_ERR_AMBIGUOUS },
+    { STARTING_FEN, "Nz9", MOVE_ERR_INVALID_SAN },
+    { STARTING_FEN, "", MOVE_ERR_INVALID_SAN },
+    { STARTING_FEN, "Nb1cd3", MOVE_ERR_INVALID_SAN },
+    { "8/4P3/5k2/8/8/8/8/K7 w - - 0 1", "e8=K", MOVE_ERR_INVALID_SAN },
+    { STARTING_FEN, "Ke2", MOVE_ERR_ILLEGAL },
+    { STARTING_FEN, "O-O", MOVE_ERR_ILLEGAL },
+    { STARTING_FEN, "e5", MOVE_ERR_ILLEGAL },
+
+    // a capture has to say so, and only a capture can
+    { "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", "Qf7", MOVE_ERR_INVALID_SAN },
+    { "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "ed6", MOVE_ERR_INVALID_SAN },
+    { STARTING_FEN, "Nxf3", MOVE_ERR_INVALID_SAN },
+    { STARTING_FEN, "exe4", MOVE_ERR_INVALID_SAN },
+  }
+
+  for _, test := range tests {
+    var bitboard Bitboard
+    if err := InitBoardFromFEN(&bitboard, test.fen); err != nil {
+      t.Fatal(err)
+    }
+    move, err := ParseSAN(test.san, &bitboard)
+    var moveErr *MoveError
+    if !errors.As(err, &moveErr) || moveErr.Code != test.code {
+      t.Errorf("%q: got %s and %v, want a %s error", test.san, MoveToUCI(move), err, test.code)
+    }
+  }
+}
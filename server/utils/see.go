@@ -0,0 +1,116 @@
+package utils
+
+// =================================== STATIC EXCHANGE EVALUATION ===================================
+// plays out every capture on one square in the order each side would actually do it (cheapest
+// piece first), without searching, and says how much material the first capture wins or loses.
+// Pins are ignored, which is what keeps it cheap
+
+// piece values for SEE, in the same units as Evaluate. The king is worth so much that taking it
+// always wins, but it can never actually be traded for anything
+func seeValue(piece uint8) int32 {
+  value := PIECE_TO_VALUE[piece]
+  if value < 0 {
+    return -value
+  }
+  return value
+}
+
+// captures and promotions are what quiescence looks at
+func isTactical(move Move) bool {
+  return move.IsCapture() || move.IsPromotion()
+}
+
+// every piece of both colors that attacks square if only the squares in occupied had pieces on them.
+// Taking pieces out of occupied uncovers the sliders standing behind them
+func attackersWithOccupancy(square uint64, occupied uint64, bitboard *Bitboard) uint64 {
+  rooks := bitboard.whiteRooks | bitboard.whiteQueens | bitboard.blackRooks | bitboard.blackQueens
+  bishops := bitboard.whiteBishops | bitboard.whiteQueens | bitboard.blackBishops | bitboard.blackQueens
+
+  attackers := (KnightAttacks(square) & (bitboard.whiteKnights | bitboard.blackKnights)) |
+    (KingAttacks(square) & (bitboard.whiteKing | bitboard.blackKing)) |
+    (PawnAttacks(square, false) & bitboard.whitePawns) |
+    (PawnAttacks(square, true) & bitboard.blackPawns) |
+    (RookAttacks(square, occupied) & rooks) |
+    (BishopAttacks(square, occupied) & bishops)
+  return attackers & occupied
+}
+
+// cheapest first, the order the pieces come back in from leastValuableAttacker
+var SEE_ORDER = [2][6]uint8{
+  { BLACK_PAWN, BLACK_KNIGHT, BLACK_BISHOP, BLACK_ROOK, BLACK_QUEEN, BLACK_KING },
+  { WHITE_PAWN, WHITE_KNIGHT, WHITE_BISHOP, WHITE_ROOK, WHITE_QUEEN, WHITE_KING },
+}
+
+func leastValuableAttacker(attackers uint64, isWhite bool, bitboard *Bitboard) (uint8, uint64) {
+  side := 0
+  if isWhite {
+    side = 1
+  }
+  for _, piece := range SEE_ORDER[side] {
+    if found := attackers & *pieceSet(bitboard, piece); found != 0 {
+      return piece, found & -found
+    }
+  }
+  return 0, 0
+}
+
+// how much material the move wins when both sides keep taking back on its square for as long as
+// it pays. Zero for a quiet move nobody can take, negative when the move just hangs material
+func SEE(move Move, bitboard *Bitboard) int32 {
+  to := move.To()
+  occupied := WhitePieces(bitboard) | BlackPieces(bitboard)
+  isWhite := move.Piece() & WHITE_MASK != 0
+
+  var gain [32]int32
+  gain[0] = seeValue(move.Captured())
+  if move.IsEnPassant() {
+    occupied &^= move.CaptureSquare()
+  }
+
+  // the piece standing on the square after each capture, which is what the next capture wins
+  onSquare := seeValue(move.Piece())
+  if move.IsPromotion() {
+    gain[0] += seeValue(move.Promotion()) - seeValue(move.Piece())
+    onSquare = seeValue(move.Promotion())
+  }
+
+  occupied &^= move.From()
+  attackers := attackersWithOccupancy(to, occupied, bitboard)
+
+  depth := 0
+  for depth < len(gain) - 1 {
+    isWhite = !isWhite
+    mine := attackers & WhitePieces(bitboard)
+    if !isWhite {
+      mine = attackers & BlackPieces(bitboard)
+    }
+    piece, from := leastValuableAttacker(mine, isWhite, bitboard)
+    if from == 0 {
+      break
+    }
+    // the king can only take last, with nothing left to take it back
+    if piece & 0x20 != 0 && attackers &^ mine != 0 {
+      break
+    }
+
+    depth++
+    gain[depth] = onSquare - gain[depth - 1]
+
+    onSquare = seeValue(piece)
+    occupied &^= from
+    attackers = attackersWithOccupancy(to, occupied, bitboard)
+  }
+
+  // each side gets to choose between taking and standing pat, from the last capture back
+  for ; depth > 0; depth-- {
+    gain[depth - 1] = -max32(-gain[depth - 1], gain[depth])
+  }
+  return gain[0]
+}
+
+func max32(a int32, b int32) int32 {
+  if a > b {
+    return a
+  }
+  return b
+}
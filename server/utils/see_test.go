@@ -0,0 +1,96 @@
+package utils
+
+import (
+  "testing"
+)
+
+var seePositions = []struct {
+  name string
+  fen string
+  move string
+  see int32 // in centipawns
+}{
+  {
+    name: "undefended pawn",
+    fen: "1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1",
+    move: "e1e5",
+    see: 100,
+  },
+  {
+    name: "knight for a pawn",
+    fen: "1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1",
+    move: "d3e5",
+    see: 100 - 320,
+  },
+  {
+    name: "queen takes a defended pawn",
+    fen: "4k3/8/3p4/4p3/8/8/7Q/4K3 w - - 0 1",
+    move: "h2e5",
+    see: 100 - 900,
+  },
+  {
+    name: "rook behind the queen",
+    fen: "4k3/3p4/2p5/3r4/8/8/3Q4/3RK3 w - - 0 1",
+    move: "d2d5",
+    see: 500 - 900 + 100, // Qxd5 cxd5 Rxd5
+  },
+  {
+    name: "quiet move onto an attacked square",
+    fen: "4k3/8/8/3p4/8/8/8/2N1K3 w - - 0 1",
+    move: "c1b3",
+    see: 0,
+  },
+  {
+    name: "quiet move that hangs the knight",
+    fen: "4k3/8/8/2p5/8/8/8/2N1K3 w - - 0 1",
+    move: "c1d3",
+    see: 0,
+  },
+  {
+    name: "en passant",
+    fen: "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1",
+    move: "e5d6",
+    see: 100,
+  },
+  {
+    name: "promotion",
+    fen: "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1",
+    move: "b7b8",
+    see: 900 - 100,
+  },
+  {
+    name: "king can't take a defended piece",
+    fen: "4k3/8/8/8/8/8/3r4/1n2K3 w - - 0 1",
+    move: "e1d2",
+    see: 500 - 20000,
+  },
+}
+
+func TestSEE(t *testing.T) {
+  for _, position := range seePositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatalf("%s: %v", position.name, err)
+    }
+    from, _ := SquareFromName(position.move[0:2])
+    to, _ := SquareFromName(position.move[2:4])
+    move := BuildMove(PieceAt(&board, from), from, to, 0, &board)
+
+    if got := SEE(move, &board); got != position.see {
+      t.Errorf("%s: SEE of %s is %d, want %d", position.name, position.move, got, position.see)
+    }
+  }
+}
+
+func TestQuiescenceSeesTheRecapture(t *testing.T) {
+  var board Bitboard
+  if err := InitBoardFromFEN(&board, "4k3/8/3p4/4p3/8/8/7Q/4K3 w - - 0 1"); err != nil {
+    t.Fatal(err)
+  }
+
+  // at depth 1 without quiescence Qxe5 looks like it wins a pawn
+  result := AI_move(&board, true, 1)
+  if MoveToUCI(result.Move) == "h2e5" {
+    t.Errorf("took the defended pawn, score %d", result.Score)
+  }
+}
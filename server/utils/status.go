@@ -0,0 +1,147 @@
+package utils
+
+const (
+  STATUS_ONGOING = "ongoing"
+  STATUS_CHECKMATE = "checkmate"
+  STATUS_STALEMATE = "stalemate"
+  STATUS_FIFTY_MOVE_RULE = "fifty_move_rule"
+  STATUS_THREEFOLD_REPETITION = "threefold_repetition"
+  STATUS_INSUFFICIENT_MATERIAL = "insufficient_material"
+
+  RESULT_WHITE_WINS = "1-0"
+  RESULT_BLACK_WINS = "0-1"
+  RESULT_DRAW = "1/2-1/2"
+  RESULT_ONGOING = "*"
+
+  LIGHT_SQUARES uint64 = 0xAA55AA55AA55AA55
+  DARK_SQUARES uint64 = ^LIGHT_SQUARES
+)
+
+type GameState struct {
+  Status string `json:"status"`
+  Result string `json:"result"`
+  Message string `json:"message"` // e.g. "1-0 by checkmate"
+  WhiteTurn bool `json:"whiteTurn"`
+  InCheck bool `json:"inCheck"`
+  HalfmoveClock int `json:"halfmoveClock"`
+  FullmoveNumber int `json:"fullmoveNumber"`
+}
+
+func (state GameState) IsOver() bool {
+  return state.Status != STATUS_ONGOING
+}
+
+// =================================== REPETITIONS ===================================
+// returns how many times the current position has appeared, counting this one
+func RepetitionCount(bitboard *Bitboard) int {
+  count := 1
+
+  // a capture or pawn move resets the halfmove clock, and nothing before it can repeat
+  oldest := len(bitboard.history) - bitboard.halfmoveClock
+  if oldest < 0 {
+    oldest = 0
+  }
+  for i := len(bitboard.history) - 2; i >= oldest; i -= 2 {
+    if bitboard.history[i].hash == bitboard.hash {
+      count++
+    }
+  }
+
+  return count
+}
+
+// =================================== ENDING THE GAME ===================================
+func HasLegalMoves(bitboard *Bitboard) bool {
+  for i := 0; i < 64; i++ {
+    piece := bitboard.mailbox[i]
+    if piece == 0 || (piece & WHITE_MASK != 0) != bitboard.whiteTurn {
+      continue
+    }
+    if len(GetValidMoves(piece, uint64(1) << i, bitboard)) > 0 {
+      return true
+    }
+  }
+  return false
+}
+
+// true when neither side has enough pieces left to ever give checkmate
+func IsInsufficientMaterial(bitboard *Bitboard) bool {
+  if bitboard.whitePawns | bitboard.blackPawns | bitboard.whiteRooks | bitboard.blackRooks | bitboard.whiteQueens | bitboard.blackQueens != 0 {
+    return false
+  }
+
+  knights := bitboard.whiteKnights | bitboard.blackKnights
+  bishops := bitboard.whiteBishops | bitboard.blackBishops
+  minors := countBits(knights | bishops)
+
+  // king against king, or king and a single minor piece against king
+  if minors <= 1 {
+    return true
+  }
+
+  // any number of bishops that all sit on the same color can never mate
+  if knights == 0 && (bishops & LIGHT_SQUARES == 0 || bishops & DARK_SQUARES == 0) {
+    return true
+  }
+
+  return false
+}
+
+func countBits(set uint64) int {
+  count := 0
+  for set != 0 {
+    set &= set - 1
+    count++
+  }
+  return count
+}
+
+// works out if the game is over and why. The fifty move rule and threefold repetition
+// are treated as automatic draws instead of something a player has to claim
+func GetGameState(bitboard *Bitboard) GameState {
+  state := GameState{
+    Status: STATUS_ONGOING,
+    Result: RESULT_ONGOING,
+    WhiteTurn: bitboard.whiteTurn,
+    InCheck: IsInCheck(bitboard, bitboard.whiteTurn),
+    HalfmoveClock: bitboard.halfmoveClock,
+    FullmoveNumber: bitboard.fullmoveNumber,
+  }
+
+  if !HasLegalMoves(bitboard) {
+    if state.InCheck {
+      state.Status = STATUS_CHECKMATE
+      if bitboard.whiteTurn {
+        state.Result = RESULT_BLACK_WINS
+      } else {
+        state.Result = RESULT_WHITE_WINS
+      }
+    } else {
+      state.Status = STATUS_STALEMATE
+      state.Result = RESULT_DRAW
+    }
+  } else if IsInsufficientMaterial(bitboard) {
+    state.Status = STATUS_INSUFFICIENT_MATERIAL
+    state.Result = RESULT_DRAW
+  } else if bitboard.halfmoveClock >= 100 {
+    state.Status = STATUS_FIFTY_MOVE_RULE
+    state.Result = RESULT_DRAW
+  } else if RepetitionCount(bitboard) >= 3 {
+    state.Status = STATUS_THREEFOLD_REPETITION
+    state.Result = RESULT_DRAW
+  }
+
+  if state.IsOver() {
+    state.Message = state.Result + " by " + statusDescriptions[state.Status]
+  }
+
+  return state
+}
+
+var statusDescriptions = map[string]string{
+  STATUS_CHECKMATE: "checkmate",
+  STATUS_STALEMATE: "stalemate",
+  STATUS_FIFTY_MOVE_RULE: "the fifty move rule",
+  STATUS_THREEFOLD_REPETITION: "threefold repetition",
+  STATUS_INSUFFICIENT_MATERIAL: "insufficient material",
+}
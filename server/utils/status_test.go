@@ -0,0 +1,65 @@
+package utils
+
+import "testing"
+
+func gameState(t *testing.T, fen string, moves ...string) GameState {
+  var bitboard Bitboard
+  if err := InitBoardFromFEN(&bitboard, fen); err != nil {
+    t.Fatal(err)
+  }
+  playUCIMoves(t, &bitboard, moves...)
+  return GetGameState(&bitboard)
+}
+
+func TestGameState(t *testing.T) {
+  shuffle := []string{ "g1f3", "g8f6", "f3g1", "f6g8" }
+  tests := []struct {
+    name string
+    fen string
+    moves []string
+    status string
+    message string
+  }{
+    { "start", STARTING_FEN, nil, STATUS_ONGOING, "" },
+    { "checkmate", "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4", []string{ "h5f7" }, STATUS_CHECKMATE, "1-0 by checkmate" },
+    { "black mates", STARTING_FEN, []string{ "f2f3", "e7e5", "g2g4", "d8h4" }, STATUS_CHECKMATE, "0-1 by checkmate" },
+    { "stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", nil, STATUS_STALEMATE, "1/2-1/2 by stalemate" },
+    { "twice is not enough", STARTING_FEN, shuffle, STATUS_ONGOING, "" },
+    { "threefold repetition", STARTING_FEN, append(append([]string{}, shuffle...), shuffle...), STATUS_THREEFOLD_REPETITION, "1/2-1/2 by threefold repetition" },
+    { "99 halfmoves", "4k3/8/8/8/8/8/R7/4K3 w - - 99 80", nil, STATUS_ONGOING, "" },
+    { "fifty move rule", "4k3/8/8/8/8/8/R7/4K3 w - - 100 80", nil, STATUS_FIFTY_MOVE_RULE, "1/2-1/2 by the fifty move rule" },
+    { "fifty moves reached by moving", "4k3/8/8/8/8/8/R7/4K3 w - - 99 80", []string{ "a2b2" }, STATUS_FIFTY_MOVE_RULE, "1/2-1/2 by the fifty move rule" },
+    { "a pawn move resets the count", "4k3/8/8/8/8/8/4P3/4K3 w - - 99 80", []string{ "e2e4" }, STATUS_ONGOING, "" },
+    { "king and knight", "4k3/8/8/8/8/8/8/3NK3 w - - 0 1", nil, STATUS_INSUFFICIENT_MATERIAL, "1/2-1/2 by insufficient material" },
+    { "bishops on the same color", "4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, STATUS_INSUFFICIENT_MATERIAL, "1/2-1/2 by insufficient material" },
+    { "bishops on opposite colors", "2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, STATUS_ONGOING, "" },
+    { "two knights", "4k3/8/8/8/8/8/8/2NNK3 w - - 0 1", nil, STATUS_ONGOING, "" },
+  }
+
+  for _, test := range tests {
+    state := gameState(t, test.fen, test.moves...)
+    if state.Status != test.status || state.Message != test.message {
+      t.Errorf("%s: %s %q, want %s %q", test.name, state.Status, state.Message, test.status, test.message)
+    }
+    if state.IsOver() == (state.Result == RESULT_ONGOING) {
+      t.Errorf("%s: over %v with result %s", test.name, state.IsOver(), state.Result)
+    }
+  }
+}
+
+func TestRepetitionCount(t *testing.T) {
+  var bitboard Bitboard
+  InitBoard(&bitboard)
+  for i := 1; i <= 3; i++ {
+    if count := RepetitionCount(&bitboard); count != i {
+      t.Fatalf("start position seen %d times, want %d", count, i)
+    }
+    playUCIMoves(t, &bitboard, "b1c3", "b8c6", "c3b1", "c6b8")
+  }
+
+  // the same squares, but a pawn move in between means nothing before it counts
+  playUCIMoves(t, &bitboard, "e2e4", "e7e5", "b1c3", "b8c6", "c3b1", "c6b8")
+  if count := RepetitionCount(&bitboard); count != 2 {
+    t.Errorf("seen %d times since the pawn moves, want 2", count)
+  }
+}
@@ -0,0 +1,321 @@
+package utils
+
+import (
+  "math/bits"
+
+  "server/syzygy"
+)
+
+// =================================== TABLEBASES ===================================
+// Syzygy tables know the result of every position with a handful of pieces left, read from
+// files on disk so nothing is ever looked up over the network. The WDL tables say whether the
+// side to move wins, draws or loses and get probed inside the search. The DTZ tables say how far
+// it is to the next capture or pawn move and are only used at the root, to pick the moves that
+// win before the fifty move rule runs out, or drag a loss out until it might
+const (
+  // a win the tables know of. Below every mate score so a mate the search can see still comes
+  // first, and the same at every ply so the transposition table can keep it as it is
+  TB_WIN_SCORE int32 = MATE_SCORE - 2 * MAX_PLY
+  TB_DEPTH_BONUS = 6 // a result out of the tables is worth more than a search this many plies deeper
+
+  // root moves get ranked on this scale, the ones with the highest rank are all that get searched
+  TB_RANK_WIN = 1000
+)
+
+// the rank of a root move by its result alone, for when there are no DTZ tables
+var WDL_TO_RANK = [5]int{ -TB_RANK_WIN, -TB_RANK_WIN + 101, 0, TB_RANK_WIN - 101, TB_RANK_WIN }
+
+// the tables in one or more directories. A nil *Tablebase is fine to use and knows nothing
+type Tablebase struct {
+  tables *syzygy.Tablebase
+}
+
+// finds the tables in dirs, a list of directories separated the way PATH is. The files only get
+// read the first time a position needs them
+func OpenTablebase(dirs string) (*Tablebase, error) {
+  tables, err := syzygy.Open(dirs)
+  if err != nil {
+    return nil, err
+  }
+  return &Tablebase{ tables: tables }, nil
+}
+
+// the most pieces any of the tables has, 0 if there are none
+func (tb *Tablebase) MaxPieces() int {
+  if tb == nil {
+    return 0
+  }
+  return tb.tables.MaxPieces()
+}
+
+// true if the tables could have the position: few enough pieces and no castling rights, which
+// no table knows about
+func (tb *Tablebase) covers(bitboard *Bitboard) bool {
+  return tb != nil && bitboard.castlingRights == 0 &&
+    bits.OnesCount64(WhitePieces(bitboard) | BlackPieces(bitboard)) <= tb.tables.MaxPieces()
+}
+
+// the board the way the tables see it, a1 first
+func tablebasePosition(bitboard *Bitboard) syzygy.Position {
+  pos := syzygy.Position{ WhiteToMove: bitboard.whiteTurn }
+  for i, piece := range bitboard.mailbox {
+    if piece == 0 {
+      continue
+    }
+    // the mailbox has one bit per kind of piece, pawn to king, in the same order the tables number them
+    kind := syzygy.Piece(bits.TrailingZeros8(piece & 0x3F) + 1)
+    if piece & BLACK_MASK != 0 {
+      kind |= syzygy.BLACK
+    }
+    pos.Board[polyglotSquare(i)] = kind
+  }
+  return pos
+}
+
+// the result for the side to move, syzygy.LOSS to syzygy.WIN, with a fresh fifty move count.
+// ok is false when the tables don't have the position
+func (tb *Tablebase) ProbeWDL(bitboard *Bitboard) (int, bool) {
+  if !tb.covers(bitboard) {
+    return 0, false
+  }
+  wdl, _, err := tb.search(bitboard, false)
+  return wdl, err == nil
+}
+
+// how many plies the side to move needs to win with a capture or pawn move, positive, or can hold
+// out before one when losing, negative. 0 is a draw. Cursed wins and blessed losses come out past
+// 100. ok is false when the tables don't have the position
+func (tb *Tablebase) ProbeDTZ(bitboard *Bitboard) (int, bool) {
+  if !tb.covers(bitboard) {
+    return 0, false
+  }
+  dtz, err := tb.probeDTZ(bitboard)
+  return dtz, err == nil
+}
+
+// the real result for the side to move. The tables store whatever compresses best for a position
+// where a capture does at least as well as the stored result, so the captures get searched
+// first and the table only decides when none of them is as good. zeroing is true when the result
+// comes from a capture, or a pawn move too if pawnMoves is set, and not from the table
+func (tb *Tablebase) search(bitboard *Bitboard, pawnMoves bool) (wdl int, zeroing bool, err error) {
+  best := syzygy.LOSS
+  moves := GenerateAllMoves(bitboard)
+  searched := 0
+  for _, move := range moves {
+    if !move.IsCapture() && (!pawnMoves || move.Piece() & 0x1 == 0) {
+      continue
+    }
+    searched++
+    MakeMove(move, bitboard)
+    value, _, err := tb.search(bitboard, false)
+    UnmakeMove(bitboard)
+    if err != nil {
+      return 0, false, err
+    }
+    if -value > best {
+      best = -value
+      if best == syzygy.WIN {
+        return best, true, nil
+      }
+    }
+  }
+
+  // when every move got searched there's nothing left for the table to say
+  if searched > 0 && searched == len(moves) {
+    return best, true, nil
+  }
+  pos := tablebasePosition(bitboard)
+  wdl, err = tb.tables.ProbeWDL(&pos)
+  if err != nil {
+    return 0, false, err
+  }
+  if best >= wdl {
+    return best, best > syzygy.DRAW, nil
+  }
+  return wdl, false, nil
+}
+
+// the DTZ of a position whose best move is a capture or pawn move, just before making it
+func dtzBeforeZeroing(wdl int) int {
+  switch wdl {
+  case syzygy.WIN:
+    return 1
+  case syzygy.CURSED_WIN:
+    return 101
+  case syzygy.BLESSED_LOSS:
+    return -101
+  case syzygy.LOSS:
+    return -1
+  }
+  return 0
+}
+
+func sign(n int) int {
+  if n > 0 {
+    return 1
+  } else if n < 0 {
+    return -1
+  }
+  return 0
+}
+
+func (tb *Tablebase) probeDTZ(bitboard *Bitboard) (int, error) {
+  wdl, zeroing, err := tb.search(bitboard, true)
+  if err != nil || wdl == syzygy.DRAW {
+    return 0, err
+  }
+  if zeroing {
+    return dtzBeforeZeroing(wdl), nil
+  }
+
+  pos := tablebasePosition(bitboard)
+  dtz, err := tb.tables.ProbeDTZ(&pos, wdl)
+  if err == nil {
+    if wdl == syzygy.CURSED_WIN || wdl == syzygy.BLESSED_LOSS {
+      dtz += 100
+    }
+    return dtz * sign(wdl), nil
+  }
+  if err != syzygy.ErrChangeSTM {
+    return 0, err
+  }
+
+  // the table only has the other side to move, so look one move ahead. Winning, the fastest win
+  // is wanted. Losing, the slowest loss
+  minDTZ := 0xFFFF
+  for _, move := range GenerateAllMoves(bitboard) {
+    zeroingMove := move.IsCapture() || move.Piece() & 0x1 != 0
+    MakeMove(move, bitboard)
+    var dtz int
+    if zeroingMove {
+      var child int
+      child, _, err = tb.search(bitboard, false)
+      dtz = -dtzBeforeZeroing(child)
+    } else {
+      dtz, err = tb.probeDTZ(bitboard)
+      dtz = -dtz
+    }
+    mates := dtz == 1 && IsInCheck(bitboard, bitboard.whiteTurn) && !HasLegalMoves(bitboard)
+    UnmakeMove(bitboard)
+    if err != nil {
+      return 0, err
+    }
+
+    if mates {
+      minDTZ = 1
+    }
+    if !zeroingMove {
+      dtz += sign(dtz) // the child's count doesn't include the move that got there
+    }
+    if dtz < minDTZ && sign(dtz) == sign(wdl) {
+      minDTZ = dtz
+    }
+  }
+  if minDTZ == 0xFFFF {
+    return -1, nil // no moves and not a draw, so mated
+  }
+  return minDTZ, nil
+}
+
+// =================================== ROOT MOVES ===================================
+// the moves at the root worth searching, when the tables have the position: the ones that keep
+// the best result there is. Winning that means the fewest plies to the next capture or pawn move,
+// so the win doesn't wander off past the fifty move rule, and losing the most. Without DTZ tables
+// the result alone decides. ok is false when the tables can't say, and every move gets searched
+func (tb *Tablebase) RootMoves(bitboard *Bitboard) ([]Move, bool) {
+  if !tb.covers(bitboard) {
+    return nil, false
+  }
+  moves := GenerateAllMoves(bitboard)
+  if len(moves) == 0 {
+    return nil, false
+  }
+
+  ranks := make([]int, len(moves))
+  var err error
+  for i, move := range moves {
+    if ranks[i], err = tb.rankByDTZ(bitboard, move); err != nil {
+      break
+    }
+  }
+  if err != nil {
+    for i, move := range moves {
+      MakeMove(move, bitboard)
+      var wdl int
+      wdl, _, err = tb.search(bitboard, false)
+      UnmakeMove(bitboard)
+      if err != nil {
+        return nil, false
+      }
+      ranks[i] = WDL_TO_RANK[2 - wdl]
+    }
+  }
+
+  best := ranks[0]
+  for _, rank := range ranks {
+    best = max(best, rank)
+  }
+  var kept []Move
+  for i, move := range moves {
+    if ranks[i] == best {
+      kept = append(kept, move)
+    }
+  }
+  return kept, true
+}
+
+// where a root move stands, higher being better. Wins in time for the fifty move rule come first,
+// the sooner the better, then wins the rule gets in the way of. Then draws, then losses the rule
+// will save, then losses, the later the better
+func (tb *Tablebase) rankByDTZ(bitboard *Bitboard, move Move) (int, error) {
+  clock := bitboard.halfmoveClock
+  MakeMove(move, bitboard)
+  defer UnmakeMove(bitboard)
+
+  var dtz int
+  if bitboard.halfmoveClock == 0 {
+    wdl, _, err := tb.search(bitboard, false)
+    if err != nil {
+      return 0, err
+    }
+    dtz = dtzBeforeZeroing(-wdl)
+  } else if bitboard.halfmoveClock >= 100 || RepetitionCount(bitboard) >= 3 {
+    dtz = 0 // the move ends the game in a draw whatever the tables say
+  } else {
+    child, err := tb.probeDTZ(bitboard)
+    if err != nil {
+      return 0, err
+    }
+    dtz = -child
+    dtz += sign(dtz)
+  }
+  if dtz == 2 && IsInCheck(bitboard, bitboard.whiteTurn) && !HasLegalMoves(bitboard) {
+    dtz = 1 // mate
+  }
+
+  // the capture or pawn move comes dtz plies from here, with the clock at clock + dtz - 1 just
+  // before it, so the rule gets there first once the two add up to more than 100
+  switch {
+  case dtz > 0 && dtz + clock <= 100:
+    return TB_RANK_WIN - dtz, nil
+  case dtz > 0:
+    return TB_RANK_WIN / 2 - (dtz + clock), nil
+  case dtz < 0 && -dtz + clock <= 100:
+    return -TB_RANK_WIN - dtz, nil
+  case dtz < 0:
+    return -TB_RANK_WIN / 2 + (-dtz + clock), nil
+  }
+  return 0, nil
+}
+
+// what a probe inside the search is worth, and which way the search could still move it: a win
+// could turn out to be a mate the search can see, a loss one it can't avoid
+func tablebaseScore(wdl int) (int32, uint8) {
+  switch wdl {
+  case syzygy.WIN:
+    return TB_WIN_SCORE, BOUND_LOWER
+  case syzygy.LOSS:
+    return -TB_WIN_SCORE, BOUND_UPPER
+  }
+  return 0, BOUND_EXACT // cursed wins and blessed losses are draws under the fifty move rule
+}
@@ -0,0 +1,213 @@
+package utils
+
+import (
+  "context"
+  "slices"
+  "testing"
+
+  "server/syzygy"
+)
+
+// the 3 and 4 piece tables cmd/tbgen wrote
+func testTablebase(t *testing.T) *Tablebase {
+  t.Helper()
+  tb, err := OpenTablebase("../syzygy/testdata")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if tb.MaxPieces() != 4 {
+    t.Fatalf("found tables of up to %d pieces, want 4", tb.MaxPieces())
+  }
+  return tb
+}
+
+func boardFromFEN(t *testing.T, fen string) *Bitboard {
+  t.Helper()
+  var bitboard Bitboard
+  if err := InitBoardFromFEN(&bitboard, fen); err != nil {
+    t.Fatal(err)
+  }
+  return &bitboard
+}
+
+func TestTablebaseProbes(t *testing.T) {
+  tb := testTablebase(t)
+  tests := []struct {
+    fen string
+    wdl int
+    dtz int // 0 for a draw, or when any win or loss will do
+  }{
+    { "k7/2Q5/1K6/8/8/8/8/8 w - - 0 1", syzygy.WIN, 1 }, // Qc8 mates
+    { "k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", syzygy.DRAW, 0 }, // stalemate
+    { "7K/8/8/8/8/8/1k6/Q7 b - - 0 1", syzygy.DRAW, 0 }, // the queen's hanging
+    { "R6k/8/7K/8/8/8/8/8 b - - 0 1", syzygy.LOSS, -1 }, // mated
+    { "8/8/8/4k3/8/8/8/R3K3 w - - 0 1", syzygy.WIN, 0 },
+    { "8/4P1k1/8/8/8/8/8/K7 w - - 0 1", syzygy.WIN, 1 }, // promotes straight away
+    { "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", syzygy.WIN, 0 },
+    { "8/4k3/8/4K3/4P3/8/8/8 w - - 0 1", syzygy.DRAW, 0 }, // black has the opposition
+    { "8/4k3/8/4K3/4P3/8/8/8 b - - 0 1", syzygy.LOSS, 0 }, // white does
+    { "8/8/3k4/8/8/2B5/8/4K3 w - - 0 1", syzygy.DRAW, 0 },
+    { "8/8/3k4/8/8/2N5/8/4K3 b - - 0 1", syzygy.DRAW, 0 },
+    { "7k/7B/6K1/6N1/8/8/8/8 w - - 0 1", syzygy.WIN, 1 }, // Nf7 mates
+    { "4k3/8/8/8/8/8/8/1NB1K3 b - - 0 1", syzygy.LOSS, 0 },
+    { "7k/5K1p/6P1/8/8/8/8/8 w - - 0 1", syzygy.WIN, 1 }, // g7 mates
+    { "4k3/8/8/p7/P7/8/8/4K3 w - - 0 1", syzygy.DRAW, 0 },
+    { "7k/7p/8/8/8/8/8/3RK3 w - - 0 1", syzygy.WIN, 0 },
+    { "3rk3/8/8/8/8/8/7P/7K b - - 0 1", syzygy.WIN, 0 },
+    { "3qk3/8/8/8/8/8/8/3QK3 w - - 0 1", syzygy.DRAW, 0 },
+
+    // a4 would queen, if it wasn't for bxa3 e.p. leaving a rook pawn the king in the corner stops
+    { "8/8/8/8/1p6/7k/P7/K7 w - - 0 1", syzygy.DRAW, 0 },
+    { "8/8/8/8/Pp6/7k/8/K7 b - a3 0 1", syzygy.DRAW, 0 },
+    { "8/8/8/8/Pp6/7k/8/K7 b - - 0 1", syzygy.LOSS, 0 },
+  }
+
+  for _, test := range tests {
+    bitboard := boardFromFEN(t, test.fen)
+    wdl, ok := tb.ProbeWDL(bitboard)
+    if !ok || wdl != test.wdl {
+      t.Errorf("%s: WDL %d (%v), want %d", test.fen, wdl, ok, test.wdl)
+    }
+    dtz, ok := tb.ProbeDTZ(bitboard)
+    if !ok || sign(dtz) != sign(test.wdl) || (test.dtz != 0 && dtz != test.dtz) {
+      t.Errorf("%s: DTZ %d (%v), want %d", test.fen, dtz, ok, test.dtz)
+    }
+
+    checkTablebaseMoves(t, tb, bitboard)
+    for _, move := range GenerateAllMoves(bitboard) {
+      MakeMove(move, bitboard)
+      checkTablebaseMoves(t, tb, bitboard)
+      UnmakeMove(bitboard)
+    }
+  }
+}
+
+// the result of a position has to be the best result of its moves, and a win has to have a move
+// that gets one ply closer to the next capture or pawn move
+func checkTablebaseMoves(t *testing.T, tb *Tablebase, bitboard *Bitboard) {
+  t.Helper()
+  fen := GetFEN(bitboard)
+  wdl, _ := tb.ProbeWDL(bitboard)
+  dtz, _ := tb.ProbeDTZ(bitboard)
+
+  best := syzygy.DRAW // stalemate
+  if IsInCheck(bitboard, bitboard.whiteTurn) {
+    best = syzygy.LOSS
+  }
+  moves := GenerateAllMoves(bitboard)
+  closer := false
+  for i, move := range moves {
+    zeroing := move.IsCapture() || move.Piece() & 0x1 != 0
+    MakeMove(move, bitboard)
+    childWDL, _ := tb.ProbeWDL(bitboard)
+    childDTZ, _ := tb.ProbeDTZ(bitboard)
+    UnmakeMove(bitboard)
+
+    if i == 0 || -childWDL > best {
+      best = -childWDL
+    }
+    if dtz > 0 && ((zeroing && childWDL == syzygy.LOSS && dtz == 1) || (!zeroing && childDTZ == -(dtz - 1))) {
+      closer = true
+    }
+  }
+  if wdl != best {
+    t.Errorf("%s: WDL %d, but the best move gets %d", fen, wdl, best)
+  }
+  if dtz > 0 && !closer {
+    t.Errorf("%s: DTZ %d, but no move gets any closer", fen, dtz)
+  }
+}
+
+// the root moves alone are enough to win: playing them for both sides mates in exactly the
+// DTZ of the start, since every move on the way is the fastest win or the slowest loss
+func TestTablebaseRootMovesMate(t *testing.T) {
+  tb := testTablebase(t)
+  for _, fen := range []string{ "8/8/8/4k3/8/8/8/R3K3 w - - 0 1", "8/8/8/3k4/8/8/8/KQ6 w - - 0 1", "8/8/8/4k3/8/8/8/2B1KN2 w - - 0 1" } {
+    bitboard := boardFromFEN(t, fen)
+    dtz, _ := tb.ProbeDTZ(bitboard)
+    plies := 0
+    for HasLegalMoves(bitboard) {
+      moves, ok := tb.RootMoves(bitboard)
+      if !ok || len(moves) == 0 {
+        t.Fatalf("%s: no root moves after %d plies", fen, plies)
+      }
+      MakeMove(moves[0], bitboard)
+      plies++
+      if plies > dtz {
+        t.Fatalf("%s: still going after %d plies, the DTZ was %d", fen, plies, dtz)
+      }
+    }
+    if !IsInCheck(bitboard, bitboard.whiteTurn) || plies != dtz {
+      t.Errorf("%s: the game ended after %d plies, want mate in %d", fen, plies, dtz)
+    }
+  }
+}
+
+func TestTablebaseRootMovesKeepTheWin(t *testing.T) {
+  tb := testTablebase(t)
+  bitboard := boardFromFEN(t, "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1")
+  moves, ok := tb.RootMoves(bitboard)
+  if !ok || len(moves) == 0 || len(moves) == len(GenerateAllMoves(bitboard)) {
+    t.Fatalf("kept %d root moves (%v)", len(moves), ok)
+  }
+  for _, move := range moves {
+    MakeMove(move, bitboard)
+    if wdl, _ := tb.ProbeWDL(bitboard); wdl != syzygy.LOSS {
+      t.Errorf("%s lets the win go", MoveToUCI(move))
+    }
+    UnmakeMove(bitboard)
+  }
+
+  // too many pieces, or castling rights, and the tables have nothing to say
+  for _, fen := range []string{ "4k3/p7/8/8/R2n4/8/8/4K3 w - - 0 1", "4k3/8/8/8/8/8/8/R3K3 w Q - 0 1" } {
+    if _, ok := tb.RootMoves(boardFromFEN(t, fen)); ok {
+      t.Errorf("%s: got root moves", fen)
+    }
+  }
+}
+
+// a loss the fifty move rule is about to save ranks above the ones it can't. The rook needs d
+// plies to mate once the king has moved, so the clock decides whether the rule comes first
+func TestTablebaseRankWithClock(t *testing.T) {
+  tb := testTablebase(t)
+  for _, text := range []string{ "e5e6", "e5d5", "e5f4" } {
+    bitboard := boardFromFEN(t, "8/8/8/4k3/8/8/8/R3K3 b - - 0 1")
+    move, err := ParseUCIMove(text, bitboard)
+    if err != nil {
+      t.Fatal(err)
+    }
+    MakeMove(move, bitboard)
+    child, _ := tb.ProbeDTZ(bitboard)
+    UnmakeMove(bitboard)
+    d := child + 1
+
+    bitboard.halfmoveClock = 100 - d
+    if rank, err := tb.rankByDTZ(bitboard, move); err != nil || rank != -TB_RANK_WIN + d {
+      t.Errorf("%s with %d plies on the clock: rank %d (%v), want %d", text, 100 - d, rank, err, -TB_RANK_WIN + d)
+    }
+    bitboard.halfmoveClock = 101 - d
+    if rank, err := tb.rankByDTZ(bitboard, move); err != nil || rank != -TB_RANK_WIN / 2 + 101 {
+      t.Errorf("%s with %d plies on the clock: rank %d (%v), want %d", text, 101 - d, rank, err, -TB_RANK_WIN / 2 + 101)
+    }
+  }
+}
+
+func TestSearchWithTablebase(t *testing.T) {
+  tb := testTablebase(t)
+  options := SearchOptions{ TT: NewTranspositionTable(1), Tablebase: tb }
+
+  // taking the knight leaves KRvKP, and the probe right after the capture knows that's won
+  bitboard := boardFromFEN(t, "4k3/p7/8/8/R2n4/8/8/4K3 w - - 0 1")
+  result := IterativeAI_move(context.Background(), bitboard, true, SearchLimits{ Depth: 2 }, options, nil)
+  if MoveToUCI(result.Move) != "a4d4" || result.Score != TB_WIN_SCORE {
+    t.Errorf("played %s with score %d, want a4d4 with %d", MoveToUCI(result.Move), result.Score, TB_WIN_SCORE)
+  }
+
+  // with the tables covering the root only the moves they keep get searched
+  bitboard = boardFromFEN(t, "8/8/8/4k3/8/8/8/R3K3 w - - 0 1")
+  moves, _ := tb.RootMoves(bitboard)
+  result = IterativeAI_move(context.Background(), bitboard, true, SearchLimits{ Depth: 4 }, options, nil)
+  if !slices.Contains(moves, result.Move) {
+    t.Errorf("played %s, which isn't one of the root moves the tables kept", MoveToUCI(result.Move))
+  }
+}
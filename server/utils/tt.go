@@ -0,0 +1,180 @@
+package utils
+
+import (
+  "sync"
+  "unsafe"
+)
+
+// =================================== TRANSPOSITION TABLE ===================================
+// the same position shows up over and over in a search through different move orders, so what
+// the search found out about it is kept here by zobrist hash. Each hash has exactly one slot it
+// can go in, a new result either replaces what's there or gets dropped.
+// Every search thread shares one table, so the slots are split into stripes with a lock each.
+// Two threads only wait on each other when they touch slots in the same stripe at the same time.
+// Resize, Clear and NewSearch aren't locked, they're only for between searches
+const (
+  BOUND_NONE uint8 = iota
+  BOUND_EXACT // the score is the real score
+  BOUND_LOWER // the search failed high, the real score is at least this
+  BOUND_UPPER // the search failed low, the real score is at most this
+)
+
+const (
+  DEFAULT_TT_MB = 16
+  MAX_TT_MB = 4096
+  TT_STRIPES = 1024 // has to be a power of two
+)
+
+type TTEntry struct {
+  Key uint64 // the full hash, since lots of positions share a slot
+  Move Move // the best move found, empty if every move failed low
+  Score int32 // mate scores are stored relative to this position, not the root
+  Depth int16
+  Bound uint8
+  age uint8 // which search stored it, entries from old searches get replaced first
+}
+
+type TranspositionTable struct {
+  entries []TTEntry
+  mask uint64
+  age uint8 // only changes between searches, so the threads can read it without a lock
+  locks [TT_STRIPES]sync.Mutex
+}
+
+// makes a table that uses about megabytes of memory. The number of entries is rounded down to a
+// power of two so a slot can be found with a mask instead of a division
+func NewTranspositionTable(megabytes int) *TranspositionTable {
+  tt := &TranspositionTable{}
+  tt.Resize(megabytes)
+  return tt
+}
+
+// throws away everything in the table and gives it a new size
+func (tt *TranspositionTable) Resize(megabytes int) {
+  if megabytes < 1 {
+    megabytes = 1
+  }
+  if megabytes > MAX_TT_MB {
+    megabytes = MAX_TT_MB
+  }
+
+  count := uint64(megabytes) * 1024 * 1024 / uint64(unsafe.Sizeof(TTEntry{}))
+  size := uint64(1)
+  for size * 2 <= count {
+    size *= 2
+  }
+  tt.entries = make([]TTEntry, size)
+  tt.mask = size - 1
+  tt.age = 0
+}
+
+func (tt *TranspositionTable) Clear() {
+  for i := range tt.entries {
+    tt.entries[i] = TTEntry{}
+  }
+  tt.age = 0
+}
+
+func (tt *TranspositionTable) stripe(index uint64) *sync.Mutex {
+  return &tt.locks[index & (TT_STRIPES - 1)]
+}
+
+// called at the start of every search so what the last one left behind can be told apart
+func (tt *TranspositionTable) NewSearch() {
+  tt.age++
+}
+
+// looks the position up. The score that comes back is already adjusted for mates to be
+// relative to the root, ply is how far the position is from it
+func (tt *TranspositionTable) Probe(key uint64, ply int) (TTEntry, bool) {
+  lock := tt.stripe(key & tt.mask)
+  lock.Lock()
+  entry := tt.entries[key & tt.mask]
+  lock.Unlock()
+  if entry.Bound == BOUND_NONE || entry.Key != key {
+    return TTEntry{}, false
+  }
+  entry.Score = scoreFromTT(entry.Score, ply)
+  return entry, true
+}
+
+// saves what the search found. An entry is replaced if it's for another position and is
+// either shallower or left over from an older search, or if it's for the same position and
+// the new result is at least as deep or exact
+func (tt *TranspositionTable) Store(key uint64, ply int, depth int, bound uint8, score int32, move Move) {
+  lock := tt.stripe(key & tt.mask)
+  lock.Lock()
+  defer lock.Unlock()
+  slot := &tt.entries[key & tt.mask]
+
+  if slot.Bound != BOUND_NONE {
+    if slot.Key == key {
+      if depth < int(slot.Depth) && bound != BOUND_EXACT {
+        return
+      }
+      // a fail low doesn't know a best move, the one from before is still the best guess
+      if move == NO_MOVE {
+        move = slot.Move
+      }
+    } else if slot.age == tt.age && depth < int(slot.Depth) {
+      return
+    }
+  }
+
+  *slot = TTEntry{
+    Key: key,
+    Move: move,
+    Score: scoreToTT(score, ply),
+    Depth: int16(depth),
+    Bound: bound,
+    age: tt.age,
+  }
+}
+
+// the best move stored for the position, if there is one
+func (tt *TranspositionTable) BestMove(key uint64) (Move, bool) {
+  lock := tt.stripe(key & tt.mask)
+  lock.Lock()
+  entry := tt.entries[key & tt.mask]
+  lock.Unlock()
+  if entry.Bound == BOUND_NONE || entry.Key != key || entry.Move == NO_MOVE {
+    return NO_MOVE, false
+  }
+  return entry.Move, true
+}
+
+// how full the table is in permille, the way UCI reports it. Only looks at the first thousand slots
+func (tt *TranspositionTable) Hashfull() int {
+  used := 0
+  for i := 0; i < 1000 && i < len(tt.entries); i++ {
+    lock := tt.stripe(uint64(i))
+    lock.Lock()
+    if tt.entries[i].Bound != BOUND_NONE && tt.entries[i].age == tt.age {
+      used++
+    }
+    lock.Unlock()
+  }
+  return used
+}
+
+// a mate score from the search means "mate n plies from the root", but the same position can be
+// reached at a different ply, so the table keeps "mate n plies from here" instead
+func scoreToTT(score int32, ply int) int32 {
+  if score > MATE_SCORE - MAX_PLY {
+    return score + int32(ply)
+  }
+  if score < -MATE_SCORE + MAX_PLY {
+    return score - int32(ply)
+  }
+  return score
+}
+
+func scoreFromTT(score int32, ply int) int32 {
+  if score > MATE_SCORE - MAX_PLY {
+    return score - int32(ply)
+  }
+  if score < -MATE_SCORE + MAX_PLY {
+    return score + int32(ply)
+  }
+  return score
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+  "context"
+  "testing"
+)
+
+func TestTTStoreAndProbe(t *testing.T) {
+  tt := NewTranspositionTable(1)
+  move := NewMove(WHITE_KNIGHT, uint64(1) << 62, uint64(1) << 45, 0, 0, 0)
+
+  tt.Store(0x1234, 3, 5, BOUND_EXACT, 42, move)
+  entry, ok := tt.Probe(0x1234, 7)
+  if !ok || entry.Score != 42 || entry.Depth != 5 || entry.Bound != BOUND_EXACT || entry.Move != move {
+    t.Errorf("got %+v %v back", entry, ok)
+  }
+
+  // same slot, different position
+  if _, ok := tt.Probe(0x1234 + tt.mask + 1, 3); ok {
+    t.Errorf("a different key matched")
+  }
+}
+
+func TestTTMateScores(t *testing.T) {
+  tt := NewTranspositionTable(1)
+
+  // mate 5 plies from the root, found 3 plies in, so 2 plies from the stored position
+  tt.Store(1, 3, 4, BOUND_EXACT, MATE_SCORE - 5, NO_MOVE)
+  // reached again 1 ply from the root it's mate in 3 plies from the root
+  if entry, _ := tt.Probe(1, 1); entry.Score != MATE_SCORE - 3 {
+    t.Errorf("mate score came back as %d, want %d", entry.Score, MATE_SCORE - 3)
+  }
+
+  tt.Store(2, 2, 4, BOUND_EXACT, -MATE_SCORE + 6, NO_MOVE)
+  if entry, _ := tt.Probe(2, 4); entry.Score != -MATE_SCORE + 8 {
+    t.Errorf("mated score came back as %d, want %d", entry.Score, -MATE_SCORE + 8)
+  }
+}
+
+func TestTTReplacement(t *testing.T) {
+  tt := NewTranspositionTable(1)
+  other := uint64(7) + tt.mask + 1 // shares a slot with 7
+  move := NewMove(WHITE_PAWN, uint64(1) << 52, uint64(1) << 36, 0, 0, 0)
+
+  tt.Store(7, 0, 6, BOUND_EXACT, 10, move)
+  tt.Store(other, 0, 2, BOUND_EXACT, 20, NO_MOVE)
+  if _, ok := tt.Probe(7, 0); !ok {
+    t.Errorf("a shallow entry replaced a deep one from the same search")
+  }
+
+  // a fail low on the same position keeps the move that was there
+  tt.Store(7, 0, 8, BOUND_UPPER, 5, NO_MOVE)
+  if entry, _ := tt.Probe(7, 0); entry.Depth != 8 || entry.Move != move {
+    t.Errorf("got %+v after a deeper fail low", entry)
+  }
+
+  // anything from an older search can go
+  tt.NewSearch()
+  tt.Store(other, 0, 1, BOUND_LOWER, 20, NO_MOVE)
+  if _, ok := tt.Probe(other, 0); !ok {
+    t.Errorf("an entry from the last search wasn't replaced")
+  }
+}
+
+func TestSearchWithTT(t *testing.T) {
+  for _, position := range searchPositions {
+    var board Bitboard
+    if err := InitBoardFromFEN(&board, position.fen); err != nil {
+      t.Fatal(err)
+    }
+    fen := GetFEN(&board)
+
+    tt := NewTranspositionTable(1)
+    result := IterativeAI_move(context.Background(), &board, IsWhiteTurn(&board), SearchLimits{ Depth: position.depth }, SearchOptions{ TT: tt }, nil)
+    if position.best != "" && MoveToUCI(result.Move) != position.best {
+      t.Errorf("%s: best move %s, want %s", position.name, MoveToUCI(result.Move), position.best)
+    }
+    if position.mateIn != 0 && (!IsMateScore(result.Score) || MateIn(result.Score) != position.mateIn) {
+      t.Errorf("%s: score %d, want mate in %d", position.name, result.Score, position.mateIn)
+    }
+    if GetFEN(&board) != fen {
+      t.Errorf("%s: the search changed the board to %s", position.name, GetFEN(&board))
+    }
+  }
+
+  // the table should save a good chunk of the work
+  var board Bitboard
+  InitBoard(&board)
+  without := IterativeAI_move(context.Background(), &board, true, SearchLimits{ Depth: 4 }, SearchOptions{}, nil)
+  with := IterativeAI_move(context.Background(), &board, true, SearchLimits{ Depth: 4 }, SearchOptions{ TT: NewTranspositionTable(1) }, nil)
+  if with.Nodes >= without.Nodes {
+    t.Errorf("searched %d nodes with the table and %d without", with.Nodes, without.Nodes)
+  }
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "math"
+  "runtime"
+  "strings"
+  "sync"
+)
+
+// =================================== TEXEL TUNING ===================================
+// fits the eval to the results of real games. Every position gets a predicted score,
+// sigmoid(eval) = 1 / (1 + 10^(-K * eval / 400)), and the error is the mean of
+// (result - prediction)^2 over all of them. K is fitted first and then held still while the
+// parameters are nudged one at a time, keeping every nudge that makes the error smaller.
+// The positions should be quiet (no captures hanging), since they're scored with the static eval
+
+type TuningPosition struct {
+  board Bitboard
+  result float64 // 1 is a white win, 0.5 a draw and 0 a black win
+}
+
+var TUNING_RESULTS = map[string]float64{
+  "1-0": 1, "1/2-1/2": 0.5, "0-1": 0,
+  "1.0": 1, "0.5": 0.5, "0.0": 0,
+}
+
+// reads one line of "<fen> <result>". The result can be 1-0, 1/2-1/2, 0-1 or 1.0, 0.5, 0.0,
+// and can be wrapped in quotes or brackets or set off by ; or |, which covers the usual data sets.
+// A bare 1 or 0 isn't a result, it would read the fullmove number of a plain FEN as one
+func ParseTuningLine(line string) (TuningPosition, error) {
+  line = strings.NewReplacer(";", " ", "|", " ", "[", " ", "]", " ", "\"", " ").Replace(line)
+  var fields []string
+  for _, field := range strings.Fields(line) {
+    if field != "c9" { // the EPD opcode some data sets put the result under
+      fields = append(fields, field)
+    }
+  }
+  if len(fields) < 5 {
+    return TuningPosition{}, fmt.Errorf("need a FEN and a result: %q", line)
+  }
+
+  result, ok := TUNING_RESULTS[fields[len(fields) - 1]]
+  if !ok {
+    return TuningPosition{}, fmt.Errorf("unknown result %q", fields[len(fields) - 1])
+  }
+
+  var position TuningPosition
+  if err := InitBoardFromFEN(&position.board, strings.Join(fields[:len(fields) - 1], " ")); err != nil {
+    return TuningPosition{}, err
+  }
+  position.result = result
+  return position, nil
+}
+
+// one position per line, blank lines and lines starting with # are skipped
+func LoadTuningPositions(r io.Reader) ([]TuningPosition, error) {
+  var positions []TuningPosition
+  scanner := bufio.NewScanner(r)
+  for lineNumber := 1; scanner.Scan(); lineNumber++ {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    position, err := ParseTuningLine(line)
+    if err != nil {
+      return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+    }
+    positions = append(positions, position)
+  }
+  return positions, scanner.Err()
+}
+
+func sigmoid(score float64, k float64) float64 {
+  return 1 / (1 + math.Pow(10, -k * score / 400))
+}
+
+// the mean squared error of the current eval over positions. The positions are split between
+// goroutines, which only read the eval parameters
+func TuningError(positions []TuningPosition, k float64) float64 {
+  if len(positions) == 0 {
+    return 0
+  }
+
+  workers := runtime.NumCPU()
+  sums := make([]float64, workers)
+  var wg sync.WaitGroup
+  for w := 0; w < workers; w++ {
+    wg.Add(1)
+    go func(w int) {
+      defer wg.Done()
+      for i := w; i < len(positions); i += workers {
+        diff := positions[i].result - sigmoid(float64(Evaluate(&positions[i].board)), k)
+        sums[w] += diff * diff
+      }
+    }(w)
+  }
+  wg.Wait()
+
+  var total float64
+  for _, sum := range sums {
+    total += sum
+  }
+  return total / float64(len(positions))
+}
+
+// the K that makes the current eval fit the results best, found by narrowing down on it
+// one decimal place at a time
+func FitK(positions []TuningPosition) float64 {
+  best, bestError := 1.0, TuningError(positions, 1.0)
+  step := 1.0
+  for places := 0; places < 4; places++ {
+    start := best
+    for k := start - step * 10; k <= start + step * 10; k += step {
+      if k <= 0 {
+        continue
+      }
+      if e := TuningError(positions, k); e < bestError {
+        best, bestError = k, e
+      }
+    }
+    step /= 10
+  }
+  return best
+}
+
+// pointers to every parameter the tuner is allowed to move. The middlegame pawn stays at 100
+// so everything stays in centipawns, kings have no value, and pawns can never stand on the
+// first or last rank so those squares are left out too
+func tunableParams() []*int32 {
+  var params []*int32
+  for kind := 0; kind < 5; kind++ {
+    if kind != 0 {
+      params = append(params, &MG_PIECE_VALUES[kind])
+    }
+    params = append(params, &EG_PIECE_VALUES[kind])
+  }
+
+  for kind := 0; kind < 6; kind++ {
+    for square := 0; square < 64; square++ {
+      if kind == 0 && (square < 8 || square >= 56) {
+        continue
+      }
+      params = append(params, &MG_TABLES[kind][square], &EG_TABLES[kind][square])
+    }
+  }
+
+  w := &Weights
+  for _, weight := range []*Weight{
+    &w.DoubledPawn, &w.IsolatedPawn,
+    &w.KnightMobility, &w.BishopMobility, &w.RookMobility, &w.QueenMobility,
+    &w.RookOpenFile, &w.RookSemiOpenFile,
+    &w.PawnShield, &w.KnightKingAttack, &w.BishopKingAttack, &w.RookKingAttack, &w.QueenKingAttack,
+  } {
+    params = append(params, &weight.MG, &weight.EG)
+  }
+  for rank := 1; rank < 7; rank++ {
+    params = append(params, &w.PassedPawn[rank].MG, &w.PassedPawn[rank].EG)
+  }
+  return params
+}
+
+// runs passes of local search until one of them doesn't improve anything or there have been
+// iterations of them, and leaves the tuned parameters loaded. report is called after every pass
+func Tune(positions []TuningPosition, k float64, iterations int, report func(iteration int, err float64)) EvalParams {
+  params := tunableParams()
+  bestError := TuningError(positions, k)
+
+  for iteration := 1; iteration <= iterations; iteration++ {
+    improved := false
+    for _, param := range params {
+      for _, step := range []int32{ 1, -1 } {
+        *param += step
+        buildPieceSquareTables()
+        if e := TuningError(positions, k); e < bestError {
+          bestError, improved = e, true
+          break
+        }
+        *param -= step
+      }
+    }
+    buildPieceSquareTables()
+
+    if report != nil {
+      report(iteration, bestError)
+    }
+    if !improved {
+      break
+    }
+  }
+  return CurrentParams()
+}
+
@@ -0,0 +1,122 @@
+package utils
+
+import (
+  "go/ast"
+  "go/importer"
+  "go/parser"
+  "go/token"
+  "go/types"
+  "io/fs"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestParseTuningLine(t *testing.T) {
+  lines := []struct {
+    line string
+    result float64
+  }{
+    { "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 1-0", 1 },
+    { "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1; 1/2-1/2", 0.5 },
+    { "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c9 \"0-1\";", 0 },
+    { "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - [0.5]", 0.5 },
+    { "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 | 1.0", 1 },
+  }
+  for _, line := range lines {
+    position, err := ParseTuningLine(line.line)
+    if err != nil {
+      t.Errorf("%s: %v", line.line, err)
+      continue
+    }
+    if position.result != line.result {
+      t.Errorf("%s: result %v, want %v", line.line, position.result, line.result)
+    }
+  }
+
+  if _, err := ParseTuningLine("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 white"); err == nil {
+    t.Error("accepted a line without a result")
+  }
+  // the clocks of a plain FEN aren't a result
+  if _, err := ParseTuningLine("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"); err == nil {
+    t.Error("read the fullmove number as a result")
+  }
+  if _, err := ParseTuningLine("8/8/8/4k3/8/8/4P3/4K3 w - - 1 0"); err == nil {
+    t.Error("read a zero fullmove number as a result")
+  }
+}
+
+func TestTuneLowersTheError(t *testing.T) {
+  saved := CurrentParams()
+  defer LoadParams(saved)
+
+  // an extra knight that never wins anything, the tuner should make it worth less
+  data := strings.Repeat("4k3/pppp4/8/8/8/8/PPPP4/1N2K3 w - - 0 1 1/2-1/2\n4k3/pppp4/8/8/8/8/PPPP4/4K3 w - - 0 1 1/2-1/2\n", 4)
+  positions, err := LoadTuningPositions(strings.NewReader(data))
+  if err != nil || len(positions) != 8 {
+    t.Fatalf("loaded %d positions: %v", len(positions), err)
+  }
+
+  before := TuningError(positions, 1)
+  params := Tune(positions, 1, 1, nil)
+  if after := TuningError(positions, 1); after >= before {
+    t.Errorf("error went from %v to %v", before, after)
+  }
+  if params.EGPieceValues[1] >= saved.EGPieceValues[1] {
+    t.Errorf("knight is still worth %d in the endgame", params.EGPieceValues[1])
+  }
+}
+
+func TestWriteAndLoadParams(t *testing.T) {
+  saved := CurrentParams()
+  defer LoadParams(saved)
+
+  tuned := saved
+  tuned.MGPieceValues[1] = 345
+  tuned.EGTables[5][36] = 55
+  tuned.Weights.RookOpenFile = Weight{ 33, 11 }
+
+  path := filepath.Join(t.TempDir(), "weights.json")
+  if err := WriteParams(path, tuned); err != nil {
+    t.Fatal(err)
+  }
+  if err := LoadParamsFile(path); err != nil {
+    t.Fatal(err)
+  }
+  if CurrentParams() != tuned {
+    t.Error("parameters changed on the way through the file")
+  }
+  // the black tables are rebuilt from the white ones
+  if EG_PST[11][mirrorSquare(36)] != 55 {
+    t.Errorf("black king table has %d, want 55", EG_PST[11][mirrorSquare(36)])
+  }
+
+  source := filepath.Join(t.TempDir(), "tuned.go")
+  if err := WriteParams(source, tuned); err != nil {
+    t.Fatal(err)
+  }
+  checkCompiles(t, source)
+}
+
+// type checks the file as part of this package, the way it would be built if it were dropped in
+func checkCompiles(t *testing.T, path string) {
+  fset := token.NewFileSet()
+  packages, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+    return !strings.HasSuffix(info.Name(), "_test.go")
+  }, 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  written, err := parser.ParseFile(fset, path, nil, 0)
+  if err != nil {
+    t.Fatalf("wrote Go that doesn't parse: %v", err)
+  }
+  files := []*ast.File{ written }
+  for _, file := range packages["utils"].Files {
+    files = append(files, file)
+  }
+  config := types.Config{ Importer: importer.ForCompiler(fset, "source", nil) }
+  if _, err := config.Check("server/utils", fset, files, nil); err != nil {
+    t.Errorf("wrote Go that doesn't compile: %v", err)
+  }
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+  "fmt"
+)
+
+// =================================== UCI MOVE NOTATION ===================================
+// UCI writes every move as the square it starts on and the square it goes to, plus the
+// promotion piece in lower case (e2e4, e1g1 for castling, e7e8q)
+func MoveToUCI(move Move) string {
+  if move == NO_MOVE {
+    return "0000"
+  }
+  text := SquareName(move.From()) + SquareName(move.To())
+  if move.IsPromotion() {
+    text += PromotionLetter(move.Promotion())
+  }
+  return text
+}
+
+// finds the legal move on the board that the UCI move describes
+func ParseUCIMove(text string, bitboard *Bitboard) (Move, error) {
+  if len(text) != 4 && len(text) != 5 {
+    return NO_MOVE, fmt.Errorf("invalid move %q", text)
+  }
+
+  from, err := SquareFromName(text[0:2])
+  if err != nil {
+    return NO_MOVE, fmt.Errorf("invalid move %q: %v", text, err)
+  }
+  to, err := SquareFromName(text[2:4])
+  if err != nil {
+    return NO_MOVE, fmt.Errorf("invalid move %q: %v", text, err)
+  }
+
+  piece := PieceAt(bitboard, from)
+  if err := ValidateMove(piece, from, to, bitboard); err != nil {
+    return NO_MOVE, fmt.Errorf("%s: %v", text, err)
+  }
+  promotion, err := ParsePromotion(text[4:], piece, to)
+  if err != nil {
+    return NO_MOVE, fmt.Errorf("%s: %v", text, err)
+  }
+  move := BuildMove(piece, from, to, promotion, bitboard)
+
+  return move, nil
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+  "fmt"
+)
+
+// =================================== ZOBRIST HASHING ===================================
+// every piece on every square, every castling right, every en passant file and the side to move
+// gets a random number, and a position's hash is all of its numbers xored together. Since xor
+// undoes itself a move only has to xor out what changed and xor in what replaced it
+var ZOBRIST_PIECES [12][64]uint64
+var ZOBRIST_CASTLING [4]uint64 // K, Q, k, q
+var ZOBRIST_EN_PASSANT [8]uint64 // by file, a to h
+var ZOBRIST_BLACK_TO_MOVE uint64
+
+// the castling bits in castlingRights, in the same order as ZOBRIST_CASTLING
+var CASTLING_BITS = [4]uint8{ 0x01, 0x02, 0x80, 0x40 }
+
+// when true MakeMove and UnmakeMove recompute the hash from scratch after every move and panic if it
+// doesn't match the incremental one. Way too slow to leave on, the tests turn it on
+var DEBUG_HASH = false
+
+// splitmix64, so the keys are the same every run and hashes can be compared across runs
+func zobristRandom(state *uint64) uint64 {
+  *state += 0x9E3779B97F4A7C15
+  z := *state
+  z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+  z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+  return z ^ (z >> 31)
+}
+
+func init() {
+  state := uint64(0x5EED)
+  for piece := 0; piece < 12; piece++ {
+    for square := 0; square < 64; square++ {
+      ZOBRIST_PIECES[piece][square] = zobristRandom(&state)
+    }
+  }
+  for i := range ZOBRIST_CASTLING {
+    ZOBRIST_CASTLING[i] = zobristRandom(&state)
+  }
+  for i := range ZOBRIST_EN_PASSANT {
+    ZOBRIST_EN_PASSANT[i] = zobristRandom(&state)
+  }
+  ZOBRIST_BLACK_TO_MOVE = zobristRandom(&state)
+}
+
+func zobristPieceIndex(piece uint8) int {
+  switch piece {
+  case WHITE_PAWN: return 0
+  case WHITE_KNIGHT: return 1
+  case WHITE_BISHOP: return 2
+  case WHITE_ROOK: return 3
+  case WHITE_QUEEN: return 4
+  case WHITE_KING: return 5
+  case BLACK_PAWN: return 6
+  case BLACK_KNIGHT: return 7
+  case BLACK_BISHOP: return 8
+  case BLACK_ROOK: return 9
+  case BLACK_QUEEN: return 10
+  case BLACK_KING: return 11
+  }
+  return -1
+}
+
+// xors a piece on a square in or out of the hash, it's the same operation both ways
+func hashPiece(bitboard *Bitboard, piece uint8, square uint64) {
+  if index := zobristPieceIndex(piece); index >= 0 {
+    bitboard.hash ^= ZOBRIST_PIECES[index][GetMailBoxIndex(square)]
+  }
+}
+
+func castlingHash(castlingRights uint8) uint64 {
+  var hash uint64
+  for i, bit := range CASTLING_BITS {
+    if castlingRights & bit != 0 {
+      hash ^= ZOBRIST_CASTLING[i]
+    }
+  }
+  return hash
+}
+
+// the en passant square only makes the position different if a pawn can actually take on it,
+// otherwise e4 and a position where the pawn got to e4 some other way would never repeat
+func enPassantHash(bitboard *Bitboard) uint64 {
+  if bitboard.enPassant == 0 {
+    return 0
+  }
+  if bitboard.whiteTurn && PawnAttacks(bitboard.enPassant, false) & bitboard.whitePawns == 0 {
+    return 0
+  }
+  if !bitboard.whiteTurn && PawnAttacks(bitboard.enPassant, true) & bitboard.blackPawns == 0 {
+    return 0
+  }
+  return ZOBRIST_EN_PASSANT[GetMailBoxIndex(bitboard.enPassant) % 8]
+}
+
+// builds the hash from nothing. MakeMove and UnmakeMove keep it up to date after that
+func ComputeHash(bitboard *Bitboard) uint64 {
+  var hash uint64
+  for i := 0; i < 64; i++ {
+    if index := zobristPieceIndex(bitboard.mailbox[i]); index >= 0 {
+      hash ^= ZOBRIST_PIECES[index][i]
+    }
+  }
+  hash ^= castlingHash(bitboard.castlingRights)
+  hash ^= enPassantHash(bitboard)
+  if !bitboard.whiteTurn {
+    hash ^= ZOBRIST_BLACK_TO_MOVE
+  }
+  return hash
+}
+
+func GetHash(bitboard *Bitboard) uint64 {
+  return bitboard.hash
+}
+
+func checkHash(bitboard *Bitboard, where string) {
+  if expected := ComputeHash(bitboard); expected != bitboard.hash {
+    panic(fmt.Sprintf("zobrist hash drifted after %s: have %016x, want %016x (%s)", where, bitboard.hash, expected, GetFEN(bitboard)))
+  }
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+  "testing"
+)
+
+// plays through every perft position with DEBUG_HASH on, so MakeMove and UnmakeMove check the
+// incremental hash against a from scratch one after every single move
+func TestHashNeverDrifts(t *testing.T) {
+  DEBUG_HASH = true
+  defer func() { DEBUG_HASH = false }()
+
+  for _, position := range perftPositions {
+    var bitboard Bitboard
+    if err := InitBoardFromFEN(&bitboard, position.fen); err != nil {
+      t.Fatalf("%s: %v", position.name, err)
+    }
+    start := GetHash(&bitboard)
+
+    Perft(&bitboard, 3)
+
+    if GetHash(&bitboard) != start {
+      t.Errorf("%s: hash changed from %016x to %016x after undoing everything", position.name, start, GetHash(&bitboard))
+    }
+  }
+}
+
+func playUCIMoves(t *testing.T, bitboard *Bitboard, moves ...string) {
+  for _, text := range moves {
+    move, err := ParseUCIMove(text, bitboard)
+    if err != nil {
+      t.Fatal(err)
+    }
+    MakeMove(move, bitboard)
+  }
+}
+
+func TestHashTranspositions(t *testing.T) {
+  var a, b Bitboard
+  InitBoard(&a)
+  InitBoard(&b)
+  playUCIMoves(t, &a, "g1f3", "g8f6", "b1c3", "b8c6")
+  playUCIMoves(t, &b, "b1c3", "b8c6", "g1f3", "g8f6")
+  if GetHash(&a) != GetHash(&b) {
+    t.Errorf("the same position reached in a different order hashed differently")
+  }
+
+  // same pieces, other side to move
+  InitBoard(&b)
+  playUCIMoves(t, &b, "g1f3", "g8f6", "b1c3", "b8c6", "f3g1", "f6g8", "g1f3")
+  if GetHash(&a) == GetHash(&b) {
+    t.Errorf("white and black to move hashed the same")
+  }
+
+  // the FEN of a position hashes the same as the moves that led to it
+  var fromFen Bitboard
+  if err := InitBoardFromFEN(&fromFen, GetFEN(&a)); err != nil {
+    t.Fatal(err)
+  }
+  if GetHash(&fromFen) != GetHash(&a) {
+    t.Errorf("%s hashed differently from the FEN than from the moves", GetFEN(&a))
+  }
+}
+
+func TestHashCastlingAndEnPassant(t *testing.T) {
+  var a, b Bitboard
+
+  // the king going out and back loses the castling rights, so it's a different position
+  InitBoard(&a)
+  InitBoard(&b)
+  playUCIMoves(t, &a, "e2e4", "e7e5", "e1e2", "e8e7", "e2e1", "e7e8")
+  playUCIMoves(t, &b, "e2e4", "e7e5")
+  if GetHash(&a) == GetHash(&b) {
+    t.Errorf("losing the castling rights didn't change the hash")
+  }
+
+  // e4 can't be taken en passant here, so the en passant square doesn't count
+  InitBoard(&a)
+  playUCIMoves(t, &a, "e2e4")
+  InitBoardFromFEN(&b, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+  if GetHash(&a) != GetHash(&b) {
+    t.Errorf("an en passant square nobody can use changed the hash")
+  }
+
+  // here d5 can take it, so it does
+  InitBoardFromFEN(&a, "rnbqkbnr/ppp1pppp/8/8/3p4/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+  playUCIMoves(t, &a, "e2e4")
+  InitBoardFromFEN(&b, "rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+  if GetHash(&a) == GetHash(&b) {
+    t.Errorf("a usable en passant square didn't change the hash")
+  }
+}